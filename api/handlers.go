@@ -2,12 +2,18 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"rag-pipeline/evaluation"
 	"rag-pipeline/models"
 	"rag-pipeline/services"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
 var ragService *services.RAGService
@@ -15,12 +21,31 @@ var evaluator *evaluation.Evaluator
 
 // InitService initializes the api service
 func InitService(config *models.Config) error {
+	// the workers and the watcher of a previous service would keep running
+	if ragService != nil && ragService.Jobs != nil {
+		ragService.Jobs.Close()
+	}
+	if ragService != nil && ragService.Watcher != nil {
+		ragService.Watcher.Close()
+	}
+
 	var err error
 	ragService, err = services.NewRAGService(config, config.Api.CollectionName)
 	if err != nil {
 		return err
 	}
 
+	// only the API collection runs ingest jobs
+	if err := ragService.StartJobs(config.Api.CollectionName); err != nil {
+		return err
+	}
+
+	if config.Watcher.Enabled {
+		if err := ragService.StartWatcher(config.Api.CollectionName); err != nil {
+			return err
+		}
+	}
+
 	evaluator, err = evaluation.NewEvaluator(config)
 	if err != nil {
 		return err
@@ -48,7 +73,7 @@ func AskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	generatedResponse, chunks, err := ragService.GenerateResponse(req.Query)
+	generatedResponse, chunks, err := ragService.GenerateResponse(req.Query, req.Filter)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to generate the response", err)
 		return
@@ -90,10 +115,121 @@ func AskDirectlyHandler(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, response)
 }
 
-// StoreBookHandler is endpoint to store document into vector DB
+// StoreBookHandler is endpoint to store documents into vector DB. Every "file" part is stored,
+// .zip, .tar and .tar.gz archives are unpacked. The response holds a result for every file,
+// a file that fails does not stop the others. Plain text files of at least streaming.min_size
+// bytes are streamed into the collection. With async=true the files are stored by a
+// background job and the response is 202 Accepted with the job, see GetJobHandler
 func StoreBookHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, "Send the files as multipart form data: ", err)
+		return
+	}
+
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		writeError(w, http.StatusBadRequest, "Set the key: 'file' ", http.ErrMissingFile)
+		return
+	}
+
+	if async, _ := strconv.ParseBool(r.FormValue("async")); async {
+		// the job copies the files from their temporary files, they are not read into memory
+		uploads := make([]models.Upload, 0, len(headers))
+		for _, header := range headers {
+			file, err := header.Open()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to read the file "+header.Filename+": ", err)
+				return
+			}
+			defer file.Close()
+			uploads = append(uploads, models.Upload{Filename: header.Filename, File: file, Size: header.Size})
+		}
+
+		job, err := ragService.Jobs.Submit(uploads)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to queue the job: ", err)
+			return
+		}
+
+		response := models.ApiResponse{
+			Success:   true,
+			Message:   "Job queued, poll /api/jobs/" + job.ID,
+			Data:      job,
+			Timestamp: time.Now(),
+		}
+
+		writeJSON(w, http.StatusAccepted, response)
+		return
+	}
+
+	// the files are read from the form one at a time, large text files are streamed from their temporary file
+	var results []models.StoreResult
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to read the file "+header.Filename+": ", err)
+			return
+		}
+		results = append(results, ragService.StoreUpload(header.Filename, file, header.Size)...)
+		file.Close()
+	}
 
-	file, _, err := r.FormFile("file")
+	writeStoreResults(w, results, "files")
+}
+
+// IngestURLHandler stores the web page or the pages of the sitemap of the request and the pages
+// linked from them, the response holds a result for every page
+func IngestURLHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.IngestURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	results, err := ragService.IngestURL(req)
+	if errors.Is(err, services.ErrInvalidCrawl) {
+		writeError(w, http.StatusBadRequest, "Invalid request: ", err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to ingest the URL: ", err)
+		return
+	}
+
+	writeStoreResults(w, results, "pages")
+}
+
+// writeStoreResults writes the results of the stored files or pages, the request failed only if nothing could be stored
+func writeStoreResults(w http.ResponseWriter, results []models.StoreResult, noun string) {
+	stored, failed := 0, 0
+	for _, result := range results {
+		switch result.Status {
+		case "stored":
+			stored++
+		case "failed":
+			failed++
+		}
+	}
+
+	status := http.StatusOK
+	if stored == 0 && failed > 0 {
+		status = http.StatusInternalServerError
+	}
+
+	response := models.ApiResponse{
+		Success:   failed == 0,
+		Message:   fmt.Sprintf("Stored %d of %d %s", stored, len(results), noun),
+		Data:      results,
+		Timestamp: time.Now(),
+	}
+
+	writeJSON(w, status, response)
+}
+
+// StoreRecordsHandler stores every record of the uploaded JSON, JSONL or CSV file as its own
+// retrievable unit. The form fields text_fields, metadata_fields and id_field name the fields
+// of the records, the list fields may be repeated or comma separated
+func StoreRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	file, header, err := r.FormFile("file")
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "Set the key: 'file' ", err)
 		return
@@ -102,19 +238,220 @@ func StoreBookHandler(w http.ResponseWriter, r *http.Request) {
 
 	content, err := io.ReadAll(file)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "File could not be converted to text. Send only .txt type files ", err)
+		writeError(w, http.StatusInternalServerError, "File could not be read ", err)
+		return
+	}
+
+	settings := models.RecordSettings{
+		TextFields:     formList(r, "text_fields"),
+		MetadataFields: formList(r, "metadata_fields"),
+		IDField:        strings.TrimSpace(r.FormValue("id_field")),
+	}
+
+	doc, err := ragService.StoreRecords(header.Filename, content, settings)
+	if errors.Is(err, services.ErrInvalidRecords) {
+		writeError(w, http.StatusBadRequest, "Invalid records: ", err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to store the records: ", err)
 		return
 	}
 
-	err = ragService.StoreData(string(content))
+	response := models.ApiResponse{
+		Success:   true,
+		Message:   "Records stored successfully!",
+		Data:      doc,
+		Timestamp: time.Now(),
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// formList returns the values of the repeated or comma separated form field
+func formList(r *http.Request, key string) []string {
+	var values []string
+	for _, value := range r.Form[key] {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+// ChunkPreviewHandler returns the chunks the uploaded file would be split into.
+// The form fields strategy, size, overlap, unit, separators, breakpoint_percentile and
+// min_size override the chunk settings of the collection. Nothing is stored
+func ChunkPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Set the key: 'file' ", err)
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to store teh data", err)
+		writeError(w, http.StatusInternalServerError, "File could not be read ", err)
+		return
+	}
+
+	settings, err := chunkSettingsFromForm(r, ragService.ChunkSettings)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid chunk settings: ", err)
+		return
+	}
+
+	preview, err := ragService.PreviewChunks(header.Filename, content, settings)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to chunk the file: ", err)
+		return
+	}
+
+	response := models.ApiResponse{
+		Success:   true,
+		Data:      preview,
+		Timestamp: time.Now(),
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// chunkSettingsFromForm returns the defaults with the chunk settings given in the form applied
+func chunkSettingsFromForm(r *http.Request, defaults models.ChunkSettings) (models.ChunkSettings, error) {
+	settings := defaults
+
+	if value := r.FormValue("strategy"); value != "" {
+		settings.Strategy = value
+	}
+	if value := r.FormValue("unit"); value != "" {
+		settings.Unit = value
+	}
+	if values := r.Form["separators"]; len(values) > 0 {
+		settings.Separators = values
+	}
+
+	for key, target := range map[string]*int{"size": &settings.Size, "overlap": &settings.Overlap, "min_size": &settings.MinSize} {
+		value := r.FormValue(key)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return settings, fmt.Errorf("%s must be an integer, got %q", key, value)
+		}
+		*target = number
+	}
+
+	if value := r.FormValue("breakpoint_percentile"); value != "" {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return settings, fmt.Errorf("breakpoint_percentile must be a number, got %q", value)
+		}
+		settings.BreakpointPercentile = number
+	}
+
+	return settings, nil
+}
+
+// ListDocumentsHandler returns the records of all stored documents
+func ListDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	response := models.ApiResponse{
+		Success:   true,
+		Data:      ragService.ListDocuments(),
+		Timestamp: time.Now(),
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// GetDocumentHandler returns the record of the document with the given id
+func GetDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	doc, err := ragService.GetDocument(chi.URLParam(r, "id"))
+	if errors.Is(err, services.ErrDocumentNotFound) {
+		writeError(w, http.StatusNotFound, "Unknown document: ", err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get the document: ", err)
+		return
+	}
+
+	response := models.ApiResponse{
+		Success:   true,
+		Data:      doc,
+		Timestamp: time.Now(),
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// DeleteDocumentHandler removes the document with the given id and all of its chunks
+func DeleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	err := ragService.DeleteDocument(chi.URLParam(r, "id"))
+	if errors.Is(err, services.ErrDocumentNotFound) {
+		writeError(w, http.StatusNotFound, "Unknown document: ", err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete the document: ", err)
+		return
+	}
+
+	response := models.ApiResponse{
+		Success:   true,
+		Message:   "Document deleted successfully!",
+		Timestamp: time.Now(),
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// ListJobsHandler returns all ingest jobs of the collection
+func ListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	response := models.ApiResponse{
+		Success:   true,
+		Data:      ragService.Jobs.List(),
+		Timestamp: time.Now(),
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// GetJobHandler returns the state, the progress and the per-file results of the job with the given id
+func GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := ragService.Jobs.Get(chi.URLParam(r, "id"))
+	if errors.Is(err, services.ErrJobNotFound) {
+		writeError(w, http.StatusNotFound, "Unknown job: ", err)
+		return
+	}
+
+	response := models.ApiResponse{
+		Success:   true,
+		Data:      job,
+		Timestamp: time.Now(),
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// CancelJobHandler cancels the job with the given id, a running job stops before its next embedding batch
+func CancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := ragService.Jobs.Cancel(chi.URLParam(r, "id"))
+	if errors.Is(err, services.ErrJobNotFound) {
+		writeError(w, http.StatusNotFound, "Unknown job: ", err)
+		return
+	} else if errors.Is(err, services.ErrJobFinished) {
+		writeError(w, http.StatusConflict, "The job can not be cancelled: ", err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to cancel the job: ", err)
 		return
 	}
 
 	response := models.ApiResponse{
 		Success:   true,
-		Message:   "File data stored successfully!",
+		Message:   "Job cancellation requested",
+		Data:      job,
 		Timestamp: time.Now(),
 	}
 
@@ -1,10 +1,24 @@
 package api
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rag-pipeline/models"
+	"rag-pipeline/services"
+	"rag-pipeline/utils"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestPingHandler(t *testing.T) {
@@ -36,16 +50,1055 @@ func TestPingHandler(t *testing.T) {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	//Check that the 'status' field value is 'success'
-	status, ok := response["status"]
+	//Check that the 'success' field value is true
+	success, ok := response["success"]
 	if !ok {
-		t.Error("Response missing 'status' field")
+		t.Error("Response missing 'success' field")
 	}
-	if status != "success" {
-		t.Errorf("Expected status 'success', got '%v'", status)
+	if success != true {
+		t.Errorf("Expected success 'true', got '%v'", success)
 	}
 }
 
 func TestAskHandler(t *testing.T) {
 	// TODO
 }
+
+// newFakeOllama starts a server that answers the Ollama embed endpoint with small
+// deterministic vectors and the generate endpoint with a fixed text, so the pipeline runs without Ollama
+func newFakeOllama(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/generate" {
+			json.NewEncoder(w).Encode(models.LLMResult{Response: "\"A story about counting.\"\nSecond line", Done: true})
+			return
+		}
+
+		var req models.EmbedRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var resp models.EmbedResponse
+		for _, input := range req.Input {
+			resp.Embeddings = append(resp.Embeddings, []float32{float32(len(input)), 1, 0, 1})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newTestConfig returns a config that uses the in-memory vector store and the given Ollama url
+func newTestConfig(ollamaURL string) *models.Config {
+	var config models.Config
+	config.VectorStore = "memory"
+	config.Api.CollectionName = "test_collection"
+	config.Evaluation.CollectionName = "test_eval_collection"
+	config.Chunk.Size = 5
+	config.Chunk.Overlap = 1
+	config.Retrieval.TopK = 2
+	config.Embedding.ModelDimension = 4
+	config.Embedding.Endpoint = "/api/embed"
+	config.Generator.Endpoint = "/api/generate"
+	config.Ollama.BaseURL = ollamaURL
+	return &config
+}
+
+func TestDocumentHandlers(t *testing.T) {
+	if err := InitService(newTestConfig(newFakeOllama(t).URL)); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+	r := CreateRAGRouter()
+
+	// POST /api/storebook
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "book.txt")
+	part.Write([]byte("one two three four five six seven eight nine ten"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/storebook", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/storebook: expected 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var stored struct {
+		Data []models.StoreResult `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&stored); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(stored.Data) != 1 || stored.Data[0].Filename != "book.txt" || stored.Data[0].Status != "stored" || stored.Data[0].ChunkCount != 3 {
+		t.Fatalf("Unexpected store results: %+v", stored.Data)
+	}
+	id := stored.Data[0].DocumentID
+
+	// GET /api/documents
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/documents", nil))
+
+	var listed struct {
+		Data []models.Document `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(listed.Data) != 1 || listed.Data[0].ID != id {
+		t.Errorf("Expected the stored document in the list, got %+v", listed.Data)
+	}
+
+	// DELETE /api/documents/{id}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/documents/"+id, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("DELETE /api/documents/{id}: expected 200 OK, got %d", w.Code)
+	}
+
+	// GET /api/documents/{id}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/documents/"+id, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /api/documents/{id}: expected 404 after delete, got %d", w.Code)
+	}
+
+	results, err := ragService.VectorDB.Query([]float32{1, 1, 0, 1}, 10, nil)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Expected no chunks after delete, got %d", len(results))
+	}
+}
+
+func TestStoreDataReingest(t *testing.T) {
+	// the embedding model fails from the failAt-th request on, if failAt is set
+	var requests, failAt atomic.Int32
+	ollama := newFakeOllama(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := requests.Add(1); failAt.Load() > 0 && n >= failAt.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		ollama.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	failFrom := func(request int32) {
+		requests.Store(0)
+		failAt.Store(request)
+	}
+
+	config := newTestConfig(server.URL)
+	config.Embedding.BatchSize = 1
+	if err := InitService(config); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+
+	countChunks := func() int {
+		t.Helper()
+		results, err := ragService.VectorDB.Query([]float32{1, 1, 0, 1}, 100, nil)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		return len(results)
+	}
+	store := func(content string) *models.Document {
+		t.Helper()
+		doc, err := ragService.StoreData("book.txt", []byte(content))
+		if err != nil {
+			t.Fatalf("StoreData failed: %v", err)
+		}
+		return doc
+	}
+
+	book := "one two three four five six seven eight nine ten"
+	first := store(book)
+	if countChunks() != first.ChunkCount {
+		t.Fatalf("Expected %d chunks, got %d", first.ChunkCount, countChunks())
+	}
+
+	// the same content gets the same point IDs, uploading it again does not add chunks
+	if again := store(book); again.ID != first.ID || countChunks() != first.ChunkCount {
+		t.Errorf("Expected the upload to be idempotent, got %s with %d chunks", again.ID, countChunks())
+	}
+
+	// a re-ingest that fails partway keeps every point of the registered document
+	ragService.Chunker = services.NewWordChunker(2, 0)
+	failFrom(2)
+	if _, err := ragService.StoreData("book.txt", []byte(book)); err == nil {
+		t.Fatalf("Expected the re-ingest to fail")
+	}
+	failFrom(0)
+	stored, err := ragService.VectorDB.Get(first.ID, []int{0, 1, 2})
+	if err != nil || len(stored) != first.ChunkCount || countChunks() != first.ChunkCount {
+		t.Errorf("Expected the %d chunks of the document after a failed re-ingest, got %d (%v)", first.ChunkCount, countChunks(), err)
+	}
+	if doc, err := ragService.GetDocument(first.ID); err != nil || doc.ChunkCount != first.ChunkCount {
+		t.Errorf("Expected the record of the document to be kept, got %+v (%v)", doc, err)
+	}
+
+	// a first ingest that fails partway leaves nothing behind
+	failFrom(2)
+	if _, err := ragService.StoreData("new.txt", []byte("eleven twelve thirteen fourteen")); err == nil {
+		t.Fatalf("Expected the ingest to fail")
+	}
+	failFrom(0)
+	if countChunks() != first.ChunkCount || len(ragService.ListDocuments()) != 1 {
+		t.Errorf("Expected no chunks of the failed document, got %d chunks", countChunks())
+	}
+
+	// a re-ingest with larger chunks leaves none of the old chunks behind
+	ragService.Chunker = services.NewWordChunker(20, 0)
+	if rechunked := store(book); rechunked.ChunkCount != 1 || countChunks() != 1 {
+		t.Errorf("Expected only the 1 new chunk, got %d chunks in the store", countChunks())
+	}
+
+	// other content is a new document, its chunks are appended
+	other := store("eleven twelve thirteen")
+	if other.ID == first.ID || countChunks() != 2 || len(ragService.ListDocuments()) != 2 {
+		t.Errorf("Expected 2 documents with 2 chunks, got %d chunks", countChunks())
+	}
+}
+
+func TestStoreBookHandlerMultipleFiles(t *testing.T) {
+	if err := InitService(newTestConfig(newFakeOllama(t).URL)); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+	r := CreateRAGRouter()
+
+	var archive bytes.Buffer
+	zipWriter := zip.NewWriter(&archive)
+	for name, content := range map[string]string{
+		"docs/a.md":       "one two three",
+		"docs/.hidden.md": "hidden",
+		"docs/image.png":  "\x89PNG\x00\x00",
+		"docs/broken.pdf": "%PDF-1.4 not really a pdf",
+	} {
+		file, _ := zipWriter.Create(name)
+		file.Write([]byte(content))
+	}
+	zipWriter.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "first.txt")
+	part.Write([]byte("one two three four five six"))
+	part, _ = writer.CreateFormFile("file", "corpus.zip")
+	part.Write(archive.Bytes())
+	part, _ = writer.CreateFormFile("file", "photo.png")
+	part.Write([]byte("\x89PNG\x00\x00"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/storebook", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	// one bad file does not abort the others
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/storebook: expected 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Success bool                 `json:"success"`
+		Data    []models.StoreResult `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Success {
+		t.Error("Expected success false with a failed file")
+	}
+
+	statuses := make(map[string]string)
+	for _, result := range response.Data {
+		statuses[result.Filename] = result.Status
+		if result.Status == "stored" && (result.DocumentID == "" || result.ChunkCount == 0) {
+			t.Errorf("Expected a document ID and chunk count, got %+v", result)
+		}
+		if result.Status != "stored" && result.Error == "" {
+			t.Errorf("Expected an error for %s", result.Filename)
+		}
+	}
+
+	expected := map[string]string{
+		"first.txt":                  "stored",
+		"corpus.zip/docs/a.md":       "stored",
+		"corpus.zip/docs/image.png":  "skipped",
+		"corpus.zip/docs/broken.pdf": "failed",
+		"photo.png":                  "failed",
+	}
+	if len(statuses) != len(expected) {
+		t.Errorf("Expected %d results, got %+v", len(expected), response.Data)
+	}
+	for name, status := range expected {
+		if statuses[name] != status {
+			t.Errorf("Expected %s to be %s, got %q", name, status, statuses[name])
+		}
+	}
+}
+
+func TestStoreBookHandlerStreaming(t *testing.T) {
+	config := newTestConfig(newFakeOllama(t).URL)
+	config.Streaming.MinSize = 1
+	config.Embedding.BatchSize = 2
+	if err := InitService(config); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+	r := CreateRAGRouter()
+
+	storeBook := func() models.StoreResult {
+		t.Helper()
+
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", "book.txt")
+		part.Write([]byte("one two three\r\nfour five six\fseven eight nine ten eleven twelve"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/storebook", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var stored struct {
+			Data []models.StoreResult `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&stored); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if w.Code != http.StatusOK || len(stored.Data) != 1 || stored.Data[0].Status != "stored" {
+			t.Fatalf("POST /api/storebook: expected a stored file, got %d: %+v", w.Code, stored.Data)
+		}
+		return stored.Data[0]
+	}
+
+	countChunks := func() int {
+		t.Helper()
+		results, err := ragService.VectorDB.Query([]float32{1, 1, 0, 1}, 100, nil)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		return len(results)
+	}
+
+	streamed := storeBook()
+	streamedChunks := countChunks()
+	if err := ragService.DeleteDocument(streamed.DocumentID); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+
+	// the streamed file is stored like a file that is read whole
+	ragService.Config.Streaming.MinSize = 0
+	read := storeBook()
+	if streamed != read {
+		t.Errorf("Expected the streamed result %+v to equal %+v", streamed, read)
+	}
+	if chunks := countChunks(); streamedChunks != chunks || chunks != read.ChunkCount {
+		t.Errorf("Expected %d chunks in the store, streamed %d, read whole %d", read.ChunkCount, streamedChunks, chunks)
+	}
+}
+
+func TestChunkPreviewHandler(t *testing.T) {
+	if err := InitService(newTestConfig(newFakeOllama(t).URL)); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+	r := CreateRAGRouter()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "book.txt")
+	part.Write([]byte("one two three four five six seven eight nine ten"))
+	writer.WriteField("size", "6")
+	writer.WriteField("overlap", "2")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chunks/preview", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/chunks/preview: expected 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var preview struct {
+		Data models.ChunkPreview `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&preview); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if preview.Data.Settings.Size != 6 || preview.Data.Settings.Overlap != 2 {
+		t.Errorf("Expected the form settings to be applied, got %+v", preview.Data.Settings)
+	}
+	if len(preview.Data.Chunks) != 2 || preview.Data.Chunks[1].Text != "five six seven eight nine ten" {
+		t.Errorf("Unexpected preview chunks: %+v", preview.Data.Chunks)
+	}
+	if stats := preview.Data.Stats; stats.ChunkCount != 2 || stats.TotalWords != 12 || stats.MaxWords != 6 || stats.AvgWords != 6 {
+		t.Errorf("Unexpected preview stats: %+v", stats)
+	}
+
+	// nothing is stored
+	if documents := ragService.ListDocuments(); len(documents) != 0 {
+		t.Errorf("Expected no stored documents after a preview, got %d", len(documents))
+	}
+
+	// invalid settings are rejected
+	body = &bytes.Buffer{}
+	writer = multipart.NewWriter(body)
+	part, _ = writer.CreateFormFile("file", "book.txt")
+	part.Write([]byte("one two three"))
+	writer.WriteField("overlap", "many")
+	writer.Close()
+
+	req = httptest.NewRequest(http.MethodPost, "/api/chunks/preview", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid overlap, got %d", w.Code)
+	}
+
+	// semantic chunks that could not be embedded are reported
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	ragService.Embedder = services.NewOllamaEmbedder(down.URL, "test", "/api/embed")
+
+	body = &bytes.Buffer{}
+	writer = multipart.NewWriter(body)
+	part, _ = writer.CreateFormFile("file", "book.txt")
+	part.Write([]byte("One sentence here. Another one there."))
+	writer.WriteField("strategy", "semantic")
+	writer.WriteField("size", "100")
+	writer.Close()
+
+	req = httptest.NewRequest(http.MethodPost, "/api/chunks/preview", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	preview.Data = models.ChunkPreview{}
+	if err := json.NewDecoder(w.Body).Decode(&preview); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || len(preview.Data.Warnings) != 1 || preview.Data.Chunks[0].Metadata["chunking_fallback"] != "size" {
+		t.Errorf("Expected the fallback to be reported, got %d: %+v", w.Code, preview.Data)
+	}
+}
+
+func TestContextualHeaders(t *testing.T) {
+	config := newTestConfig(newFakeOllama(t).URL)
+	config.ContextualHeaders.Enabled = true
+	if err := InitService(config); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+
+	if _, err := ragService.StoreData("my_book.txt", []byte("one two three four five")); err != nil {
+		t.Fatalf("StoreData failed: %v", err)
+	}
+
+	results, err := ragService.VectorDB.Query([]float32{1, 1, 0, 1}, 10, nil)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Expected 1 stored chunk, got %d (%v)", len(results), err)
+	}
+
+	header := "Document: my book\nSummary: A story about counting."
+	if results[0].Metadata["context_header"] != header {
+		t.Errorf("Expected header %q, got %q", header, results[0].Metadata["context_header"])
+	}
+
+	// the payload keeps the original text, the fake embedding encodes the length of the embedded text
+	if results[0].Text != "one two three four five" {
+		t.Errorf("Expected the original chunk text, got %q", results[0].Text)
+	}
+	embedded := header + "\n\n" + "one two three four five"
+	stored, _ := ragService.VectorDB.Query([]float32{float32(len(embedded)), 1, 0, 1}, 1, nil)
+	if len(stored) != 1 || stored[0].Score < 0.9999 {
+		t.Errorf("Expected the chunk to be embedded with its header, got score %v", stored)
+	}
+}
+
+func TestStoreRecordsHandler(t *testing.T) {
+	if err := InitService(newTestConfig(newFakeOllama(t).URL)); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+	r := CreateRAGRouter()
+
+	post := func(fields map[string]string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", "faq.jsonl")
+		part.Write([]byte(`{"id": 17, "question": "How do I count sheep?", "answer": "One by one.", "meta": {"category": "sleep", "tags": ["night", "sheep"]}}
+{"id": 18, "question": "", "answer": ""}
+{"id": 19, "question": "Can sheep swim?", "answer": "Yes.", "meta": {"category": "animals"}}`))
+		for key, value := range fields {
+			writer.WriteField(key, value)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/storerecords", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(map[string]string{"metadata_fields": "text"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without text fields, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := post(map[string]string{"text_fields": "question, answer", "metadata_fields": "meta.category,meta.tags", "id_field": "id"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/storerecords: expected 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var stored struct {
+		Data models.Document `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&stored); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if stored.Data.ChunkCount != 5 || stored.Data.Metadata["record_count"] != float64(2) || stored.Data.Metadata["format"] != "jsonl" {
+		t.Errorf("Unexpected document record: %+v", stored.Data)
+	}
+
+	// the 10 words of record 17 are split into 3 chunks, all of them carry its metadata fields
+	results, err := ragService.VectorDB.Query([]float32{1, 1, 0, 1}, 10, models.PayloadFilter{"meta.tags": "night"})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("Expected 3 chunks tagged night, got %d (%v)", len(results), err)
+	}
+	for _, result := range results {
+		if result.Metadata["record_id"] != "17" || result.Metadata["meta.category"] != "sleep" {
+			t.Errorf("Unexpected record metadata %v", result.Metadata)
+		}
+		// the chunk text is built from the record fields, it has no span in the file
+		if result.Span != nil {
+			t.Errorf("Expected no span for a record chunk, got %+v", result.Span)
+		}
+	}
+
+	// the chunks are numbered across the file
+	results, _ = ragService.VectorDB.Query([]float32{1, 1, 0, 1}, 10, models.PayloadFilter{"record_id": "19"})
+	if len(results) != 2 || min(results[0].ChunkID, results[1].ChunkID) != 3 {
+		t.Errorf("Expected chunks 3 and 4 for record 19, got %+v", results)
+	}
+}
+
+// waitForJob polls GET /api/jobs/{id} until the job is finished
+func waitForJob(t *testing.T, r http.Handler, id string) models.Job {
+	t.Helper()
+
+	for range 200 {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/jobs/"+id, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/jobs/{id}: expected 200 OK, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var response struct {
+			Data models.Job `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if state := response.Data.State; state != "queued" && state != "running" {
+			return response.Data
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Job %s did not finish", id)
+	return models.Job{}
+}
+
+func TestJobHandlers(t *testing.T) {
+	config := newTestConfig(newFakeOllama(t).URL)
+	config.Storage.DataDir = t.TempDir()
+	config.Embedding.BatchSize = 2
+	if err := InitService(config); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+	r := CreateRAGRouter()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "book.txt")
+	part.Write([]byte("one two three four five six seven eight nine ten"))
+	part, _ = writer.CreateFormFile("file", "broken.pdf")
+	part.Write([]byte("%PDF-1.4 not really a pdf"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/storebook?async=true", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST /api/storebook?async=true: expected 202 Accepted, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var queued struct {
+		Data models.Job `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&queued); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if queued.Data.ID == "" || queued.Data.Progress.FilesTotal != 2 {
+		t.Fatalf("Unexpected job: %+v", queued.Data)
+	}
+
+	job := waitForJob(t, r, queued.Data.ID)
+	if job.State != "completed" || job.Error == "" {
+		t.Errorf("Expected a completed job with a failed file, got %+v", job)
+	}
+	if job.Files[0].Status != "stored" || job.Files[0].ChunkCount != 3 || job.Files[1].Status != "failed" {
+		t.Errorf("Unexpected file results: %+v", job.Files)
+	}
+	if progress := job.Progress; progress.FilesDone != 2 || progress.ChunksEmbedded != 3 || progress.ChunksTotal != 3 {
+		t.Errorf("Unexpected progress: %+v", progress)
+	}
+	if _, err := ragService.GetDocument(job.Files[0].DocumentID); err != nil {
+		t.Errorf("Expected the stored document to be registered: %v", err)
+	}
+
+	// a finished job can not be cancelled
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/jobs/"+job.ID+"/cancel", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("POST /api/jobs/{id}/cancel: expected 409 Conflict, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/jobs/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /api/jobs/{id}: expected 404 for an unknown job, got %d", w.Code)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	// the embed requests wait until they are released, so the first job stays running
+	fake := newFakeOllama(t)
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	gated := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		fake.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(gated.Close)
+	released := false
+	defer func() {
+		if !released {
+			close(release)
+		}
+	}()
+
+	config := newTestConfig(gated.URL)
+	config.Storage.DataDir = t.TempDir()
+	config.Embedding.BatchSize = 1
+	config.Jobs.Workers = 1
+	if err := InitService(config); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+	r := CreateRAGRouter()
+
+	submit := func(filename string, content string) models.Job {
+		t.Helper()
+
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", filename)
+		part.Write([]byte(content))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/storebook?async=true", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var response struct {
+			Data models.Job `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil || w.Code != http.StatusAccepted {
+			t.Fatalf("POST /api/storebook?async=true: expected 202 Accepted, got %d: %v", w.Code, err)
+		}
+		return response.Data
+	}
+
+	cancel := func(id string) models.Job {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/jobs/"+id+"/cancel", nil))
+		var response struct {
+			Data models.Job `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("POST /api/jobs/{id}/cancel: expected 200 OK, got %d: %v", w.Code, err)
+		}
+		return response.Data
+	}
+
+	running := submit("book.txt", "one two three four five six seven eight nine ten")
+	<-started
+	queued := submit("other.txt", "eleven twelve thirteen")
+
+	// the queued job is cancelled at once and its uploaded file is removed
+	if job := cancel(queued.ID); job.State != "cancelled" || job.Files[0].Status != "cancelled" {
+		t.Errorf("Expected the queued job to be cancelled, got %+v", job)
+	}
+	if _, err := os.Stat(filepath.Join(config.Storage.DataDir, "test_collection_jobs", queued.ID)); !os.IsNotExist(err) {
+		t.Errorf("Expected the files of the cancelled job to be removed, got %v", err)
+	}
+
+	// the running job stops before its next batch
+	cancel(running.ID)
+	close(release)
+	released = true
+
+	job := waitForJob(t, r, running.ID)
+	if job.State != "cancelled" || job.Files[0].Status != "cancelled" {
+		t.Errorf("Expected the running job to be cancelled, got %+v", job)
+	}
+
+	// the chunks stored before the cancel are discarded and nothing is registered
+	results, _ := ragService.VectorDB.Query([]float32{1, 1, 0, 1}, 10, nil)
+	if len(results) != 0 {
+		t.Errorf("Expected the chunks of the cancelled file to be discarded, got %+v", results)
+	}
+	if documents := ragService.ListDocuments(); len(documents) != 0 {
+		t.Errorf("Expected no registered documents, got %+v", documents)
+	}
+	if job := waitForJob(t, r, queued.ID); job.State != "cancelled" {
+		t.Errorf("Expected the queued job to stay cancelled, got %+v", job)
+	}
+
+	// Close stops the workers, a closed queue takes no jobs
+	ragService.Jobs.Close()
+	if _, err := ragService.Jobs.Submit([]models.Upload{{Filename: "late.txt", Content: []byte("late")}}); err == nil {
+		t.Error("Expected an error for a job submitted to a closed queue")
+	}
+}
+
+func TestJobResumesAfterRestart(t *testing.T) {
+	config := newTestConfig(newFakeOllama(t).URL)
+	config.Storage.DataDir = t.TempDir()
+	config.Embedding.BatchSize = 1
+
+	// the service stopped after two of the three chunks of the file were stored
+	jobs := []models.Job{{
+		ID:           "interrupted",
+		State:        "running",
+		Files:        []models.StoreResult{{Filename: "book.txt", Status: "queued"}},
+		Progress:     models.JobProgress{FilesTotal: 1, ChunksEmbedded: 2, ChunksTotal: 3},
+		StoredChunks: 2,
+	}}
+	data, _ := json.Marshal(jobs)
+	jobsDir := filepath.Join(config.Storage.DataDir, "test_collection_jobs", "interrupted")
+	os.MkdirAll(jobsDir, 0o755)
+	os.WriteFile(filepath.Join(jobsDir, "0"), []byte("one two three four five six seven eight nine ten"), 0o644)
+	os.WriteFile(filepath.Join(config.Storage.DataDir, "test_collection_jobs.json"), data, 0o644)
+
+	if err := InitService(config); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+
+	job := waitForJob(t, CreateRAGRouter(), "interrupted")
+	if job.State != "completed" || job.Files[0].Status != "stored" || job.Files[0].ChunkCount != 3 {
+		t.Fatalf("Expected the resumed job to complete, got %+v", job)
+	}
+
+	// only the chunk that was not stored before the restart is embedded again
+	results, _ := ragService.VectorDB.Query([]float32{1, 1, 0, 1}, 10, nil)
+	if len(results) != 1 || results[0].Text != "nine ten" {
+		t.Errorf("Expected only the last chunk to be embedded, got %+v", results)
+	}
+
+	if _, err := os.Stat(jobsDir); !os.IsNotExist(err) {
+		t.Errorf("Expected the uploaded files of the finished job to be removed, got %v", err)
+	}
+}
+
+func TestFolderWatcher(t *testing.T) {
+	config := newTestConfig(newFakeOllama(t).URL)
+	config.Storage.DataDir = t.TempDir()
+	config.Watcher.Dir = filepath.Join(t.TempDir(), "inbox")
+	if err := InitService(config); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+
+	watcher, err := services.NewFolderWatcher(ragService, config, config.Api.CollectionName)
+	if err != nil {
+		t.Fatalf("NewFolderWatcher failed: %v", err)
+	}
+
+	// a file is stored once it is unchanged for one scan
+	scan := func() {
+		t.Helper()
+		for range 2 {
+			if err := watcher.Scan(); err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+		}
+	}
+	filenames := func() []string {
+		var names []string
+		for _, doc := range ragService.ListDocuments() {
+			names = append(names, doc.Filename)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	notes := filepath.Join(config.Watcher.Dir, "notes", "sheep.txt")
+	os.MkdirAll(filepath.Dir(notes), 0o755)
+	os.WriteFile(notes, []byte("one two three four five six"), 0o644)
+	os.WriteFile(filepath.Join(config.Watcher.Dir, "goats.md"), []byte("# Goats\n\nGoats climb."), 0o644)
+	os.WriteFile(filepath.Join(config.Watcher.Dir, ".hidden.txt"), []byte("hidden"), 0o644)
+	os.WriteFile(filepath.Join(config.Watcher.Dir, "image.png"), []byte("\x89PNG\x00\x00"), 0o644)
+
+	if err := watcher.Scan(); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if names := filenames(); len(names) != 0 {
+		t.Fatalf("Expected no document after the first scan, got %v", names)
+	}
+	scan()
+	if names := filenames(); !slices.Equal(names, []string{"goats.md", "notes/sheep.txt"}) {
+		t.Fatalf("Unexpected documents: %v", names)
+	}
+	first := ragService.ListDocuments()
+
+	// a modified file replaces the chunks of its old content
+	os.WriteFile(notes, []byte("seven eight nine"), 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(notes, later, later)
+	scan()
+
+	documents := ragService.ListDocuments()
+	if len(documents) != 2 {
+		t.Fatalf("Expected 2 documents after the modification, got %+v", documents)
+	}
+	for _, doc := range first {
+		if doc.Filename == "notes/sheep.txt" {
+			if _, err := ragService.GetDocument(doc.ID); err == nil {
+				t.Error("Expected the old content of the modified file to be deleted")
+			}
+		}
+	}
+	results, _ := ragService.VectorDB.Query([]float32{1, 1, 0, 1}, 10, models.PayloadFilter{"filename": "notes/sheep.txt"})
+	if len(results) != 1 || results[0].Text != "seven eight nine" {
+		t.Errorf("Expected only the new chunk of the modified file, got %+v", results)
+	}
+
+	// the chunks of a removed file are deleted
+	os.Remove(filepath.Join(config.Watcher.Dir, "goats.md"))
+	scan()
+	if names := filenames(); !slices.Equal(names, []string{"notes/sheep.txt"}) {
+		t.Errorf("Expected the removed file to be deleted, got %v", names)
+	}
+
+	// a document that was also uploaded is kept, whether it was uploaded before or after the file was added
+	for i, uploadFirst := range []bool{true, false} {
+		name := fmt.Sprintf("cows%d.txt", i)
+		content := []byte(fmt.Sprintf("cows graze %d", i))
+		upload := func() {
+			t.Helper()
+			if _, err := ragService.StoreData("upload-"+name, content); err != nil {
+				t.Fatalf("StoreData failed: %v", err)
+			}
+		}
+
+		if uploadFirst {
+			upload()
+		}
+		os.WriteFile(filepath.Join(config.Watcher.Dir, name), content, 0o644)
+		scan()
+		if !uploadFirst {
+			upload()
+		}
+
+		os.Remove(filepath.Join(config.Watcher.Dir, name))
+		scan()
+		if _, err := ragService.GetDocument(utils.HashContent(content)[:32]); err != nil {
+			t.Errorf("Expected the uploaded document of %s to be kept, got %v", name, err)
+		}
+	}
+}
+
+func TestInitServiceStopsWatcher(t *testing.T) {
+	config := newTestConfig(newFakeOllama(t).URL)
+	config.Storage.DataDir = t.TempDir()
+	config.Watcher.Enabled = true
+	config.Watcher.Dir = filepath.Join(t.TempDir(), "inbox")
+	config.Watcher.Interval = 1
+	if err := InitService(config); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+	firstService, first := ragService, ragService.Watcher
+
+	// a second init stops the watcher of the first one, instead of adding a poller
+	if err := InitService(config); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+	if ragService.Watcher == nil || ragService.Watcher == first {
+		t.Fatalf("Expected a new watcher, got %v", ragService.Watcher)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		ragService.Watcher.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close did not stop the running watcher")
+	}
+
+	// with both watchers stopped, a new file is not stored
+	os.WriteFile(filepath.Join(config.Watcher.Dir, "sheep.txt"), []byte("one two three"), 0o644)
+	time.Sleep(2500 * time.Millisecond)
+	for _, service := range []*services.RAGService{firstService, ragService} {
+		if docs := service.ListDocuments(); len(docs) != 0 {
+			t.Errorf("Expected no document from a stopped watcher, got %+v", docs)
+		}
+	}
+}
+
+func TestIngestURLHandler(t *testing.T) {
+	requests := 0
+	var site *httptest.Server
+	site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\nAllow: /private/open\n"))
+		case "/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><head><title>Home</title></head><body><p>Sheep are counted at night.</p>
+<a href="/a#top">A</a> <a href="private/x">X</a> <a href="/private/open">Open</a>
+<a href="/notes.txt">Notes</a> <a href="/image.png">Image</a> <a href="http://other.example/">Other</a>
+<a href="/old">Old</a> <a href="/away">Away</a></body></html>`))
+		case "/old":
+			http.Redirect(w, r, "/private/moved", http.StatusMovedPermanently)
+		case "/away":
+			http.Redirect(w, r, "http://other.example/", http.StatusFound)
+		case "/a":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><p>Page A about goats.</p><a href="/b">B</a></body></html>`))
+		case "/b":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><p>Page B about cows.</p></body></html>`))
+		case "/private/open":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><p>An open page.</p></body></html>`))
+		case "/notes.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("plain notes"))
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG"))
+		case "/sitemap.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>` + site.URL + `/a</loc></url><url><loc>` + site.URL + `/b</loc></url></urlset>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(site.Close)
+
+	config := newTestConfig(newFakeOllama(t).URL)
+	config.Crawler.MaxDepth = 2
+	config.Crawler.MaxPages = 20
+	config.Crawler.RequestsPerSecond = 50
+	config.Crawler.Timeout = 5
+	config.Crawler.MaxPageSize = 1 << 20
+	config.Crawler.UserAgent = "rag-pipeline-test/1.0"
+	if err := InitService(config); err != nil {
+		t.Fatalf("InitService failed: %v", err)
+	}
+	r := CreateRAGRouter()
+
+	ingest := func(body string) []models.StoreResult {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/ingest/url", bytes.NewBufferString(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /api/ingest/url: expected 200 OK, got %d: %s", w.Code, w.Body.String())
+		}
+		var response struct {
+			Data []models.StoreResult `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response.Data
+	}
+
+	started := time.Now()
+	results := ingest(`{"url": "` + site.URL + `/", "depth": 1}`)
+
+	statuses := make(map[string]string)
+	for _, result := range results {
+		statuses[strings.TrimPrefix(result.Filename, site.URL)] = result.Status
+	}
+	expected := map[string]string{
+		"/":              "stored",
+		"/a":             "stored",
+		"/private/x":     "skipped",
+		"/private/open":  "stored",
+		"/notes.txt":     "stored",
+		"/image.png":     "skipped",
+		"/private/moved": "skipped", // the target of the redirect of /old is checked against robots.txt
+		"/away":          "skipped", // redirected to another host, which is not requested
+	}
+	if len(statuses) != len(expected) {
+		t.Errorf("Expected %d results, got %+v", len(expected), results)
+	}
+	for page, status := range expected {
+		if statuses[page] != status {
+			t.Errorf("Expected %s to be %s, got %q", page, status, statuses[page])
+		}
+	}
+
+	// the requests to the host are spaced by 20ms, the disallowed page is not requested
+	if elapsed, minimum := time.Since(started), time.Duration(requests-1)*20*time.Millisecond; elapsed < minimum {
+		t.Errorf("Expected %d requests to take at least %v, took %v", requests, minimum, elapsed)
+	}
+
+	chunks, _ := ragService.VectorDB.Query([]float32{1, 1, 0, 1}, 10, models.PayloadFilter{"source_url": site.URL + "/"})
+	if len(chunks) == 0 || chunks[0].Metadata["title"] != "Home" {
+		t.Errorf("Expected the chunks of the start page with its source URL and title, got %+v", chunks)
+	}
+
+	// only the stored pages count toward maxPages
+	results = ingest(`{"url": "` + site.URL + `/", "depth": 1, "maxPages": 3}`)
+	if len(results) != 4 || results[2].Status != "skipped" || results[3].Filename != site.URL+"/private/open" {
+		t.Errorf("Expected 3 stored pages after a skipped one, got %+v", results)
+	}
+
+	// the pages of a sitemap are the start pages
+	results = ingest(`{"url": "` + site.URL + `/sitemap.xml"}`)
+	if len(results) != 2 || results[0].Filename != site.URL+"/a" || results[1].Filename != site.URL+"/b" || results[1].Status != "stored" {
+		t.Errorf("Unexpected sitemap results: %+v", results)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/ingest/url", bytes.NewBufferString(`{"url": "`+site.URL+`", "depth": 3}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST /api/ingest/url: expected 400 for a depth above max_depth, got %d", w.Code)
+	}
+}
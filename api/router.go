@@ -18,11 +18,29 @@ func CreateRAGRouter() *chi.Mux {
 	r.Post("/api/ask", AskHandler)
 	r.Post("/api/ask-directly", AskDirectlyHandler)
 	r.Post("/api/storebook", StoreBookHandler)
+	r.Post("/api/storerecords", StoreRecordsHandler)
+	r.Post("/api/ingest/url", IngestURLHandler)
+	r.Post("/api/chunks/preview", ChunkPreviewHandler)
+	r.Get("/api/documents", ListDocumentsHandler)
+	r.Get("/api/documents/{id}", GetDocumentHandler)
+	r.Delete("/api/documents/{id}", DeleteDocumentHandler)
+	r.Get("/api/jobs", ListJobsHandler)
+	r.Get("/api/jobs/{id}", GetJobHandler)
+	r.Post("/api/jobs/{id}/cancel", CancelJobHandler)
 
 	log.Println("   GET http://localhost:8080/api/ping")                  // Health check endpoint
 	log.Println("   GET http://localhost:8080/api/evaluation/retrieval")  // get evaluation result of retrieval part
 	log.Println("   GET http://localhost:8080/api/evaluation/generation") // get evaluation result of generation part
-	log.Println("   POST http://localhost:8080/api/storebook")            // Store document into vector DB
+	log.Println("   POST http://localhost:8080/api/storebook")            // Store documents into vector DB, with ?async=true as a background job
+	log.Println("   POST http://localhost:8080/api/storerecords")         // Store every record of a JSON, JSONL or CSV file as its own unit
+	log.Println("   POST http://localhost:8080/api/ingest/url")           // Store a web page or the pages of a sitemap and the pages linked from them
+	log.Println("   POST http://localhost:8080/api/chunks/preview")       // Dry run of the chunker on a file, nothing is stored
+	log.Println("   GET http://localhost:8080/api/documents")             // List stored documents
+	log.Println("   GET http://localhost:8080/api/documents/{id}")        // Get a stored document
+	log.Println("   DELETE http://localhost:8080/api/documents/{id}")     // Delete a document and its chunks
+	log.Println("   GET http://localhost:8080/api/jobs")                  // List ingest jobs
+	log.Println("   GET http://localhost:8080/api/jobs/{id}")             // State and progress of an ingest job
+	log.Println("   POST http://localhost:8080/api/jobs/{id}/cancel")     // Cancel an ingest job
 	log.Println("   POST http://localhost:8080/api/ask")                  // Main RAG endpoint: question --> retrieval --> generation --> response
 	log.Println("   POST http://localhost:8080/api/ask-directly")         // question --> generation --> response
 
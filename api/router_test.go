@@ -24,6 +24,10 @@ func TestCreateRAGRouter(t *testing.T) {
 		t.Errorf("TestCreateRAGRouter FAIL: failed to convert raw_config to yaml, detail: %s", err.Error())
 	}
 
+	// Run the pipeline offline against the in-memory vector store
+	config.VectorStore = "memory"
+	config.Storage.DataDir = ""
+
 	// Initialize dependencies before creating router
 	if err := InitApiDependencies(&config); err != nil {
 		t.Errorf("GET /api/ping: expected 200 OK, got %s", err.Error())
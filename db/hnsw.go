@@ -0,0 +1,280 @@
+package db
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// hnswIndex is a Hierarchical Navigable Small World graph for approximate
+// nearest neighbour search over unit length vectors (cosine distance).
+// Deleted nodes stay in the graph as tombstones until the index is rebuilt
+type hnswIndex struct {
+	m              int // neighbours per node on the upper layers
+	mMax0          int // neighbours per node on layer 0
+	efConstruction int
+	efSearch       int
+	levelMult      float64
+
+	nodes    []hnswNode
+	byID     map[string]int
+	entry    int // -1 while the index is empty
+	maxLevel int
+	deleted  int
+	rng      *rand.Rand
+}
+
+type hnswNode struct {
+	id        string
+	vector    []float32
+	neighbors [][]int // neighbors[level] holds the node indexes linked on that level
+	deleted   bool
+}
+
+// hnswCandidate is a node with its distance to the current query
+type hnswCandidate struct {
+	node     int
+	distance float32
+}
+
+// newHNSWIndex creates an empty index with the given graph parameters
+func newHNSWIndex(m int, efConstruction int, efSearch int) *hnswIndex {
+	if m < 2 {
+		m = 16
+	}
+	if efConstruction < m {
+		efConstruction = 200
+	}
+	if efSearch <= 0 {
+		efSearch = 64
+	}
+
+	return &hnswIndex{
+		m:              m,
+		mMax0:          2 * m,
+		efConstruction: efConstruction,
+		efSearch:       efSearch,
+		levelMult:      1 / math.Log(float64(m)),
+		byID:           make(map[string]int),
+		entry:          -1,
+		rng:            rand.New(rand.NewSource(42)), // deterministic graphs for the same insert order
+	}
+}
+
+// len returns the number of live nodes in the index
+func (h *hnswIndex) len() int {
+	return len(h.byID)
+}
+
+// insert adds the unit length vector under id, replacing a previous vector with the same id
+func (h *hnswIndex) insert(id string, vector []float32) {
+	h.remove(id)
+
+	level := int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelMult))
+	nodeIndex := len(h.nodes)
+	h.nodes = append(h.nodes, hnswNode{
+		id:        id,
+		vector:    vector,
+		neighbors: make([][]int, level+1),
+	})
+	h.byID[id] = nodeIndex
+
+	if h.entry == -1 {
+		h.entry = nodeIndex
+		h.maxLevel = level
+		return
+	}
+
+	entryPoints := []hnswCandidate{{node: h.entry, distance: h.distance(vector, h.entry)}}
+	for l := h.maxLevel; l > level; l-- {
+		entryPoints = h.searchLayer(vector, entryPoints, 1, l)
+	}
+
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(vector, entryPoints, h.efConstruction, l)
+
+		neighbors := h.closest(candidates, h.m)
+		h.nodes[nodeIndex].neighbors[l] = neighbors
+
+		for _, neighbor := range neighbors {
+			h.link(neighbor, nodeIndex, l)
+		}
+
+		entryPoints = candidates
+	}
+
+	if level > h.maxLevel {
+		h.entry = nodeIndex
+		h.maxLevel = level
+	}
+}
+
+// remove marks the node stored under id as deleted
+func (h *hnswIndex) remove(id string) {
+	nodeIndex, ok := h.byID[id]
+	if !ok {
+		return
+	}
+
+	h.nodes[nodeIndex].deleted = true
+	delete(h.byID, id)
+	h.deleted++
+}
+
+// needsRebuild reports whether tombstones make up most of the graph
+func (h *hnswIndex) needsRebuild() bool {
+	return h.deleted > 0 && h.deleted >= len(h.byID)
+}
+
+// search returns up to k live nodes closest to the unit length query vector.
+// accept, if not nil, restricts the results to the ids it returns true for
+func (h *hnswIndex) search(query []float32, k int, accept func(id string) bool) []hnswCandidate {
+	if h.entry == -1 || k <= 0 {
+		return nil
+	}
+
+	entryPoints := []hnswCandidate{{node: h.entry, distance: h.distance(query, h.entry)}}
+	for l := h.maxLevel; l > 0; l-- {
+		entryPoints = h.searchLayer(query, entryPoints, 1, l)
+	}
+
+	ef := max(h.efSearch, k)
+	for {
+		candidates := h.searchLayer(query, entryPoints, ef, 0)
+
+		var results []hnswCandidate
+		for _, candidate := range candidates {
+			node := h.nodes[candidate.node]
+			if node.deleted || (accept != nil && !accept(node.id)) {
+				continue
+			}
+			results = append(results, candidate)
+			if len(results) == k {
+				return results
+			}
+		}
+
+		// tombstones and filters may hide results, widen the search until it covers the whole graph
+		if ef >= len(h.nodes) {
+			return results
+		}
+		ef *= 2
+	}
+}
+
+// searchLayer runs the best-first search of the HNSW paper on one layer
+// and returns up to ef candidates ordered by their distance
+func (h *hnswIndex) searchLayer(query []float32, entryPoints []hnswCandidate, ef int, level int) []hnswCandidate {
+	visited := make(map[int]bool, ef*4)
+	candidates := &candidateHeap{}
+	results := &candidateHeap{farthestFirst: true}
+
+	for _, ep := range entryPoints {
+		visited[ep.node] = true
+		heap.Push(candidates, ep)
+		heap.Push(results, ep)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && current.distance > results.items[0].distance {
+			break
+		}
+
+		node := h.nodes[current.node]
+		if level >= len(node.neighbors) {
+			continue
+		}
+
+		for _, neighbor := range node.neighbors[level] {
+			if visited[neighbor] {
+				continue
+			}
+			visited[neighbor] = true
+
+			distance := h.distance(query, neighbor)
+			if results.Len() < ef || distance < results.items[0].distance {
+				heap.Push(candidates, hnswCandidate{node: neighbor, distance: distance})
+				heap.Push(results, hnswCandidate{node: neighbor, distance: distance})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sorted := results.items
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].distance < sorted[j].distance
+	})
+
+	return sorted
+}
+
+// link adds target to the neighbours of node on the level and prunes the list to the closest ones
+func (h *hnswIndex) link(node int, target int, level int) {
+	neighbors := append(h.nodes[node].neighbors[level], target)
+
+	maxNeighbors := h.m
+	if level == 0 {
+		maxNeighbors = h.mMax0
+	}
+
+	if len(neighbors) > maxNeighbors {
+		candidates := make([]hnswCandidate, len(neighbors))
+		for i, neighbor := range neighbors {
+			candidates[i] = hnswCandidate{node: neighbor, distance: h.distance(h.nodes[node].vector, neighbor)}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].distance < candidates[j].distance
+		})
+		neighbors = h.closest(candidates, maxNeighbors)
+	}
+
+	h.nodes[node].neighbors[level] = neighbors
+}
+
+// closest returns the node indexes of the first n candidates, which are sorted by distance
+func (h *hnswIndex) closest(candidates []hnswCandidate, n int) []int {
+	n = min(n, len(candidates))
+
+	nodes := make([]int, n)
+	for i := 0; i < n; i++ {
+		nodes[i] = candidates[i].node
+	}
+	return nodes
+}
+
+// distance returns the cosine distance between the query and the vector of the node
+func (h *hnswIndex) distance(query []float32, node int) float32 {
+	return 1 - dot(query, h.nodes[node].vector)
+}
+
+// candidateHeap is a heap of candidates, closest first unless farthestFirst is set
+type candidateHeap struct {
+	items         []hnswCandidate
+	farthestFirst bool
+}
+
+func (ch candidateHeap) Len() int { return len(ch.items) }
+
+func (ch candidateHeap) Less(i, j int) bool {
+	if ch.farthestFirst {
+		return ch.items[i].distance > ch.items[j].distance
+	}
+	return ch.items[i].distance < ch.items[j].distance
+}
+
+func (ch candidateHeap) Swap(i, j int) { ch.items[i], ch.items[j] = ch.items[j], ch.items[i] }
+
+func (ch *candidateHeap) Push(x any) { ch.items = append(ch.items, x.(hnswCandidate)) }
+
+func (ch *candidateHeap) Pop() any {
+	last := ch.items[len(ch.items)-1]
+	ch.items = ch.items[:len(ch.items)-1]
+	return last
+}
@@ -0,0 +1,463 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"rag-pipeline/models"
+	"rag-pipeline/utils"
+	"sort"
+	"sync"
+)
+
+const (
+	localCollectionFile = "collection.json"
+	localPointsFile     = "points.jsonl"
+)
+
+// LocalDatabase is an embedded vector store that keeps the collection in a local
+// directory and answers queries with an in-memory HNSW index. Every change is
+// appended to a points log, which is replayed and compacted when the collection is opened
+type LocalDatabase struct {
+	CollectionName string
+	Dir            string
+
+	mu         sync.RWMutex
+	loaded     bool
+	vectorSize uint64
+	points     map[string]localPoint
+	index      *hnswIndex
+	logEntries int // entries in the points log, live or not
+	logFile    *os.File
+
+	m              int
+	efConstruction int
+	efSearch       int
+}
+
+type localPoint struct {
+	Vector  []float32      `json:"vector"` // normalized to unit length
+	Payload map[string]any `json:"payload"`
+}
+
+type localCollection struct {
+	Name       string `json:"name"`
+	VectorSize uint64 `json:"vectorSize"`
+}
+
+// localLogEntry is one line of the points log
+type localLogEntry struct {
+	Op    string      `json:"op"` // "upsert" or "delete"
+	ID    string      `json:"id"`
+	Point *localPoint `json:"point,omitempty"`
+}
+
+// NewLocalDatabase creates a LocalDatabase that stores the collection under dir/collectionName
+func NewLocalDatabase(dir string, collectionName string, m int, efConstruction int, efSearch int) (*LocalDatabase, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("local_database: a storage directory is required")
+	}
+
+	ldb := &LocalDatabase{
+		CollectionName: collectionName,
+		Dir:            filepath.Join(dir, collectionName),
+		m:              m,
+		efConstruction: efConstruction,
+		efSearch:       efSearch,
+	}
+
+	exists, err := ldb.CollectionExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		ldb.mu.Lock()
+		defer ldb.mu.Unlock()
+
+		if err := ldb.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ldb, nil
+}
+
+func (ldb *LocalDatabase) CollectionExists() (bool, error) {
+	_, err := os.Stat(filepath.Join(ldb.Dir, localCollectionFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("local_database: %w", err)
+	}
+	return true, nil
+}
+
+// CreateCollection creates the collection directory for vectors of the given size
+func (ldb *LocalDatabase) CreateCollection(vectorSize uint64) error {
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+
+	if exists, _ := ldb.CollectionExists(); exists {
+		return fmt.Errorf("local_database: collection %s already exists", ldb.CollectionName)
+	}
+
+	if err := os.MkdirAll(ldb.Dir, 0o755); err != nil {
+		return fmt.Errorf("local_database: failed to create %s: %w", ldb.Dir, err)
+	}
+
+	data, err := json.Marshal(localCollection{Name: ldb.CollectionName, VectorSize: vectorSize})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(ldb.Dir, localCollectionFile), data); err != nil {
+		return fmt.Errorf("local_database: failed to write collection file: %w", err)
+	}
+
+	log.Println("Collection created: ", ldb.CollectionName)
+	return ldb.load()
+}
+
+// Upsert adds the given chunks and their corresponding embeddings to the collection
+func (ldb *LocalDatabase) Upsert(chunks []models.Chunk, embeddings [][]float32) error {
+	if len(chunks) != len(embeddings) {
+		return fmt.Errorf("local_database: got %d chunks but %d embeddings", len(chunks), len(embeddings))
+	}
+
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+
+	if !ldb.loaded {
+		return fmt.Errorf("local_database: collection %s does not exist", ldb.CollectionName)
+	}
+
+	entries := make([]localLogEntry, len(chunks))
+	for i, chunk := range chunks {
+		if uint64(len(embeddings[i])) != ldb.vectorSize {
+			return fmt.Errorf("local_database: chunk %d has vector size %d, expected %d", chunk.ID, len(embeddings[i]), ldb.vectorSize)
+		}
+
+		entries[i] = localLogEntry{
+			Op: "upsert",
+			ID: utils.NewPointUUID(chunk.DocumentID, chunk.ID),
+			Point: &localPoint{
+				Vector:  normalize(embeddings[i]),
+				Payload: chunkPayload(chunk),
+			},
+		}
+	}
+
+	// the log is written first, so the on-disk state is never behind the index
+	if err := ldb.appendLog(entries); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		ldb.apply(entry)
+	}
+
+	// every replaced point leaves a tombstone in the graph, re-ingesting a document must not grow it
+	if ldb.index.needsRebuild() {
+		ldb.rebuildIndex()
+	}
+
+	return ldb.compactIfNeeded()
+}
+
+// Query returns the limit points matching the filter closest to the query embedding found by the HNSW index
+func (ldb *LocalDatabase) Query(queryEmbedding []float32, limit uint64, filter models.PayloadFilter) ([]models.RetrievalResult, error) {
+	ldb.mu.RLock()
+	defer ldb.mu.RUnlock()
+
+	if !ldb.loaded {
+		return nil, fmt.Errorf("local_database: collection %s does not exist", ldb.CollectionName)
+	}
+
+	if uint64(len(queryEmbedding)) != ldb.vectorSize {
+		return nil, fmt.Errorf("local_database: query has vector size %d, expected %d", len(queryEmbedding), ldb.vectorSize)
+	}
+
+	var accept func(id string) bool
+	if len(filter) > 0 {
+		accept = func(id string) bool {
+			return matchesFilter(ldb.points[id].Payload, filter)
+		}
+	}
+
+	candidates := ldb.index.search(normalize(queryEmbedding), int(limit), accept)
+
+	results := make([]models.RetrievalResult, 0, len(candidates))
+	for _, candidate := range candidates {
+		id := ldb.index.nodes[candidate.node].id
+		results = append(results, retrievalResult(ldb.points[id].Payload, 1-candidate.distance))
+	}
+
+	return results, nil
+}
+
+// Get returns the points of the document with the given chunk ids
+func (ldb *LocalDatabase) Get(documentID string, chunkIDs []int) ([]models.RetrievalResult, error) {
+	ldb.mu.RLock()
+	defer ldb.mu.RUnlock()
+
+	if !ldb.loaded {
+		return nil, fmt.Errorf("local_database: collection %s does not exist", ldb.CollectionName)
+	}
+
+	var results []models.RetrievalResult
+	for _, chunkID := range chunkIDs {
+		if point, ok := ldb.points[utils.NewPointUUID(documentID, chunkID)]; ok {
+			results = append(results, retrievalResult(point.Payload, 0))
+		}
+	}
+
+	return results, nil
+}
+
+// Delete removes every point whose payload matches the filter
+func (ldb *LocalDatabase) Delete(filter models.PayloadFilter) error {
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+
+	if !ldb.loaded {
+		return fmt.Errorf("local_database: collection %s does not exist", ldb.CollectionName)
+	}
+
+	var entries []localLogEntry
+	for id, point := range ldb.points {
+		if matchesFilter(point.Payload, filter) {
+			entries = append(entries, localLogEntry{Op: "delete", ID: id})
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := ldb.appendLog(entries); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		ldb.apply(entry)
+	}
+
+	if ldb.index.needsRebuild() {
+		ldb.rebuildIndex()
+	}
+
+	return ldb.compactIfNeeded()
+}
+
+// DeleteCollection removes the collection directory with all of its points
+func (ldb *LocalDatabase) DeleteCollection() error {
+	ldb.mu.Lock()
+	defer ldb.mu.Unlock()
+
+	if ldb.logFile != nil {
+		ldb.logFile.Close()
+		ldb.logFile = nil
+	}
+
+	ldb.loaded = false
+	ldb.points = nil
+	ldb.index = nil
+
+	return os.RemoveAll(ldb.Dir)
+}
+
+// load reads the collection file, replays the points log, compacts it and
+// builds the index. The caller must hold the write lock
+func (ldb *LocalDatabase) load() error {
+	data, err := os.ReadFile(filepath.Join(ldb.Dir, localCollectionFile))
+	if err != nil {
+		return fmt.Errorf("local_database: failed to read collection file: %w", err)
+	}
+
+	var collection localCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return fmt.Errorf("local_database: failed to parse collection file: %w", err)
+	}
+
+	ldb.vectorSize = collection.VectorSize
+	ldb.points = make(map[string]localPoint)
+
+	if err := ldb.replayLog(); err != nil {
+		return err
+	}
+
+	if err := ldb.compactLog(); err != nil {
+		return err
+	}
+
+	ldb.rebuildIndex()
+	ldb.loaded = true
+
+	log.Printf("local_database: collection %s loaded with %d points", ldb.CollectionName, len(ldb.points))
+	return nil
+}
+
+// replayLog applies every entry of the points log to the points map
+func (ldb *LocalDatabase) replayLog() error {
+	file, err := os.Open(filepath.Join(ldb.Dir, localPointsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("local_database: failed to open points log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && err == nil {
+			var entry localLogEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return fmt.Errorf("local_database: corrupt points log: %w", err)
+			}
+			ldb.applyToPoints(entry)
+		}
+
+		// a last line without newline is a write interrupted by a crash, it is dropped
+		if err != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// compactLog rewrites the points log with only the live points and opens it for appending
+func (ldb *LocalDatabase) compactLog() error {
+	if ldb.logFile != nil {
+		ldb.logFile.Close()
+		ldb.logFile = nil
+	}
+
+	// stable order keeps the rebuilt graph the same between restarts
+	ids := make([]string, 0, len(ldb.points))
+	for id := range ldb.points {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	tmpPath := filepath.Join(ldb.Dir, localPointsFile+".tmp")
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("local_database: failed to compact points log: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmpFile)
+	encoder := json.NewEncoder(writer)
+	for _, id := range ids {
+		point := ldb.points[id]
+		if err := encoder.Encode(localLogEntry{Op: "upsert", ID: id, Point: &point}); err != nil {
+			tmpFile.Close()
+			return fmt.Errorf("local_database: failed to compact points log: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("local_database: failed to compact points log: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("local_database: failed to compact points log: %w", err)
+	}
+	tmpFile.Close()
+
+	pointsPath := filepath.Join(ldb.Dir, localPointsFile)
+	if err := os.Rename(tmpPath, pointsPath); err != nil {
+		return fmt.Errorf("local_database: failed to compact points log: %w", err)
+	}
+
+	ldb.logFile, err = os.OpenFile(pointsPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("local_database: failed to open points log: %w", err)
+	}
+	ldb.logEntries = len(ids)
+
+	return nil
+}
+
+// compactIfNeeded compacts the points log once it is mostly made of replaced or deleted points
+func (ldb *LocalDatabase) compactIfNeeded() error {
+	if ldb.logEntries < 2*len(ldb.points)+1024 {
+		return nil
+	}
+	return ldb.compactLog()
+}
+
+// appendLog writes the entries to the points log and syncs it to disk
+func (ldb *LocalDatabase) appendLog(entries []localLogEntry) error {
+	writer := bufio.NewWriter(ldb.logFile)
+	encoder := json.NewEncoder(writer)
+
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("local_database: failed to write points log: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("local_database: failed to write points log: %w", err)
+	}
+	if err := ldb.logFile.Sync(); err != nil {
+		return fmt.Errorf("local_database: failed to sync points log: %w", err)
+	}
+
+	ldb.logEntries += len(entries)
+	return nil
+}
+
+// apply applies a log entry to the points map and the index
+func (ldb *LocalDatabase) apply(entry localLogEntry) {
+	ldb.applyToPoints(entry)
+
+	switch entry.Op {
+	case "upsert":
+		ldb.index.insert(entry.ID, entry.Point.Vector)
+	case "delete":
+		ldb.index.remove(entry.ID)
+	}
+}
+
+// applyToPoints applies a log entry to the points map only
+func (ldb *LocalDatabase) applyToPoints(entry localLogEntry) {
+	switch entry.Op {
+	case "upsert":
+		if entry.Point != nil {
+			ldb.points[entry.ID] = *entry.Point
+		}
+	case "delete":
+		delete(ldb.points, entry.ID)
+	}
+}
+
+// rebuildIndex builds a new HNSW index from the live points
+func (ldb *LocalDatabase) rebuildIndex() {
+	ids := make([]string, 0, len(ldb.points))
+	for id := range ldb.points {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	ldb.index = newHNSWIndex(ldb.m, ldb.efConstruction, ldb.efSearch)
+	for _, id := range ids {
+		ldb.index.insert(id, ldb.points[id].Vector)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to path
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"math/rand"
+	"rag-pipeline/models"
+	"rag-pipeline/utils"
+	"testing"
+)
+
+func TestLocalDatabasePersistence(t *testing.T) {
+	dir := t.TempDir()
+
+	ldb, err := NewLocalDatabase(dir, "test_collection", 8, 50, 20)
+	if err != nil {
+		t.Fatalf("NewLocalDatabase failed: %v", err)
+	}
+	if err := ldb.CreateCollection(2); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+
+	chunks := []models.Chunk{
+		{ID: 0, Text: "east", DocumentID: "doc-a"},
+		{ID: 1, Text: "north", DocumentID: "doc-a", Span: &models.Span{StartOffset: 5, EndOffset: 10, StartLine: 2, EndLine: 2}},
+		{ID: 0, Text: "west", DocumentID: "doc-b"},
+	}
+	if err := ldb.Upsert(chunks, [][]float32{{1, 0}, {0, 1}, {-1, 0}}); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	if err := ldb.Delete(models.PayloadFilter{"document_id": "doc-b"}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	// reopen the collection from disk
+	reopened, err := NewLocalDatabase(dir, "test_collection", 8, 50, 20)
+	if err != nil {
+		t.Fatalf("NewLocalDatabase failed on reopen: %v", err)
+	}
+	if exists, _ := reopened.CollectionExists(); !exists {
+		t.Fatal("Expected the collection to exist after reopen")
+	}
+
+	results, err := reopened.Query([]float32{0.2, 1}, 10, nil)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 points after reopen, got %d", len(results))
+	}
+	if results[0].Text != "north" || results[0].ChunkID != 1 || results[0].DocumentID != "doc-a" {
+		t.Errorf("Expected chunk 1 'north' of doc-a first, got %+v", results[0])
+	}
+	if span := results[0].Span; span == nil || *span != (models.Span{StartOffset: 5, EndOffset: 10, StartLine: 2, EndLine: 2}) {
+		t.Errorf("Expected the span of chunk 1 to survive the reopen, got %+v", span)
+	}
+	if results[1].Span != nil || results[1].Metadata["start_offset"] != nil {
+		t.Errorf("Expected no span for chunk 0, got %+v", results[1])
+	}
+
+	if err := reopened.DeleteCollection(); err != nil {
+		t.Fatalf("DeleteCollection failed: %v", err)
+	}
+	if exists, _ := reopened.CollectionExists(); exists {
+		t.Error("Expected the collection to be gone after DeleteCollection")
+	}
+}
+
+func TestLocalDatabaseReupsert(t *testing.T) {
+	ldb, err := NewLocalDatabase(t.TempDir(), "test_collection", 8, 50, 20)
+	if err != nil {
+		t.Fatalf("NewLocalDatabase failed: %v", err)
+	}
+	if err := ldb.CreateCollection(2); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+
+	// ingesting the same document again replaces its points, the tombstones are rebuilt away
+	chunks := []models.Chunk{{ID: 0, Text: "east", DocumentID: "doc-a"}, {ID: 1, Text: "north", DocumentID: "doc-a"}}
+	for range 10 {
+		if err := ldb.Upsert(chunks, [][]float32{{1, 0}, {0, 1}}); err != nil {
+			t.Fatalf("Upsert failed: %v", err)
+		}
+	}
+	if nodes := len(ldb.index.nodes); nodes > 2*len(chunks) {
+		t.Errorf("Expected at most %d graph nodes after re-upserts, got %d", 2*len(chunks), nodes)
+	}
+
+	results, err := ldb.Query([]float32{1, 0}, 10, nil)
+	if err != nil || len(results) != 2 || results[0].Text != "east" {
+		t.Errorf("Expected the 2 points with east first, got %+v, %v", results, err)
+	}
+
+	var config models.Config
+	config.VectorStore = "local"
+	if _, err := NewVectorStore(&config, "test_collection"); err == nil {
+		t.Error("Expected an error for the local store without storage.data_dir")
+	}
+}
+
+func TestHNSWIndexRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	index := newHNSWIndex(16, 200, 64)
+	brute := NewMemoryDatabase("brute")
+	brute.CreateCollection(16)
+
+	var chunks []models.Chunk
+	var vectors [][]float32
+	for i := 0; i < 1000; i++ {
+		vector := make([]float32, 16)
+		for j := range vector {
+			vector[j] = rng.Float32()*2 - 1
+		}
+		chunk := models.Chunk{ID: i, DocumentID: "doc"}
+		chunks = append(chunks, chunk)
+		vectors = append(vectors, vector)
+		index.insert(utils.NewPointUUID(chunk.DocumentID, chunk.ID), normalize(vector))
+	}
+	brute.Upsert(chunks, vectors)
+
+	found := 0
+	for q := 0; q < 50; q++ {
+		query := make([]float32, 16)
+		for j := range query {
+			query[j] = rng.Float32()*2 - 1
+		}
+
+		expected, _ := brute.Query(query, 10, nil)
+		want := make(map[string]bool)
+		for _, result := range expected {
+			want[utils.NewPointUUID("doc", result.ChunkID)] = true
+		}
+
+		for _, candidate := range index.search(normalize(query), 10, nil) {
+			if want[index.nodes[candidate.node].id] {
+				found++
+			}
+		}
+	}
+
+	if recall := float64(found) / 500; recall < 0.9 {
+		t.Errorf("Expected HNSW recall@10 of at least 0.9, got %.2f", recall)
+	}
+}
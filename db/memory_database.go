@@ -0,0 +1,186 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"rag-pipeline/models"
+	"rag-pipeline/utils"
+	"sort"
+	"sync"
+)
+
+// MemoryDatabase is an in-memory vector store that answers queries
+// with a brute-force cosine similarity search. It keeps nothing on disk,
+// so it is meant for tests and small deployments
+type MemoryDatabase struct {
+	CollectionName string
+
+	mu         sync.RWMutex
+	exists     bool
+	vectorSize uint64
+	points     map[string]memoryPoint
+}
+
+type memoryPoint struct {
+	vector  []float32 // normalized to unit length
+	payload map[string]any
+}
+
+// NewMemoryDatabase creates and returns a new MemoryDatabase instance
+func NewMemoryDatabase(collectionName string) *MemoryDatabase {
+	return &MemoryDatabase{
+		CollectionName: collectionName,
+		points:         make(map[string]memoryPoint),
+	}
+}
+
+func (mdb *MemoryDatabase) CollectionExists() (bool, error) {
+	mdb.mu.RLock()
+	defer mdb.mu.RUnlock()
+
+	return mdb.exists, nil
+}
+
+// CreateCollection creates the collection with the given vector size
+func (mdb *MemoryDatabase) CreateCollection(vectorSize uint64) error {
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+
+	if mdb.exists {
+		return fmt.Errorf("memory_database: collection %s already exists", mdb.CollectionName)
+	}
+
+	mdb.exists = true
+	mdb.vectorSize = vectorSize
+	mdb.points = make(map[string]memoryPoint)
+	return nil
+}
+
+// Upsert adds the given chunks and their corresponding embeddings to the collection
+func (mdb *MemoryDatabase) Upsert(chunks []models.Chunk, embeddings [][]float32) error {
+	if len(chunks) != len(embeddings) {
+		return fmt.Errorf("memory_database: got %d chunks but %d embeddings", len(chunks), len(embeddings))
+	}
+
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+
+	if !mdb.exists {
+		return fmt.Errorf("memory_database: collection %s does not exist", mdb.CollectionName)
+	}
+
+	for i, chunk := range chunks {
+		if uint64(len(embeddings[i])) != mdb.vectorSize {
+			return fmt.Errorf("memory_database: chunk %d has vector size %d, expected %d", chunk.ID, len(embeddings[i]), mdb.vectorSize)
+		}
+
+		mdb.points[utils.NewPointUUID(chunk.DocumentID, chunk.ID)] = memoryPoint{
+			vector:  normalize(embeddings[i]),
+			payload: chunkPayload(chunk),
+		}
+	}
+
+	return nil
+}
+
+// Query returns the limit points matching the filter with the highest cosine similarity to the query embedding
+func (mdb *MemoryDatabase) Query(queryEmbedding []float32, limit uint64, filter models.PayloadFilter) ([]models.RetrievalResult, error) {
+	mdb.mu.RLock()
+	defer mdb.mu.RUnlock()
+
+	if !mdb.exists {
+		return nil, fmt.Errorf("memory_database: collection %s does not exist", mdb.CollectionName)
+	}
+
+	if uint64(len(queryEmbedding)) != mdb.vectorSize {
+		return nil, fmt.Errorf("memory_database: query has vector size %d, expected %d", len(queryEmbedding), mdb.vectorSize)
+	}
+
+	query := normalize(queryEmbedding)
+
+	results := make([]models.RetrievalResult, 0, len(mdb.points))
+	for _, point := range mdb.points {
+		if !matchesFilter(point.payload, filter) {
+			continue
+		}
+		results = append(results, retrievalResult(point.payload, dot(query, point.vector)))
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if uint64(len(results)) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// Get returns the points of the document with the given chunk ids
+func (mdb *MemoryDatabase) Get(documentID string, chunkIDs []int) ([]models.RetrievalResult, error) {
+	mdb.mu.RLock()
+	defer mdb.mu.RUnlock()
+
+	var results []models.RetrievalResult
+	for _, chunkID := range chunkIDs {
+		if point, ok := mdb.points[utils.NewPointUUID(documentID, chunkID)]; ok {
+			results = append(results, retrievalResult(point.payload, 0))
+		}
+	}
+
+	return results, nil
+}
+
+// Delete removes every point whose payload matches the filter
+func (mdb *MemoryDatabase) Delete(filter models.PayloadFilter) error {
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+
+	for id, point := range mdb.points {
+		if matchesFilter(point.payload, filter) {
+			delete(mdb.points, id)
+		}
+	}
+
+	return nil
+}
+
+func (mdb *MemoryDatabase) DeleteCollection() error {
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+
+	mdb.exists = false
+	mdb.points = make(map[string]memoryPoint)
+	return nil
+}
+
+// normalize returns a copy of the vector scaled to unit length,
+// so the cosine similarity becomes a dot product
+func normalize(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	norm = math.Sqrt(norm)
+
+	normalized := make([]float32, len(vector))
+	if norm == 0 {
+		return normalized
+	}
+
+	for i, v := range vector {
+		normalized[i] = float32(float64(v) / norm)
+	}
+
+	return normalized
+}
+
+// dot returns the dot product of two vectors of the same size
+func dot(a []float32, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"rag-pipeline/models"
+	"testing"
+)
+
+func TestMemoryDatabaseQuery(t *testing.T) {
+	mdb := NewMemoryDatabase("test_collection")
+
+	if err := mdb.CreateCollection(2); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+
+	chunks := []models.Chunk{
+		{ID: 0, Text: "east", DocumentID: "doc-a"},
+		{ID: 1, Text: "north", DocumentID: "doc-a"},
+		{ID: 0, Text: "north east", DocumentID: "doc-b", Metadata: map[string]any{"filename": "b.txt"}},
+	}
+	embeddings := [][]float32{{1, 0}, {0, 1}, {1, 1}}
+
+	if err := mdb.Upsert(chunks, embeddings); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+
+	results, err := mdb.Query([]float32{0.9, 1}, 2, nil)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].DocumentID != "doc-b" || results[0].Text != "north east" {
+		t.Errorf("Expected 'north east' of doc-b first, got %q of %s", results[0].Text, results[0].DocumentID)
+	}
+	if results[0].Metadata["filename"] != "b.txt" {
+		t.Errorf("Expected metadata filename 'b.txt', got '%v'", results[0].Metadata["filename"])
+	}
+	if results[1].Text != "north" {
+		t.Errorf("Expected 'north' second, got %q", results[1].Text)
+	}
+}
+
+func TestMemoryDatabaseUpsertAndDelete(t *testing.T) {
+	mdb := NewMemoryDatabase("test_collection")
+
+	if err := mdb.CreateCollection(2); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+
+	chunks := []models.Chunk{
+		{ID: 0, Text: "first", DocumentID: "doc-a"},
+		{ID: 0, Text: "second", DocumentID: "doc-b"},
+	}
+	embeddings := [][]float32{{1, 0}, {0, 1}}
+
+	// storing the same chunks twice must not duplicate them
+	for i := 0; i < 2; i++ {
+		if err := mdb.Upsert(chunks, embeddings); err != nil {
+			t.Fatalf("Upsert failed: %v", err)
+		}
+	}
+
+	results, _ := mdb.Query([]float32{1, 0}, 10, nil)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 points after re-upload, got %d", len(results))
+	}
+
+	if err := mdb.Delete(models.PayloadFilter{"document_id": "doc-a"}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	results, _ = mdb.Query([]float32{1, 0}, 10, nil)
+	if len(results) != 1 || results[0].DocumentID != "doc-b" {
+		t.Errorf("Expected only doc-b to remain, got %+v", results)
+	}
+}
+
+func TestMemoryDatabaseQueryFilter(t *testing.T) {
+	mdb := NewMemoryDatabase("test_collection")
+
+	if err := mdb.CreateCollection(2); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+
+	chunks := []models.Chunk{
+		{ID: 0, Text: "func Greet", DocumentID: "doc", Metadata: map[string]any{"symbol": "Greet"}},
+		{ID: 1, Text: "var block", DocumentID: "doc", Metadata: map[string]any{"symbol": []any{"count", "name"}}},
+		{ID: 2, Text: "func helper", DocumentID: "doc", Metadata: map[string]any{"symbol": "helper"}},
+	}
+	if err := mdb.Upsert(chunks, [][]float32{{1, 0}, {0, 1}, {1, 1}}); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+
+	results, err := mdb.Query([]float32{1, 0}, 10, models.PayloadFilter{"symbol": "helper"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Text != "func helper" {
+		t.Errorf("Expected only 'func helper', got %+v", results)
+	}
+
+	// a list value matches any of its elements
+	results, _ = mdb.Query([]float32{1, 0}, 10, models.PayloadFilter{"symbol": "name"})
+	if len(results) != 1 || results[0].Text != "var block" {
+		t.Errorf("Expected only 'var block', got %+v", results)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"rag-pipeline/models"
+	"rag-pipeline/utils"
 
 	"github.com/qdrant/go-client/qdrant"
 )
@@ -37,8 +38,8 @@ func (qdb *QdrantDatabase) CollectionExists() (bool, error) {
 	return qdb.Client.CollectionExists(context.Background(), qdb.CollectionName)
 }
 
-// CreateQdrantCollection creates a new collection in Qdrant with the collectionName and vector size
-func (qdb *QdrantDatabase) CreateQdrantCollection(vectorSize uint64) error {
+// CreateCollection creates a new collection in Qdrant with the collectionName and vector size
+func (qdb *QdrantDatabase) CreateCollection(vectorSize uint64) error {
 	err := qdb.Client.CreateCollection(context.Background(), &qdrant.CreateCollection{
 		CollectionName: qdb.CollectionName,
 		VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
@@ -55,19 +56,23 @@ func (qdb *QdrantDatabase) CreateQdrantCollection(vectorSize uint64) error {
 	return nil
 }
 
-// AddVectorsToQdrant adds the given chunks and their corresponding embeddings to the collection
-func (qdb *QdrantDatabase) AddVectorsToQdrant(chunks []models.Chunk, embeddings [][]float32) error {
+// Upsert adds the given chunks and their corresponding embeddings to the collection.
+// Point IDs are derived from the document ID and the chunk ID, so storing the same
+// document again overwrites its own points and a different document is appended.
+func (qdb *QdrantDatabase) Upsert(chunks []models.Chunk, embeddings [][]float32) error {
 
 	var points []*qdrant.PointStruct
 
 	for i := 0; i < len(chunks); i++ {
+		payload, err := qdrant.TryValueMap(chunkPayload(chunks[i]))
+		if err != nil {
+			return fmt.Errorf("qdrant_database: invalid payload for chunk %d: %w", chunks[i].ID, err)
+		}
+
 		points = append(points, &qdrant.PointStruct{
-			Id:      qdrant.NewIDNum(uint64(i)),
+			Id:      qdrant.NewIDUUID(utils.NewPointUUID(chunks[i].DocumentID, chunks[i].ID)),
 			Vectors: qdrant.NewVectors(embeddings[i]...),
-			Payload: qdrant.NewValueMap(map[string]any{
-				"id":   chunks[i].ID,
-				"text": chunks[i].Text,
-			}),
+			Payload: payload,
 		})
 	}
 
@@ -84,22 +89,66 @@ func (qdb *QdrantDatabase) AddVectorsToQdrant(chunks []models.Chunk, embeddings
 	return nil
 }
 
-func (qdb *QdrantDatabase) QueryQdrant(queryEmbedding []float32, limit uint64) ([]*qdrant.ScoredPoint, error) {
-
-	searchResult, err := qdb.Client.Query(
-		context.Background(),
-		&qdrant.QueryPoints{
-			CollectionName: qdb.CollectionName,
-			Query:          qdrant.NewQuery(queryEmbedding...),
-			Limit:          &limit,
-			WithPayload:    qdrant.NewWithPayload(true),
-		},
-	)
+// Query returns the limit points matching the filter most similar to the query embedding
+func (qdb *QdrantDatabase) Query(queryEmbedding []float32, limit uint64, filter models.PayloadFilter) ([]models.RetrievalResult, error) {
+	query := &qdrant.QueryPoints{
+		CollectionName: qdb.CollectionName,
+		Query:          qdrant.NewQuery(queryEmbedding...),
+		Limit:          &limit,
+		WithPayload:    qdrant.NewWithPayload(true),
+	}
+	if len(filter) > 0 {
+		query.Filter = qdrantFilter(filter)
+	}
+
+	searchResult, err := qdb.Client.Query(context.Background(), query)
 	if err != nil {
 		return nil, fmt.Errorf("qdrant_database: failed to query Qdrant: %w", err)
 	}
 
-	return searchResult, nil
+	results := make([]models.RetrievalResult, 0, len(searchResult))
+	for _, point := range searchResult {
+		results = append(results, retrievalResult(payloadToMap(point.Payload), point.Score))
+	}
+
+	return results, nil
+}
+
+// Get returns the points of the document with the given chunk ids, the point ids are derived from them
+func (qdb *QdrantDatabase) Get(documentID string, chunkIDs []int) ([]models.RetrievalResult, error) {
+	ids := make([]*qdrant.PointId, len(chunkIDs))
+	for i, chunkID := range chunkIDs {
+		ids[i] = qdrant.NewIDUUID(utils.NewPointUUID(documentID, chunkID))
+	}
+
+	points, err := qdb.Client.Get(context.Background(), &qdrant.GetPoints{
+		CollectionName: qdb.CollectionName,
+		Ids:            ids,
+		WithPayload:    qdrant.NewWithPayload(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("qdrant_database: failed to get points: %w", err)
+	}
+
+	results := make([]models.RetrievalResult, 0, len(points))
+	for _, point := range points {
+		results = append(results, retrievalResult(payloadToMap(point.Payload), 0))
+	}
+
+	return results, nil
+}
+
+// Delete deletes every point whose payload matches the filter
+func (qdb *QdrantDatabase) Delete(filter models.PayloadFilter) error {
+	_, err := qdb.Client.Delete(context.Background(), &qdrant.DeletePoints{
+		CollectionName: qdb.CollectionName,
+		Points:         qdrant.NewPointsSelectorFilter(qdrantFilter(filter)),
+	})
+	if err != nil {
+		return fmt.Errorf("qdrant_database: failed to delete points: %w", err)
+	}
+
+	return nil
 }
 
 func (qdb *QdrantDatabase) DeleteCollection() error {
@@ -113,3 +162,76 @@ func newQdrantClient(qdrantHost string, qdrantPort int) (*qdrant.Client, error)
 		Port: qdrantPort,
 	})
 }
+
+// qdrantFilter converts the payload filter into Qdrant conditions by the rules of filterTerms, so it
+// matches the points matchesFilter matches. A fractional number is matched by a range of itself
+// since Qdrant only matches whole numbers, a list by a nested filter that needs one of its terms
+func qdrantFilter(filter models.PayloadFilter) *qdrant.Filter {
+	var conditions []*qdrant.Condition
+
+	for key, value := range filter {
+		var terms []*qdrant.Condition
+		for _, term := range filterTerms(value) {
+			terms = append(terms, qdrantCondition(key, term))
+		}
+
+		switch len(terms) {
+		case 0:
+			// an empty list matches no point, like in matchesFilter
+			conditions = append(conditions, qdrant.NewMatchKeywords(key))
+		case 1:
+			conditions = append(conditions, terms[0])
+		default:
+			conditions = append(conditions, qdrant.NewFilterAsCondition(&qdrant.Filter{Should: terms}))
+		}
+	}
+
+	return &qdrant.Filter{Must: conditions}
+}
+
+// qdrantCondition returns the condition that matches a term of filterTerms
+func qdrantCondition(key string, term any) *qdrant.Condition {
+	switch t := term.(type) {
+	case bool:
+		return qdrant.NewMatchBool(key, t)
+	case int64:
+		return qdrant.NewMatchInt(key, t)
+	case float64:
+		return qdrant.NewRange(key, &qdrant.Range{Gte: &t, Lte: &t})
+	default:
+		return qdrant.NewMatch(key, fmt.Sprint(t))
+	}
+}
+
+// payloadToMap converts a Qdrant payload into plain Go values
+func payloadToMap(payload map[string]*qdrant.Value) map[string]any {
+	result := make(map[string]any, len(payload))
+	for key, value := range payload {
+		result[key] = valueToAny(value)
+	}
+	return result
+}
+
+// valueToAny converts a Qdrant value into a plain Go value
+func valueToAny(value *qdrant.Value) any {
+	switch kind := value.GetKind().(type) {
+	case *qdrant.Value_BoolValue:
+		return kind.BoolValue
+	case *qdrant.Value_IntegerValue:
+		return kind.IntegerValue
+	case *qdrant.Value_DoubleValue:
+		return kind.DoubleValue
+	case *qdrant.Value_StringValue:
+		return kind.StringValue
+	case *qdrant.Value_ListValue:
+		list := make([]any, 0, len(kind.ListValue.GetValues()))
+		for _, item := range kind.ListValue.GetValues() {
+			list = append(list, valueToAny(item))
+		}
+		return list
+	case *qdrant.Value_StructValue:
+		return payloadToMap(kind.StructValue.GetFields())
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"rag-pipeline/models"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// filterCases are the filter values matched against single payload values,
+// by the memory and local stores and by the Qdrant filter alike
+var filterCases = []struct {
+	name    string
+	payload any
+	filter  any
+	want    bool
+}{
+	{"equal strings", "pdf", "pdf", true},
+	{"different strings", "pdf", "html", false},
+	{"string against integer", 5, "5", false},
+	{"integer against string", "5", 5, false},
+	{"equal integers", 5, 5, true},
+	{"int64 payload", int64(5), 5, true},
+	{"whole float against integer", 3, 3.0, true},
+	{"fractional float", 2.5, 2.5, true},
+	{"fractional float against integer", 2, 2.5, false},
+	{"bools", true, true, true},
+	{"bool against string", true, "true", false},
+	{"list payload", []any{"a", "b"}, "b", true},
+	{"list payload without the value", []any{"a", "b"}, "c", false},
+	{"list payload of integers", []any{int64(1), int64(2)}, 2.0, true},
+	{"list filter", "pdf", []any{"html", "pdf"}, true},
+	{"mixed list filter", 1, []any{"a", 1.0}, true},
+	{"list filter of strings against integer", 5, []any{"5"}, false},
+	{"empty list filter", "pdf", []any{}, false},
+	{"list payload and list filter", []any{"a", "b"}, []any{"c", "b"}, true},
+}
+
+func TestFilterCases(t *testing.T) {
+	for _, tt := range filterCases {
+		filter := models.PayloadFilter{"field": tt.filter}
+		payload := map[string]any{"field": tt.payload}
+
+		if got := matchesFilter(payload, filter); got != tt.want {
+			t.Errorf("%s: matchesFilter expected %v, got %v", tt.name, tt.want, got)
+		}
+
+		value, err := qdrant.NewValue(tt.payload)
+		if err != nil {
+			t.Fatalf("%s: NewValue failed: %v", tt.name, err)
+		}
+		if got := evalQdrantFilter(qdrantFilter(filter), map[string]*qdrant.Value{"field": value}); got != tt.want {
+			t.Errorf("%s: qdrantFilter expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// evalQdrantFilter evaluates the conditions qdrantFilter builds on a payload like Qdrant does:
+// keywords match strings, integers match integers, ranges match numbers and a list payload
+// matches if one of its elements does
+func evalQdrantFilter(filter *qdrant.Filter, payload map[string]*qdrant.Value) bool {
+	for _, condition := range filter.GetMust() {
+		if !evalQdrantCondition(condition, payload) {
+			return false
+		}
+	}
+	if len(filter.GetShould()) == 0 {
+		return true
+	}
+	for _, condition := range filter.GetShould() {
+		if evalQdrantCondition(condition, payload) {
+			return true
+		}
+	}
+	return false
+}
+
+func evalQdrantCondition(condition *qdrant.Condition, payload map[string]*qdrant.Value) bool {
+	if nested := condition.GetFilter(); nested != nil {
+		return evalQdrantFilter(nested, payload)
+	}
+
+	field := condition.GetField()
+	value, ok := payload[field.GetKey()]
+	if !ok {
+		return false
+	}
+	values := []*qdrant.Value{value}
+	if list := value.GetListValue(); list != nil {
+		values = list.GetValues()
+	}
+
+	for _, value := range values {
+		if evalQdrantField(field, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func evalQdrantField(field *qdrant.FieldCondition, value *qdrant.Value) bool {
+	if r := field.GetRange(); r != nil {
+		var number float64
+		switch kind := value.GetKind().(type) {
+		case *qdrant.Value_IntegerValue:
+			number = float64(kind.IntegerValue)
+		case *qdrant.Value_DoubleValue:
+			number = kind.DoubleValue
+		default:
+			return false
+		}
+		return number >= r.GetGte() && number <= r.GetLte()
+	}
+
+	switch match := field.GetMatch().GetMatchValue().(type) {
+	case *qdrant.Match_Keyword:
+		v, ok := value.GetKind().(*qdrant.Value_StringValue)
+		return ok && v.StringValue == match.Keyword
+	case *qdrant.Match_Integer:
+		v, ok := value.GetKind().(*qdrant.Value_IntegerValue)
+		return ok && v.IntegerValue == match.Integer
+	case *qdrant.Match_Boolean:
+		v, ok := value.GetKind().(*qdrant.Value_BoolValue)
+		return ok && v.BoolValue == match.Boolean
+	case *qdrant.Match_Keywords:
+		v, ok := value.GetKind().(*qdrant.Value_StringValue)
+		if !ok {
+			return false
+		}
+		for _, keyword := range match.Keywords.GetStrings() {
+			if keyword == v.StringValue {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func TestQdrantFilter(t *testing.T) {
+	filter := qdrantFilter(models.PayloadFilter{"page": 3.0})
+	match := filter.Must[0].GetField().GetMatch()
+	if match == nil || match.GetInteger() != 3 {
+		t.Errorf("Expected a whole float to match the integer 3, got %v", filter.Must[0])
+	}
+
+	filter = qdrantFilter(models.PayloadFilter{"score": 2.5})
+	field := filter.Must[0].GetField()
+	if field.GetMatch() != nil || field.GetRange().GetGte() != 2.5 || field.GetRange().GetLte() != 2.5 {
+		t.Errorf("Expected a fractional float to match the range [2.5, 2.5], got %v", filter.Must[0])
+	}
+
+	filter = qdrantFilter(models.PayloadFilter{"format": "pdf"})
+	if keyword := filter.Must[0].GetField().GetMatch().GetKeyword(); keyword != "pdf" {
+		t.Errorf("Expected the keyword pdf, got %v", filter.Must[0])
+	}
+}
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"rag-pipeline/models"
+	"rag-pipeline/utils"
+)
+
+// VectorStore stores the embedded chunks of a single collection
+type VectorStore interface {
+	// CollectionExists reports whether the collection has been created
+	CollectionExists() (bool, error)
+	// CreateCollection creates the collection for vectors of the given size
+	CreateCollection(vectorSize uint64) error
+	// Upsert inserts or replaces the given chunks with their embeddings
+	Upsert(chunks []models.Chunk, embeddings [][]float32) error
+	// Query returns the limit chunks most similar to the query embedding whose payload
+	// matches the filter, a nil filter matches every chunk
+	Query(queryEmbedding []float32, limit uint64, filter models.PayloadFilter) ([]models.RetrievalResult, error)
+	// Get returns the stored chunks of the document with the given chunk ids, missing ids are skipped
+	Get(documentID string, chunkIDs []int) ([]models.RetrievalResult, error)
+	// Delete removes every chunk whose payload matches the filter
+	Delete(filter models.PayloadFilter) error
+	// DeleteCollection removes the collection with all of its chunks
+	DeleteCollection() error
+}
+
+// NewVectorStore creates the vector store selected by config.VectorStore for the collection
+func NewVectorStore(config *models.Config, collectionName string) (VectorStore, error) {
+	switch config.VectorStore {
+	case "", "qdrant":
+		qdrantDB, err := NewQdrantDatabase(config.Qdrant.Host, config.Qdrant.Port, collectionName)
+		if err != nil {
+			return nil, err
+		}
+		return qdrantDB, nil
+	case "memory":
+		return NewMemoryDatabase(collectionName), nil
+	case "local":
+		// an empty data_dir would silently write the vectors into the working directory
+		if config.Storage.DataDir == "" {
+			return nil, fmt.Errorf("vector_store.go|NewVectorStore: storage.data_dir is required for the local vector store")
+		}
+		localDB, err := NewLocalDatabase(
+			filepath.Join(config.Storage.DataDir, "vectors"),
+			collectionName,
+			config.LocalStore.M,
+			config.LocalStore.EfConstruction,
+			config.LocalStore.EfSearch,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return localDB, nil
+	default:
+		return nil, fmt.Errorf("vector_store.go|NewVectorStore: unknown vector store %q", config.VectorStore)
+	}
+}
+
+// chunkPayload builds the payload stored with the chunk: the chunk fields and its metadata
+func chunkPayload(chunk models.Chunk) map[string]any {
+	payload := make(map[string]any, len(chunk.Metadata)+3)
+	for key, value := range chunk.Metadata {
+		payload[key] = value
+	}
+
+	payload["id"] = chunk.ID
+	payload["text"] = chunk.Text
+	payload["document_id"] = chunk.DocumentID
+
+	if chunk.Span != nil {
+		payload["start_offset"] = chunk.Span.StartOffset
+		payload["end_offset"] = chunk.Span.EndOffset
+		payload["start_line"] = chunk.Span.StartLine
+		payload["end_line"] = chunk.Span.EndLine
+	}
+
+	return payload
+}
+
+// retrievalResult converts a stored payload and its score into a models.RetrievalResult
+func retrievalResult(payload map[string]any, score float32) models.RetrievalResult {
+	result := models.RetrievalResult{
+		Score:    score,
+		Metadata: make(map[string]any),
+	}
+
+	for key, value := range payload {
+		switch key {
+		case "id":
+			result.ChunkID = utils.ToInt(value)
+		case "text":
+			result.Text, _ = value.(string)
+		case "document_id":
+			result.DocumentID, _ = value.(string)
+		case "start_offset", "end_offset", "start_line", "end_line":
+			// read below
+		default:
+			result.Metadata[key] = value
+		}
+	}
+
+	if _, ok := payload["start_offset"]; ok {
+		result.Span = &models.Span{
+			StartOffset: utils.ToInt(payload["start_offset"]),
+			EndOffset:   utils.ToInt(payload["end_offset"]),
+			StartLine:   utils.ToInt(payload["start_line"]),
+			EndLine:     utils.ToInt(payload["end_line"]),
+		}
+	}
+
+	return result
+}
+
+// matchesFilter reports whether the payload has all the values of the filter. The values match by
+// the typed rules of filterTerms, which qdrantFilter follows as well: a list payload value matches
+// if one of its elements matches, a list filter value if one of its elements does
+func matchesFilter(payload map[string]any, filter models.PayloadFilter) bool {
+	for key, expected := range filter {
+		value, ok := payload[key]
+		if !ok || !matchesValue(value, filterTerms(expected)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesValue reports whether the payload value or one of its list elements matches one of the terms
+func matchesValue(value any, terms []any) bool {
+	if list, ok := value.([]any); ok {
+		for _, element := range list {
+			if matchesValue(element, terms) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, term := range terms {
+		if matchesTerm(value, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterTerms returns the terms a filter value matches, any of them: the elements of a list,
+// else the value itself. Bools match bools and strings match strings, whole numbers become
+// int64 and match integers, fractional numbers stay float64 and match equal numbers.
+// Other values are matched as their string
+func filterTerms(expected any) []any {
+	switch v := expected.(type) {
+	case []any:
+		var terms []any
+		for _, element := range v {
+			terms = append(terms, filterTerms(element)...)
+		}
+		return terms
+	case bool, string, int64:
+		return []any{v}
+	case int:
+		return []any{int64(v)}
+	case float64:
+		// numbers decoded from JSON are float64, whole ones match the integer payloads
+		if v == math.Trunc(v) {
+			return []any{int64(v)}
+		}
+		return []any{v}
+	default:
+		return []any{fmt.Sprint(v)}
+	}
+}
+
+// matchesTerm reports whether a single payload value matches a term of filterTerms
+func matchesTerm(value any, term any) bool {
+	switch t := term.(type) {
+	case bool:
+		v, ok := value.(bool)
+		return ok && v == t
+	case string:
+		v, ok := value.(string)
+		return ok && v == t
+	case int64:
+		switch v := value.(type) {
+		case int:
+			return int64(v) == t
+		case int64:
+			return v == t
+		case float64:
+			// payloads read back from JSON hold their integers as float64
+			return v == float64(t)
+		}
+		return false
+	case float64:
+		switch v := value.(type) {
+		case int:
+			return float64(v) == t
+		case int64:
+			return float64(v) == t
+		case float64:
+			return v == t
+		}
+		return false
+	default:
+		return false
+	}
+}
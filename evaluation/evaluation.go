@@ -90,7 +90,7 @@ func (eval *Evaluator) prepareEvalData() error {
 		return fmt.Errorf("evaluation.go|failed prepareQdrantDB: %w", err)
 	}
 
-	if err := eval.RAGService.StoreData(text); err != nil {
+	if _, err := eval.RAGService.StoreData(eval.Config.Evaluation.SourceDataPath, []byte(text)); err != nil {
 		return fmt.Errorf("evaluation.go|failed prepareQdrantDB: %w", err)
 	}
 
@@ -49,11 +49,16 @@ func (eval *Evaluator) getGeneratorResponse(qaData []models.QA) ([]models.Genera
 	var evaluationCase []models.GenerationEvaluationCase
 
 	for _, qa := range qaData {
-		generatedAnswer, chunks, err := eval.RAGService.GenerateResponse(qa.Question)
+		generatedAnswer, passages, err := eval.RAGService.GenerateResponse(qa.Question, nil)
 		if err != nil {
 			return nil, fmt.Errorf("generation.go |failed to generate response: %w", err)
 		}
 
+		chunks := make([]string, len(passages))
+		for i, passage := range passages {
+			chunks[i] = passage.Text
+		}
+
 		evaluationCase = append(evaluationCase, models.GenerationEvaluationCase{
 			Question:        qa.Question,
 			GroundTruth:     qa.Answer,
@@ -17,7 +17,7 @@ func (eval *Evaluator) EvaluateRetrieval(retrievalDataPath string) (*models.Retr
 
 	var testCaseResults []models.RetrievalTestCaseResult
 	for _, data := range evalData {
-		retrievedChunks, err := eval.RAGService.RetrieveRelevantChunks(data.Question, eval.Config.Retrieval.TopK)
+		retrievedChunks, err := eval.RAGService.RetrieveRelevantChunks(data.Question, eval.Config.Retrieval.TopK, nil)
 		if err != nil {
 			return nil, err
 		}
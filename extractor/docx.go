@@ -0,0 +1,271 @@
+package extractor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// docxCoreProperties is docProps/core.xml, the title and author of a DOCX document
+type docxCoreProperties struct {
+	Title   string `xml:"title"`
+	Creator string `xml:"creator"`
+}
+
+// docxReader renders the body of word/document.xml
+type docxReader struct {
+	text          officeText
+	headingLevels map[string]int      // paragraph style id → heading level
+	footnotes     map[string]*xmlNode // footnote id → footnote element
+	footnoteCount int
+}
+
+// ExtractDOCX returns the text of the Word document: paragraphs, headings of the heading styles
+// as Markdown headings, list items, tables with one line per row and the footnotes at the end.
+// The metadata holds the title and author of the document properties
+func ExtractDOCX(content []byte) (string, map[string]any, error) {
+	files, err := openZip(content)
+	if err != nil {
+		return "", nil, fmt.Errorf("docx.go|ExtractDOCX: %w", err)
+	}
+
+	data, err := files.read("word/document.xml")
+	if err != nil {
+		return "", nil, fmt.Errorf("docx.go|ExtractDOCX: %w", err)
+	}
+	document, err := parseXMLTree(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("docx.go|ExtractDOCX: failed to parse word/document.xml: %w", err)
+	}
+
+	reader := &docxReader{
+		headingLevels: docxHeadingLevels(files),
+		footnotes:     docxFootnotes(files),
+	}
+	if body := document.find("body"); body != nil {
+		reader.block(body)
+	}
+
+	var properties docxCoreProperties
+	_ = files.readXML("docProps/core.xml", &properties) // the properties are optional
+
+	return officeResult("docx.go|ExtractDOCX", &reader.text, properties.Title, properties.Creator)
+}
+
+// block renders the paragraphs and tables of the element
+func (d *docxReader) block(n *xmlNode) {
+	for _, child := range n.children {
+		switch child.name {
+		case "p":
+			d.paragraph(child)
+		case "tbl":
+			d.table(child)
+		case "sectPr":
+		default:
+			d.block(child) // content controls, inserted revisions, ...
+		}
+	}
+}
+
+// paragraph renders the paragraph as a heading, a list item or a plain paragraph
+func (d *docxReader) paragraph(p *xmlNode) {
+	text := d.inline(p)
+	properties := p.child("pPr")
+	if properties == nil {
+		d.text.paragraph(text)
+		return
+	}
+
+	if level := d.headingLevel(properties); level > 0 {
+		d.text.heading(text, level)
+		return
+	}
+
+	if numbering := properties.child("numPr"); numbering != nil {
+		depth := 0
+		if ilvl := numbering.child("ilvl"); ilvl != nil {
+			depth, _ = strconv.Atoi(ilvl.attrs["val"])
+		}
+		d.text.listItem(text, depth)
+		return
+	}
+
+	d.text.paragraph(text)
+}
+
+// headingLevel returns the heading level of the paragraph properties, 0 for body text
+func (d *docxReader) headingLevel(properties *xmlNode) int {
+	if outline := properties.child("outlineLvl"); outline != nil {
+		return outlineLevel(outline)
+	}
+
+	style := properties.child("pStyle")
+	if style == nil {
+		return 0
+	}
+	if level, ok := d.headingLevels[style.attrs["val"]]; ok {
+		return level
+	}
+	return headingStyleLevel(style.attrs["val"])
+}
+
+// table renders the rows of the table, nested tables become part of their cell
+func (d *docxReader) table(tbl *xmlNode) {
+	var rows [][]string
+	for _, tr := range tbl.children {
+		if tr.name != "tr" {
+			continue
+		}
+		var row []string
+		for _, tc := range tr.children {
+			if tc.name == "tc" {
+				row = append(row, d.cellText(tc))
+			}
+		}
+		rows = append(rows, row)
+	}
+	d.text.table(rows)
+}
+
+// cellText returns the text of all paragraphs in the element
+func (d *docxReader) cellText(n *xmlNode) string {
+	var parts []string
+	for _, child := range n.children {
+		if child.name == "p" {
+			parts = append(parts, d.inline(child))
+		} else if child.name != "tcPr" {
+			parts = append(parts, d.cellText(child))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// inline returns the text of the runs of the element. Footnote references become
+// numbered markers and the footnotes are recorded with the same number
+func (d *docxReader) inline(n *xmlNode) string {
+	var text strings.Builder
+	var walk func(n *xmlNode)
+	walk = func(n *xmlNode) {
+		for _, child := range n.children {
+			switch child.name {
+			case "t":
+				for _, data := range child.children {
+					text.WriteString(data.text)
+				}
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			case "noBreakHyphen":
+				text.WriteString("-")
+			case "footnoteReference":
+				text.WriteString(d.footnoteMarker(child.attrs["id"]))
+			case "pPr", "rPr", "del", "instrText", "fldData":
+				// properties, deleted revisions and field codes have no visible text
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	return text.String()
+}
+
+// footnoteMarker records the footnote with the id and returns its marker
+func (d *docxReader) footnoteMarker(id string) string {
+	footnote, ok := d.footnotes[id]
+	if !ok {
+		return ""
+	}
+
+	d.footnoteCount++
+	marker := fmt.Sprintf("[%d]", d.footnoteCount)
+	d.text.footnote(marker, d.cellText(footnote))
+	return marker
+}
+
+// docxHeadingLevels returns the heading level of the paragraph styles of word/styles.xml,
+// read from their outline level or their name, e.g. "heading 2"
+func docxHeadingLevels(files zipArchive) map[string]int {
+	levels := make(map[string]int)
+
+	data, err := files.read("word/styles.xml")
+	if err != nil {
+		return levels
+	}
+	styles, err := parseXMLTree(data)
+	if err != nil {
+		return levels
+	}
+
+	var walk func(n *xmlNode)
+	walk = func(n *xmlNode) {
+		for _, child := range n.children {
+			if child.name != "style" {
+				walk(child)
+				continue
+			}
+
+			level := 0
+			if outline := child.find("outlineLvl"); outline != nil {
+				level = outlineLevel(outline)
+			} else if name := child.child("name"); name != nil {
+				level = headingStyleLevel(name.attrs["val"])
+			}
+			if level > 0 {
+				levels[child.attrs["styleId"]] = level
+			}
+		}
+	}
+	walk(styles)
+
+	return levels
+}
+
+// docxFootnotes returns the footnotes of word/footnotes.xml by their id,
+// without the separators Word stores as footnotes
+func docxFootnotes(files zipArchive) map[string]*xmlNode {
+	footnotes := make(map[string]*xmlNode)
+
+	data, err := files.read("word/footnotes.xml")
+	if err != nil {
+		return footnotes
+	}
+	root, err := parseXMLTree(data)
+	if err != nil {
+		return footnotes
+	}
+
+	if list := root.find("footnotes"); list != nil {
+		for _, footnote := range list.children {
+			if footnote.name == "footnote" && footnote.attrs["type"] == "" {
+				footnotes[footnote.attrs["id"]] = footnote
+			}
+		}
+	}
+	return footnotes
+}
+
+// outlineLevel returns the heading level of a 0 based outline level, 0 for body text (level 9)
+func outlineLevel(outline *xmlNode) int {
+	level, err := strconv.Atoi(outline.attrs["val"])
+	if err != nil || level < 0 || level > 8 {
+		return 0
+	}
+	return level + 1
+}
+
+// headingStyleLevel returns the level of a built-in heading style name or id,
+// e.g. "heading 2" or "Heading2", the title counts as level 1
+func headingStyleLevel(name string) int {
+	name = strings.ToLower(strings.ReplaceAll(name, " ", ""))
+	if name == "title" {
+		return 1
+	}
+
+	level, err := strconv.Atoi(strings.TrimPrefix(name, "heading"))
+	if !strings.HasPrefix(name, "heading") || err != nil || level < 1 || level > 9 {
+		return 0
+	}
+	return level
+}
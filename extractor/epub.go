@@ -0,0 +1,254 @@
+package extractor
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// epubContainer is META-INF/container.xml, it points to the OPF package document
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage is the OPF package document: the metadata, files and reading order of the book
+type epubPackage struct {
+	Titles   []string `xml:"metadata>title"`
+	Creators []string `xml:"metadata>creator"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc      string `xml:"toc,attr"`
+		Itemrefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+// epubNavPoint is an entry of the EPUB 2 NCX table of contents
+type epubNavPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	NavPoints []epubNavPoint `xml:"navPoint"`
+}
+
+// epubEncryption is META-INF/encryption.xml, it lists the encrypted files of the container
+type epubEncryption struct {
+	EncryptedData []struct {
+		CipherReference struct {
+			URI string `xml:"URI,attr"`
+		} `xml:"CipherData>CipherReference"`
+	} `xml:"EncryptedData"`
+}
+
+// ExtractEPUB returns the text of the chapters of the e-book in the order of its spine,
+// the chapters are separated by PageBreak. The titles of the chapters are taken from the
+// table of contents, or else from their first heading. The metadata holds the title and
+// author of the book
+func ExtractEPUB(content []byte) (text string, chapters []string, metadata map[string]any, err error) {
+	files, err := openZip(content)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("epub.go|ExtractEPUB: %w", err)
+	}
+
+	var container epubContainer
+	if err := files.readXML("META-INF/container.xml", &container); err != nil {
+		return "", nil, nil, fmt.Errorf("epub.go|ExtractEPUB: %w", err)
+	}
+	packagePath := ""
+	for _, rootfile := range container.Rootfiles {
+		if rootfile.MediaType == "" || rootfile.MediaType == "application/oebps-package+xml" {
+			packagePath = rootfile.FullPath
+			break
+		}
+	}
+	if packagePath == "" {
+		return "", nil, nil, errors.New("epub.go|ExtractEPUB: the container has no package document")
+	}
+
+	var opf epubPackage
+	if err := files.readXML(packagePath, &opf); err != nil {
+		return "", nil, nil, fmt.Errorf("epub.go|ExtractEPUB: %w", err)
+	}
+
+	// the paths of the manifest are relative to the package document
+	base := path.Dir(packagePath)
+	hrefs := make(map[string]string, len(opf.Manifest))
+	navPath := ""
+	for _, item := range opf.Manifest {
+		hrefs[item.ID] = resolveEPUBPath(base, item.Href)
+		if strings.Contains(" "+item.Properties+" ", " nav ") {
+			navPath = hrefs[item.ID]
+		}
+	}
+
+	encrypted := encryptedEPUBFiles(files)
+	titles := epubTableOfContents(files, navPath, hrefs[opf.Spine.Toc])
+
+	var texts []string
+	for _, itemref := range opf.Spine.Itemrefs {
+		chapterPath, ok := hrefs[itemref.IDRef]
+		if !ok {
+			continue
+		}
+		if encrypted[chapterPath] {
+			return "", nil, nil, fmt.Errorf("epub.go|ExtractEPUB: %s is encrypted, DRM protected books can not be read", chapterPath)
+		}
+
+		data, err := files.read(chapterPath)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("epub.go|ExtractEPUB: %w", err)
+		}
+
+		chapterText, heading, err := epubChapter(data)
+		if err != nil || chapterText == "" {
+			continue // cover images and other chapters without text
+		}
+
+		title := titles[chapterPath]
+		if title == "" {
+			title = heading
+		}
+		texts = append(texts, chapterText)
+		chapters = append(chapters, title)
+	}
+
+	if len(texts) == 0 {
+		return "", nil, nil, errors.New("epub.go|ExtractEPUB: the EPUB contains no text")
+	}
+
+	metadata = make(map[string]any)
+	if len(opf.Titles) > 0 {
+		if title := strings.Join(strings.Fields(opf.Titles[0]), " "); title != "" {
+			metadata["title"] = title
+		}
+	}
+	var authors []string
+	for _, creator := range opf.Creators {
+		if author := strings.Join(strings.Fields(creator), " "); author != "" {
+			authors = append(authors, author)
+		}
+	}
+	if len(authors) > 0 {
+		metadata["author"] = strings.Join(authors, ", ")
+	}
+
+	return strings.Join(texts, "\n"+PageBreak+"\n"), chapters, metadata, nil
+}
+
+// epubChapter returns the text of an XHTML chapter and its first heading
+func epubChapter(data []byte) (string, string, error) {
+	doc, err := parseHTML(data)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the chapter is the content, its <header> holds the chapter title and is kept
+	renderer := &htmlRenderer{inArticle: 1}
+	renderer.render(contentRoot(doc))
+
+	heading := ""
+	if h := findElement(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.H1 || n.DataAtom == atom.H2 || n.DataAtom == atom.H3
+	}); h != nil {
+		heading = strings.Join(strings.Fields(nodeText(h)), " ")
+	}
+
+	// the chapters are separated by page breaks, so the text of a chapter has none
+	text := strings.ReplaceAll(renderer.out.String(), PageBreak, "\n")
+	return strings.TrimSpace(text), heading, nil
+}
+
+// epubTableOfContents returns the titles of the chapter files, read from the EPUB 3
+// navigation document or else from the EPUB 2 NCX. A file keeps its first title
+func epubTableOfContents(files zipArchive, navPath string, ncxPath string) map[string]string {
+	titles := make(map[string]string)
+	add := func(base string, href string, label string) {
+		label = strings.Join(strings.Fields(label), " ")
+		target := resolveEPUBPath(base, href)
+		if label != "" && titles[target] == "" {
+			titles[target] = label
+		}
+	}
+
+	if data, err := files.read(navPath); err == nil {
+		if doc, err := parseHTML(data); err == nil {
+			toc := findElement(doc, func(n *html.Node) bool {
+				return n.DataAtom == atom.Nav && attribute(n, "epub:type") == "toc"
+			})
+			if toc == nil {
+				toc = findElement(doc, func(n *html.Node) bool { return n.DataAtom == atom.Nav })
+			}
+			if toc != nil {
+				var walk func(n *html.Node)
+				walk = func(n *html.Node) {
+					if n.Type == html.ElementNode && n.DataAtom == atom.A {
+						add(path.Dir(navPath), attribute(n, "href"), nodeText(n))
+					}
+					for child := n.FirstChild; child != nil; child = child.NextSibling {
+						walk(child)
+					}
+				}
+				walk(toc)
+			}
+		}
+	}
+
+	if len(titles) > 0 || ncxPath == "" {
+		return titles
+	}
+
+	var ncx struct {
+		NavPoints []epubNavPoint `xml:"navMap>navPoint"`
+	}
+	if err := files.readXML(ncxPath, &ncx); err != nil {
+		return titles
+	}
+	var walk func(points []epubNavPoint)
+	walk = func(points []epubNavPoint) {
+		for _, point := range points {
+			add(path.Dir(ncxPath), point.Content.Src, point.Label)
+			walk(point.NavPoints)
+		}
+	}
+	walk(ncx.NavPoints)
+
+	return titles
+}
+
+// encryptedEPUBFiles returns the files of the container listed in its encryption.xml
+func encryptedEPUBFiles(files zipArchive) map[string]bool {
+	encrypted := make(map[string]bool)
+
+	var encryption epubEncryption
+	if err := files.readXML("META-INF/encryption.xml", &encryption); err != nil {
+		return encrypted
+	}
+	for _, data := range encryption.EncryptedData {
+		encrypted[resolveEPUBPath("", data.CipherReference.URI)] = true
+	}
+	return encrypted
+}
+
+// resolveEPUBPath returns the container path of the href relative to base, without its fragment
+func resolveEPUBPath(base string, href string) string {
+	href, _, _ = strings.Cut(href, "#")
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return strings.TrimPrefix(path.Join(base, href), "/")
+}
@@ -0,0 +1,105 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// buildZip writes the files into a ZIP container, with a mimetype the uncompressed mimetype file comes first
+func buildZip(mimetype string, files map[string]string, order ...string) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+
+	if mimetype != "" {
+		file, _ := writer.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+		file.Write([]byte(mimetype))
+	}
+
+	for _, name := range order {
+		file, _ := writer.Create(name)
+		file.Write([]byte(files[name]))
+	}
+	writer.Close()
+
+	return buffer.Bytes()
+}
+
+func chapterXHTML(body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>ignored</title></head><body>` +
+		body + `</body></html>`
+}
+
+func TestExtractEPUB(t *testing.T) {
+	files := map[string]string{
+		"META-INF/container.xml": `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+		"OEBPS/content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>The Sheep Book</dc:title>
+    <dc:creator>Ada Shepherd</dc:creator>
+    <dc:creator>Bo Peep</dc:creator>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="text/chapter%202.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c1" href="text/chapter1.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="cover"/><itemref idref="nav" linear="no"/><itemref idref="c1"/><itemref idref="c2"/></spine>
+</package>`,
+		"OEBPS/nav.xhtml": chapterXHTML(`<nav epub:type="toc"><ol>
+  <li><a href="text/chapter1.xhtml#start">Chapter One: Counting</a></li>
+  <li><a href="text/chapter1.xhtml#later">A later section</a></li>
+</ol></nav>`),
+		"OEBPS/cover.xhtml":          chapterXHTML(`<img src="cover.jpg" alt="cover"/>`),
+		"OEBPS/text/chapter1.xhtml":  chapterXHTML(`<header><h1>One</h1></header><p>Sheep are counted.</p>`),
+		"OEBPS/text/chapter 2.xhtml": chapterXHTML(`<section><h2>Two: Sleeping</h2><ul><li>Dream</li></ul></section>`),
+	}
+
+	book := buildZip("application/epub+zip", files, "META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml",
+		"OEBPS/cover.xhtml", "OEBPS/text/chapter1.xhtml", "OEBPS/text/chapter 2.xhtml")
+
+	// the book is detected by its mimetype, not by its file name
+	extracted, err := Extract("upload.bin", book)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	expected := "# One\n\nSheep are counted.\n" + PageBreak + "\n## Two: Sleeping\n\n- Dream"
+	if extracted.Text != expected {
+		t.Errorf("Expected %q, got %q", expected, extracted.Text)
+	}
+
+	// the table of contents names chapter one, chapter two has only its heading
+	if len(extracted.Chapters) != 2 || extracted.Chapters[0] != "Chapter One: Counting" || extracted.Chapters[1] != "Two: Sleeping" {
+		t.Errorf("Unexpected chapters: %q", extracted.Chapters)
+	}
+
+	if extracted.Metadata["title"] != "The Sheep Book" || extracted.Metadata["author"] != "Ada Shepherd, Bo Peep" || extracted.Metadata["format"] != "epub" {
+		t.Errorf("Unexpected metadata: %v", extracted.Metadata)
+	}
+}
+
+func TestExtractEPUBErrors(t *testing.T) {
+	if _, err := Extract("book.epub", []byte("not a zip")); err == nil {
+		t.Error("Expected an error for an EPUB that is not a ZIP container")
+	}
+
+	files := map[string]string{
+		"META-INF/container.xml": `<container><rootfiles><rootfile full-path="content.opf"/></rootfiles></container>`,
+		"content.opf": `<package><manifest><item id="c1" href="c1.xhtml"/></manifest>
+<spine><itemref idref="c1"/></spine></package>`,
+		"META-INF/encryption.xml": `<encryption><EncryptedData><CipherData><CipherReference URI="c1.xhtml"/></CipherData></EncryptedData></encryption>`,
+		"c1.xhtml":                "encrypted bytes",
+	}
+	book := buildZip("application/epub+zip", files, "META-INF/container.xml", "content.opf", "META-INF/encryption.xml", "c1.xhtml")
+
+	if _, err := Extract("book.epub", book); err == nil || !strings.Contains(err.Error(), "encrypted") {
+		t.Errorf("Expected an encrypted error, got %v", err)
+	}
+}
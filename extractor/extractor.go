@@ -0,0 +1,124 @@
+// Package extractor turns uploaded files into the plain text that is chunked
+package extractor
+
+import (
+	"bytes"
+	"path/filepath"
+	"rag-pipeline/models"
+	"strings"
+	"unicode/utf8"
+)
+
+// PageBreak separates the pages of an extracted document
+const PageBreak = "\f"
+
+// Extract returns the text of the file and the metadata found in it, the format is
+// detected from the file name and the content. Unknown formats are read as plain text
+func Extract(filename string, content []byte) (models.ExtractedDocument, error) {
+	return extractFormat(detectFormat(filename, content), content)
+}
+
+// ExtractMediaType is Extract for content of a known media type, e.g. a fetched web page
+// whose URL has no file extension. Other media types are detected like in Extract
+func ExtractMediaType(filename string, mediaType string, content []byte) (models.ExtractedDocument, error) {
+	if format, ok := mediaTypeFormats[strings.ToLower(mediaType)]; ok {
+		return extractFormat(format, content)
+	}
+	return Extract(filename, content)
+}
+
+// SupportedMediaType reports whether ExtractMediaType can read content of the media type
+func SupportedMediaType(mediaType string) bool {
+	mediaType = strings.ToLower(mediaType)
+	_, ok := mediaTypeFormats[mediaType]
+	return ok || strings.HasPrefix(mediaType, "text/")
+}
+
+// mediaTypeFormats are the formats of the media types of the supported documents
+var mediaTypeFormats = map[string]string{
+	"application/pdf":       "pdf",
+	"text/html":             "html",
+	"application/xhtml+xml": "html",
+	"application/epub+zip":  "epub",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "docx",
+	"application/vnd.oasis.opendocument.text":                                 "odt",
+	"text/plain": "text",
+}
+
+// extractFormat returns the text and the metadata of the content in the format
+func extractFormat(format string, content []byte) (models.ExtractedDocument, error) {
+	switch format {
+	case "pdf":
+		text, err := ExtractPDF(content)
+		return extracted(text, format, nil), err
+	case "html":
+		text, metadata, err := ExtractHTML(content)
+		return extracted(text, format, metadata), err
+	case "epub":
+		text, chapters, metadata, err := ExtractEPUB(content)
+		document := extracted(text, format, metadata)
+		document.Chapters = chapters
+		return document, err
+	case "docx":
+		text, metadata, err := ExtractDOCX(content)
+		return extracted(text, format, metadata), err
+	case "odt":
+		text, metadata, err := ExtractODT(content)
+		return extracted(text, format, metadata), err
+	default:
+		return extracted(string(content), format, nil), nil
+	}
+}
+
+// Supported reports whether Extract can read the file: a document format or
+// plain text, which has to be valid UTF-8 without NUL bytes
+func Supported(filename string, content []byte) bool {
+	if detectFormat(filename, content) != "text" {
+		return true
+	}
+	return utf8.Valid(content) && bytes.IndexByte(content, 0) < 0
+}
+
+// IsPlainText reports whether Extract reads the file as plain text, judged by its name and the
+// beginning of its content. A large text file can then be streamed instead of being read whole
+func IsPlainText(filename string, head []byte) bool {
+	if detectFormat(filename, head) != "text" {
+		return false
+	}
+
+	// the head may end in the middle of a rune
+	for i := 0; i < utf8.UTFMax-1 && len(head) > 0 && !utf8.Valid(head); i++ {
+		head = head[:len(head)-1]
+	}
+	return utf8.Valid(head) && bytes.IndexByte(head, 0) < 0
+}
+
+// detectFormat returns the format of the file from its extension or its content, "text" if it is unknown
+func detectFormat(filename string, content []byte) string {
+	extension := strings.ToLower(filepath.Ext(filename))
+
+	switch {
+	case extension == ".pdf" || bytes.HasPrefix(content, []byte("%PDF-")):
+		return "pdf"
+	case extension == ".html" || extension == ".htm" || extension == ".xhtml" || isHTML(content):
+		return "html"
+	case extension == ".epub" || hasZipMimetype(content, "application/epub+zip"):
+		return "epub"
+	case extension == ".docx" || hasZipFile(content, "word/document.xml"):
+		return "docx"
+	case extension == ".odt" || hasZipMimetype(content, "application/vnd.oasis.opendocument.text"):
+		return "odt"
+	default:
+		return "text"
+	}
+}
+
+// extracted returns the ExtractedDocument of the text, its metadata records the format
+func extracted(text string, format string, metadata map[string]any) models.ExtractedDocument {
+	if metadata == nil {
+		metadata = make(map[string]any)
+	}
+	metadata["format"] = format
+
+	return models.ExtractedDocument{Text: text, Metadata: metadata}
+}
@@ -0,0 +1,408 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// boilerplateElements are dropped with their content: scripts, styles and the
+// navigation, footers, sidebars and forms around the content of a page
+var boilerplateElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Footer: true, atom.Aside: true, atom.Form: true,
+	atom.Button: true, atom.Select: true, atom.Iframe: true, atom.Svg: true,
+	atom.Canvas: true, atom.Object: true,
+}
+
+// boilerplateRoles are the ARIA roles of the navigation, banners and footers of a page
+var boilerplateRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "search": true, "complementary": true,
+}
+
+// blockElements start on a new line and are separated from the text around them by a blank line
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Details: true,
+	atom.Dialog: true, atom.Div: true, atom.Dl: true, atom.Dd: true, atom.Dt: true,
+	atom.Fieldset: true, atom.Figure: true, atom.Figcaption: true, atom.Header: true,
+	atom.Hr: true, atom.Main: true, atom.P: true, atom.Section: true, atom.Summary: true,
+	atom.Table: true, atom.Caption: true,
+}
+
+// isHTML reports whether the content starts like an HTML document
+func isHTML(content []byte) bool {
+	start := bytes.ToLower(bytes.TrimSpace(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))))
+	return bytes.HasPrefix(start, []byte("<!doctype html")) || bytes.HasPrefix(start, []byte("<html"))
+}
+
+// ExtractHTML returns the text of the HTML page without its boilerplate. Headings become
+// Markdown headings and list items "- " lines, so the structure survives as text. The
+// metadata holds the <title> and the canonical URL of the page if it has them
+func ExtractHTML(content []byte) (string, map[string]any, error) {
+	doc, err := parseHTML(content)
+	if err != nil {
+		return "", nil, fmt.Errorf("html.go|ExtractHTML: %w", err)
+	}
+
+	metadata := make(map[string]any)
+	if title := htmlTitle(doc); title != "" {
+		metadata["title"] = title
+	}
+	if url := canonicalURL(doc); url != "" {
+		metadata["canonical_url"] = url
+	}
+
+	renderer := &htmlRenderer{}
+	renderer.render(contentRoot(doc))
+
+	text := strings.TrimSpace(renderer.out.String())
+	if text == "" {
+		return "", nil, errors.New("html.go|ExtractHTML: the HTML contains no text")
+	}
+
+	return text, metadata, nil
+}
+
+// ExtractLinks returns the http and https links of the <a> elements of the page, resolved
+// against the URL of the page or its <base> element. Fragments are removed, every link is returned once
+func ExtractLinks(content []byte, page *url.URL) ([]*url.URL, error) {
+	doc, err := parseHTML(content)
+	if err != nil {
+		return nil, fmt.Errorf("html.go|ExtractLinks: failed to parse the page: %w", err)
+	}
+
+	base := page
+	if element := findElement(doc, func(n *html.Node) bool { return n.DataAtom == atom.Base && attribute(n, "href") != "" }); element != nil {
+		if href, err := page.Parse(strings.TrimSpace(attribute(element, "href"))); err == nil {
+			base = href
+		}
+	}
+
+	var links []*url.URL
+	seen := make(map[string]bool)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			if href, ok := attributeValue(n, "href"); ok {
+				if link, err := base.Parse(strings.TrimSpace(href)); err == nil && (link.Scheme == "http" || link.Scheme == "https") {
+					link.Fragment = ""
+					link.RawFragment = ""
+					if !seen[link.String()] {
+						seen[link.String()] = true
+						links = append(links, link)
+					}
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	return links, nil
+}
+
+// parseHTML parses the document, it is decoded from the charset declared in it
+func parseHTML(content []byte) (*html.Node, error) {
+	reader, err := charset.NewReader(bytes.NewReader(content), "text/html")
+	if err != nil {
+		return nil, err
+	}
+	return html.Parse(reader)
+}
+
+// htmlTitle returns the text of the <title> element, or the og:title of the page
+func htmlTitle(doc *html.Node) string {
+	if title := findElement(doc, func(n *html.Node) bool { return n.DataAtom == atom.Title }); title != nil {
+		if text := strings.Join(strings.Fields(nodeText(title)), " "); text != "" {
+			return text
+		}
+	}
+	return metaProperty(doc, "og:title")
+}
+
+// canonicalURL returns the href of the <link rel="canonical"> element, or the og:url of the page
+func canonicalURL(doc *html.Node) string {
+	link := findElement(doc, func(n *html.Node) bool {
+		if n.DataAtom != atom.Link {
+			return false
+		}
+		for _, rel := range strings.Fields(strings.ToLower(attribute(n, "rel"))) {
+			if rel == "canonical" {
+				return attribute(n, "href") != ""
+			}
+		}
+		return false
+	})
+	if link != nil {
+		return strings.TrimSpace(attribute(link, "href"))
+	}
+	return metaProperty(doc, "og:url")
+}
+
+// metaProperty returns the content of the <meta property="..."> element with the given property
+func metaProperty(doc *html.Node, property string) string {
+	meta := findElement(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Meta && strings.EqualFold(attribute(n, "property"), property)
+	})
+	if meta == nil {
+		return ""
+	}
+	return strings.TrimSpace(attribute(meta, "content"))
+}
+
+// contentRoot returns the element holding the content of the page: its <main> element,
+// its only <article> or else its <body>
+func contentRoot(doc *html.Node) *html.Node {
+	main := findElement(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Main || attribute(n, "role") == "main"
+	})
+	if main != nil {
+		return main
+	}
+
+	var articles []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Article {
+			articles = append(articles, n)
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	if len(articles) == 1 {
+		return articles[0]
+	}
+
+	if body := findElement(doc, func(n *html.Node) bool { return n.DataAtom == atom.Body }); body != nil {
+		return body
+	}
+	return doc
+}
+
+// findElement returns the first element in document order that matches
+func findElement(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// attribute returns the value of the attribute of the element, or "" if it has none
+func attribute(n *html.Node, key string) string {
+	value, _ := attributeValue(n, key)
+	return value
+}
+
+// nodeText returns the text of the node and its descendants
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var text strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		text.WriteString(nodeText(child))
+	}
+	return text.String()
+}
+
+// isBoilerplate reports whether the element and its content are left out of the text
+func isBoilerplate(n *html.Node, inArticle bool) bool {
+	if boilerplateElements[n.DataAtom] || boilerplateRoles[strings.ToLower(attribute(n, "role"))] {
+		return true
+	}
+	// the header of the page is a banner, the header of an article holds its title
+	if n.DataAtom == atom.Header && !inArticle {
+		return true
+	}
+	_, hidden := attributeValue(n, "hidden")
+	return hidden || attribute(n, "aria-hidden") == "true"
+}
+
+// attributeValue returns the value of the attribute and whether the element has it
+func attributeValue(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Namespace == "" && strings.EqualFold(attr.Key, key) {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// htmlList is an open <ul> or <ol> element
+type htmlList struct {
+	ordered bool
+	next    int // number of the next item of an ordered list
+}
+
+// htmlRenderer writes the text of the elements, whitespace is collapsed outside of <pre>
+type htmlRenderer struct {
+	out       strings.Builder
+	newlines  int  // newlines at the end of out
+	space     bool // whitespace is pending before the next word
+	pre       int  // depth of <pre> elements
+	inArticle int  // depth of <article> and <main> elements
+	lists     []htmlList
+}
+
+// render writes the text of the node and its descendants
+func (r *htmlRenderer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+	case html.DocumentNode:
+		r.renderChildren(n)
+		return
+	default:
+		return
+	}
+
+	if isBoilerplate(n, r.inArticle > 0) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level, _ := strconv.Atoi(n.Data[1:])
+		r.breakLines(2)
+		r.write(strings.Repeat("#", level) + " ")
+		r.renderChildren(n)
+		r.breakLines(2)
+	case atom.Ul, atom.Ol:
+		// a nested list continues its item, a top level list is a block
+		if len(r.lists) > 0 {
+			r.breakLines(1)
+		} else {
+			r.breakLines(2)
+		}
+		list := htmlList{ordered: n.DataAtom == atom.Ol, next: 1}
+		if start, err := strconv.Atoi(attribute(n, "start")); err == nil {
+			list.next = start
+		}
+		r.lists = append(r.lists, list)
+		r.renderChildren(n)
+		r.lists = r.lists[:len(r.lists)-1]
+		if len(r.lists) == 0 {
+			r.breakLines(2)
+		}
+	case atom.Li:
+		r.breakLines(1)
+		marker := "- "
+		if len(r.lists) > 0 {
+			list := &r.lists[len(r.lists)-1]
+			if list.ordered {
+				marker = fmt.Sprintf("%d. ", list.next)
+				list.next++
+			}
+			r.write(strings.Repeat("  ", len(r.lists)-1))
+		}
+		r.write(marker)
+		r.renderChildren(n)
+		r.breakLines(1)
+	case atom.Pre:
+		r.breakLines(2)
+		r.pre++
+		r.renderChildren(n)
+		r.pre--
+		r.breakLines(2)
+	case atom.Br:
+		r.write("\n")
+	case atom.Tr:
+		r.breakLines(1)
+		r.renderChildren(n)
+		r.breakLines(1)
+	case atom.Td, atom.Th:
+		if r.newlines == 0 && r.out.Len() > 0 {
+			r.write(" | ")
+		}
+		r.renderChildren(n)
+	case atom.Article, atom.Main:
+		r.inArticle++
+		r.breakLines(2)
+		r.renderChildren(n)
+		r.breakLines(2)
+		r.inArticle--
+	default:
+		if blockElements[n.DataAtom] {
+			r.breakLines(2)
+			r.renderChildren(n)
+			r.breakLines(2)
+		} else {
+			r.renderChildren(n)
+		}
+	}
+}
+
+func (r *htmlRenderer) renderChildren(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		r.render(child)
+	}
+}
+
+// text writes the text of a text node, whitespace is collapsed to single spaces outside of <pre>
+func (r *htmlRenderer) text(data string) {
+	if r.pre > 0 {
+		r.write(data)
+		return
+	}
+
+	words := strings.Fields(data)
+	if len(words) == 0 {
+		r.space = r.space || data != ""
+		return
+	}
+
+	if strings.IndexFunc(data, unicode.IsSpace) == 0 {
+		r.space = true
+	}
+	if r.space && r.newlines == 0 && r.out.Len() > 0 && !strings.HasSuffix(r.out.String(), " ") {
+		r.write(" ")
+	}
+	r.write(strings.Join(words, " "))
+	r.space = strings.TrimRightFunc(data, unicode.IsSpace) != data
+}
+
+// write appends s and keeps track of the newlines at the end of the text
+func (r *htmlRenderer) write(s string) {
+	if s == "" {
+		return
+	}
+	r.out.WriteString(s)
+	r.space = false
+
+	trimmed := strings.TrimRight(s, "\n")
+	if trimmed == "" {
+		r.newlines += len(s)
+	} else {
+		r.newlines = len(s) - len(trimmed)
+	}
+}
+
+// breakLines ends the current line so that the text ends with at least n newlines
+func (r *htmlRenderer) breakLines(n int) {
+	if r.out.Len() == 0 {
+		return
+	}
+	for r.newlines < n {
+		r.write("\n")
+	}
+}
@@ -0,0 +1,91 @@
+package extractor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractHTML(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html>
+<head>
+  <title>  Counting
+    Sheep </title>
+  <link rel="Canonical" href="https://example.com/sheep">
+  <style>body { color: red; }</style>
+  <script>var tracking = true;</script>
+</head>
+<body>
+  <header><a href="/">Home</a> <a href="/about">About</a></header>
+  <nav><ul><li>Menu item</li></ul></nav>
+  <div class="content">
+    <h1>Counting <em>Sheep</em></h1>
+    <p>Sheep are counted
+       at night &amp; in the <b>morning</b>.<br>Twice.</p>
+    <ul>
+      <li>First</li>
+      <li>Second
+        <ol start="3"><li>Nested</li></ol>
+      </li>
+    </ul>
+    <h2>Table</h2>
+    <table><tr><th>Name</th><th>Count</th></tr><tr><td>Dolly</td><td>1</td></tr></table>
+    <pre>a  b
+  c</pre>
+    <p hidden>Hidden text</p>
+  </div>
+  <aside>Related posts</aside>
+  <footer>Copyright</footer>
+</body>
+</html>`
+
+	extracted, err := Extract("sheep.html", []byte(page))
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	expected := "# Counting Sheep\n\n" +
+		"Sheep are counted at night & in the morning.\nTwice.\n\n" +
+		"- First\n- Second\n  3. Nested\n\n" +
+		"## Table\n\n" +
+		"Name | Count\nDolly | 1\n\n" +
+		"a  b\n  c"
+	if extracted.Text != expected {
+		t.Errorf("Expected %q, got %q", expected, extracted.Text)
+	}
+
+	if extracted.Metadata["title"] != "Counting Sheep" {
+		t.Errorf("Expected title Counting Sheep, got %v", extracted.Metadata["title"])
+	}
+	if extracted.Metadata["canonical_url"] != "https://example.com/sheep" {
+		t.Errorf("Expected the canonical URL, got %v", extracted.Metadata["canonical_url"])
+	}
+	if extracted.Metadata["format"] != "html" {
+		t.Errorf("Expected format html, got %v", extracted.Metadata["format"])
+	}
+}
+
+func TestExtractHTMLContentRoot(t *testing.T) {
+	// the content is detected without an extension, only the <main> element is kept
+	page := `<html><head><meta property="og:title" content="Main Page"></head>
+<body><div>Sidebar links</div><main><article><header><h1>Post</h1></header><p>Body text</p></article></main></body></html>`
+
+	extracted, err := Extract("upload", []byte(page))
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	if extracted.Text != "# Post\n\nBody text" {
+		t.Errorf("Expected only the main content, got %q", extracted.Text)
+	}
+	if extracted.Metadata["title"] != "Main Page" {
+		t.Errorf("Expected the og:title, got %v", extracted.Metadata["title"])
+	}
+	if _, ok := extracted.Metadata["canonical_url"]; ok {
+		t.Errorf("Expected no canonical URL, got %v", extracted.Metadata["canonical_url"])
+	}
+
+	if _, err := Extract("empty.html", []byte("<html><body><script>x()</script></body></html>")); err == nil || !strings.Contains(err.Error(), "no text") {
+		t.Errorf("Expected a no text error, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package extractor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// odtMeta is meta.xml, the title and author of an ODT document
+type odtMeta struct {
+	Title          string `xml:"meta>title"`
+	Creator        string `xml:"meta>creator"`
+	InitialCreator string `xml:"meta>initial-creator"`
+}
+
+// odtReader renders the office:text element of content.xml
+type odtReader struct {
+	text officeText
+}
+
+// ExtractODT returns the text of the OpenDocument text document: paragraphs, headings of their
+// outline level as Markdown headings, list items, tables with one line per row and the foot- and
+// endnotes at the end. The metadata holds the title and author of the document
+func ExtractODT(content []byte) (string, map[string]any, error) {
+	files, err := openZip(content)
+	if err != nil {
+		return "", nil, fmt.Errorf("odt.go|ExtractODT: %w", err)
+	}
+
+	data, err := files.read("content.xml")
+	if err != nil {
+		return "", nil, fmt.Errorf("odt.go|ExtractODT: %w", err)
+	}
+	document, err := parseXMLTree(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("odt.go|ExtractODT: failed to parse content.xml: %w", err)
+	}
+
+	body := document.find("body")
+	if body == nil || body.child("text") == nil {
+		return "", nil, errors.New("odt.go|ExtractODT: content.xml has no text body, the file is not a text document")
+	}
+
+	reader := &odtReader{}
+	reader.block(body.child("text"), -1)
+
+	var meta odtMeta
+	_ = files.readXML("meta.xml", &meta) // the metadata is optional
+	author := meta.Creator
+	if author == "" {
+		author = meta.InitialCreator
+	}
+
+	return officeResult("odt.go|ExtractODT", &reader.text, meta.Title, author)
+}
+
+// block renders the headings, paragraphs, lists and tables of the element,
+// listDepth is the depth of the enclosing list, -1 outside of lists
+func (o *odtReader) block(n *xmlNode, listDepth int) {
+	for _, child := range n.children {
+		switch child.name {
+		case "h":
+			level, err := strconv.Atoi(child.attrs["outline-level"])
+			if err != nil {
+				level = 1
+			}
+			o.text.heading(o.inline(child), level)
+		case "p":
+			if listDepth >= 0 {
+				o.text.listItem(o.inline(child), listDepth)
+			} else {
+				o.text.paragraph(o.inline(child))
+			}
+		case "list":
+			o.block(child, listDepth+1)
+		case "table":
+			o.table(child)
+		case "table-of-content", "tracked-changes", "sequence-decls", "variable-decls", "user-field-decls":
+			// the table of contents repeats the headings, the declarations have no text
+		default:
+			o.block(child, listDepth) // list items, sections, ...
+		}
+	}
+}
+
+// table renders the rows of the table, including its header rows and row groups
+func (o *odtReader) table(table *xmlNode) {
+	var rows [][]string
+	var walk func(n *xmlNode)
+	walk = func(n *xmlNode) {
+		for _, child := range n.children {
+			switch child.name {
+			case "table-row":
+				var row []string
+				for _, cell := range child.children {
+					if cell.name == "table-cell" {
+						row = append(row, o.cellText(cell))
+					}
+				}
+				rows = append(rows, row)
+			case "table-header-rows", "table-rows", "table-row-group":
+				walk(child)
+			}
+		}
+	}
+	walk(table)
+	o.text.table(rows)
+}
+
+// cellText returns the text of all paragraphs and headings in the element
+func (o *odtReader) cellText(n *xmlNode) string {
+	if n == nil {
+		return ""
+	}
+	var parts []string
+	for _, child := range n.children {
+		if child.name == "p" || child.name == "h" {
+			parts = append(parts, o.inline(child))
+		} else {
+			parts = append(parts, o.cellText(child))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// inline returns the text of the paragraph. Whitespace is collapsed as ODF defines it,
+// spaces, tabs and line breaks are elements. Notes become markers with their citation
+// and their text is recorded as a footnote
+func (o *odtReader) inline(n *xmlNode) string {
+	var text strings.Builder
+	space := false // collapsed whitespace is pending before the next word
+
+	var walk func(n *xmlNode)
+	walk = func(n *xmlNode) {
+		for _, child := range n.children {
+			if child.name == "" {
+				words := strings.Fields(child.text)
+				space = space || strings.TrimLeftFunc(child.text, unicode.IsSpace) != child.text
+				if len(words) > 0 {
+					if space && text.Len() > 0 {
+						text.WriteString(" ")
+					}
+					text.WriteString(strings.Join(words, " "))
+					space = strings.TrimRightFunc(child.text, unicode.IsSpace) != child.text
+				}
+				continue
+			}
+
+			switch child.name {
+			case "s":
+				count, err := strconv.Atoi(child.attrs["c"])
+				if err != nil || count < 1 {
+					count = 1
+				}
+				text.WriteString(strings.Repeat(" ", count))
+				space = false
+			case "tab":
+				text.WriteString("\t")
+				space = false
+			case "line-break":
+				text.WriteString("\n")
+				space = false
+			case "note":
+				marker := "[" + strings.TrimSpace(child.child("note-citation").content()) + "]"
+				text.WriteString(marker)
+				space = false
+				o.text.footnote(marker, o.cellText(child.child("note-body")))
+			case "annotation", "ruby-text":
+				// comments and ruby annotations are not part of the text
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	return text.String()
+}
@@ -0,0 +1,177 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlNode is an element or, without a name, a text node of an XML document.
+// Names are local names, the namespace prefixes of the office formats are dropped
+type xmlNode struct {
+	name     string
+	attrs    map[string]string
+	children []*xmlNode
+	text     string
+}
+
+// parseXMLTree reads the whole XML document into a tree, its root is the document node
+func parseXMLTree(data []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return root, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: make(map[string]string, len(t.Attr))}
+			for _, attr := range t.Attr {
+				node.attrs[attr.Name.Local] = attr.Value
+			}
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.children = append(parent.children, &xmlNode{text: string(t)})
+		}
+	}
+}
+
+// child returns the first child element with the name
+func (n *xmlNode) child(name string) *xmlNode {
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// find returns the first descendant element with the name in document order
+func (n *xmlNode) find(name string) *xmlNode {
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+		if found := child.find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// content returns the text of the element and its descendants, "" for a nil element
+func (n *xmlNode) content() string {
+	if n == nil {
+		return ""
+	}
+	text := n.text
+	for _, child := range n.children {
+		text += child.content()
+	}
+	return text
+}
+
+// officeText collects the blocks of a word processing document: paragraphs, headings,
+// list items and tables. Footnotes are appended after the last block
+type officeText struct {
+	blocks    []string
+	footnotes []string
+	lastList  bool // the last block is a list, the next item continues it
+}
+
+// paragraph adds a paragraph, blank paragraphs are dropped
+func (t *officeText) paragraph(text string) {
+	if text = strings.TrimSpace(text); text != "" {
+		t.add(text, false)
+	}
+}
+
+// heading adds a heading of the level as a Markdown heading
+func (t *officeText) heading(text string, level int) {
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return
+	}
+	level = min(max(level, 1), 6)
+	t.add(strings.Repeat("#", level)+" "+text, false)
+}
+
+// listItem adds a "- " line, depth 0 is the outermost list
+func (t *officeText) listItem(text string, depth int) {
+	if text = strings.TrimSpace(text); text != "" {
+		t.add(strings.Repeat("  ", depth)+"- "+text, true)
+	}
+}
+
+// table adds the rows of a table, the cells of a row are separated by " | "
+func (t *officeText) table(rows [][]string) {
+	var lines []string
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = strings.Join(strings.Fields(cell), " ")
+		}
+		if line := strings.TrimSpace(strings.Join(cells, " | ")); strings.Trim(line, "| ") != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > 0 {
+		t.add(strings.Join(lines, "\n"), false)
+	}
+}
+
+// footnote records the text of the footnote with the marker
+func (t *officeText) footnote(marker string, text string) {
+	t.footnotes = append(t.footnotes, marker+" "+strings.Join(strings.Fields(text), " "))
+}
+
+func (t *officeText) add(block string, list bool) {
+	if list && t.lastList {
+		t.blocks[len(t.blocks)-1] += "\n" + block
+	} else {
+		t.blocks = append(t.blocks, block)
+	}
+	t.lastList = list
+}
+
+// String returns the blocks separated by blank lines, followed by the footnotes
+func (t *officeText) String() string {
+	text := strings.Join(t.blocks, "\n\n")
+	if len(t.footnotes) > 0 {
+		text += "\n\n" + strings.Join(t.footnotes, "\n")
+	}
+	return strings.TrimSpace(text)
+}
+
+// officeResult returns the text and the title and author of a DOCX or ODT document
+func officeResult(function string, text *officeText, title string, author string) (string, map[string]any, error) {
+	result := text.String()
+	if result == "" {
+		return "", nil, fmt.Errorf("%s: the document contains no text", function)
+	}
+
+	metadata := make(map[string]any)
+	if title = strings.Join(strings.Fields(title), " "); title != "" {
+		metadata["title"] = title
+	}
+	if author = strings.Join(strings.Fields(author), " "); author != "" {
+		metadata["author"] = author
+	}
+	return result, metadata, nil
+}
@@ -0,0 +1,107 @@
+package extractor
+
+import "testing"
+
+func TestExtractDOCX(t *testing.T) {
+	files := map[string]string{
+		"[Content_Types].xml": `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`,
+		"word/document.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:body>
+  <w:p><w:pPr><w:pStyle w:val="Titel"/></w:pPr><w:r><w:t>Sheep Handbook</w:t></w:r></w:p>
+  <w:p><w:pPr><w:pStyle w:val="Heading2"/><w:tabs><w:tab w:val="left" w:pos="720"/></w:tabs></w:pPr><w:r><w:t>Counting</w:t></w:r></w:p>
+  <w:p><w:r><w:t xml:space="preserve">Count the </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>sheep</w:t></w:r><w:del><w:r><w:delText>goats</w:delText></w:r></w:del><w:r><w:footnoteReference w:id="2"/></w:r><w:r><w:t>.</w:t><w:br/><w:t>Twice.</w:t></w:r></w:p>
+  <w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>First</w:t></w:r></w:p>
+  <w:p><w:pPr><w:numPr><w:ilvl w:val="1"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Nested</w:t></w:r></w:p>
+  <w:p><w:pPr><w:outlineLvl w:val="2"/></w:pPr><w:r><w:t>Outline heading</w:t></w:r></w:p>
+  <w:tbl>
+    <w:tr><w:tc><w:tcPr><w:tcW w:w="100"/></w:tcPr><w:p><w:r><w:t>Name</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Count</w:t></w:r></w:p></w:tc></w:tr>
+    <w:tr><w:tc><w:p><w:r><w:t>Dolly</w:t></w:r></w:p><w:p><w:r><w:t>the first</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>1</w:t></w:r></w:p></w:tc></w:tr>
+  </w:tbl>
+  <w:p/>
+  <w:sectPr/>
+</w:body>
+</w:document>`,
+		"word/styles.xml": `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+  <w:style w:type="paragraph" w:styleId="Titel"><w:name w:val="Title"/></w:style>
+  <w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/><w:pPr><w:outlineLvl w:val="1"/></w:pPr></w:style>
+</w:styles>`,
+		"word/footnotes.xml": `<w:footnotes xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+  <w:footnote w:type="separator" w:id="-1"><w:p><w:r><w:separator/></w:r></w:p></w:footnote>
+  <w:footnote w:id="2"><w:p><w:r><w:footnoteRef/></w:r><w:r><w:t xml:space="preserve"> Sheep sleep standing.</w:t></w:r></w:p></w:footnote>
+</w:footnotes>`,
+		"docProps/core.xml": `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <dc:title>Handbook</dc:title><dc:creator>Ada Shepherd</dc:creator>
+</cp:coreProperties>`,
+	}
+	document := buildZip("", files, "[Content_Types].xml", "word/document.xml", "word/styles.xml", "word/footnotes.xml", "docProps/core.xml")
+
+	// the document is detected by its word/document.xml, not by its file name
+	extracted, err := Extract("upload", document)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	expected := "# Sheep Handbook\n\n" +
+		"## Counting\n\n" +
+		"Count the sheep[1].\nTwice.\n\n" +
+		"- First\n  - Nested\n\n" +
+		"### Outline heading\n\n" +
+		"Name | Count\nDolly the first | 1\n\n" +
+		"[1] Sheep sleep standing."
+	if extracted.Text != expected {
+		t.Errorf("Expected %q, got %q", expected, extracted.Text)
+	}
+
+	if extracted.Metadata["title"] != "Handbook" || extracted.Metadata["author"] != "Ada Shepherd" || extracted.Metadata["format"] != "docx" {
+		t.Errorf("Unexpected metadata: %v", extracted.Metadata)
+	}
+}
+
+func TestExtractODT(t *testing.T) {
+	files := map[string]string{
+		"content.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0">
+<office:automatic-styles><style:style xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0"><style:text-properties/></style:style></office:automatic-styles>
+<office:body><office:text>
+  <text:sequence-decls><text:sequence-decl text:name="Table"/></text:sequence-decls>
+  <text:table-of-content><text:index-body><text:p>Counting 1</text:p></text:index-body></text:table-of-content>
+  <text:h text:outline-level="2">Counting</text:h>
+  <text:p>Count   the <text:span>sheep</text:span><text:s text:c="2"/>slowly<text:note text:note-class="footnote"><text:note-citation>1</text:note-citation><text:note-body><text:p>Sheep sleep standing.</text:p></text:note-body></text:note>.<text:line-break/>Twice.<office:annotation><text:p>a comment</text:p></office:annotation></text:p>
+  <text:list><text:list-item><text:p>First</text:p><text:list><text:list-item><text:p>Nested</text:p></text:list-item></text:list></text:list-item></text:list>
+  <table:table><table:table-header-rows><table:table-row><table:table-cell><text:p>Name</text:p></table:table-cell><table:table-cell><text:p>Count</text:p></table:table-cell></table:table-row></table:table-header-rows>
+    <table:table-row><table:table-cell><text:p>Dolly</text:p></table:table-cell><table:table-cell><text:p>1</text:p></table:table-cell></table:table-row></table:table>
+</office:text></office:body>
+</office:document-content>`,
+		"meta.xml": `<office:document-meta xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:meta="urn:oasis:names:tc:opendocument:xmlns:meta:1.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<office:meta><dc:title>Handbook</dc:title><meta:initial-creator>Bo Peep</meta:initial-creator></office:meta>
+</office:document-meta>`,
+	}
+	document := buildZip("application/vnd.oasis.opendocument.text", files, "content.xml", "meta.xml")
+
+	extracted, err := Extract("upload", document)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	expected := "## Counting\n\n" +
+		"Count the sheep  slowly[1].\nTwice.\n\n" +
+		"- First\n  - Nested\n\n" +
+		"Name | Count\nDolly | 1\n\n" +
+		"[1] Sheep sleep standing."
+	if extracted.Text != expected {
+		t.Errorf("Expected %q, got %q", expected, extracted.Text)
+	}
+
+	if extracted.Metadata["title"] != "Handbook" || extracted.Metadata["author"] != "Bo Peep" || extracted.Metadata["format"] != "odt" {
+		t.Errorf("Unexpected metadata: %v", extracted.Metadata)
+	}
+
+	// a spreadsheet has no text body
+	sheet := buildZip("application/vnd.oasis.opendocument.spreadsheet", map[string]string{
+		"content.xml": `<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"><office:body><office:spreadsheet/></office:body></office:document-content>`,
+	}, "content.xml")
+	if _, err := Extract("sheet.odt", sheet); err == nil {
+		t.Error("Expected an error for a document without a text body")
+	}
+}
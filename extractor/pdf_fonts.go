@@ -0,0 +1,382 @@
+package extractor
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// pdfGlyph is a decoded character code of a shown string
+type pdfGlyph struct {
+	text    string
+	width   float64 // glyph space, 1/1000 of the font size
+	isSpace bool    // the single byte code 32, word spacing applies to it
+}
+
+// pdfFont decodes the strings shown with a font into text
+type pdfFont struct {
+	toUnicode    *toUnicodeCMap
+	codeLength   int             // bytes per character code without a ToUnicode CMap
+	differences  map[byte]string // simple fonts: codes remapped by the /Differences of the encoding
+	charmap      *charmap.Charmap
+	widths       map[int]float64
+	defaultWidth float64
+}
+
+// loadFont reads the encoding, ToUnicode CMap and widths of a font dictionary
+func (doc *pdfDocument) loadFont(fontDict pdfDict) *pdfFont {
+	font := &pdfFont{codeLength: 1, charmap: charmap.Windows1252, widths: make(map[int]float64), defaultWidth: 500}
+
+	if stream := doc.stream(fontDict["ToUnicode"]); stream != nil {
+		if data, err := doc.decodeStream(stream); err == nil {
+			font.toUnicode = parseToUnicodeCMap(data)
+		}
+	}
+
+	if doc.name(fontDict["Subtype"]) == "Type0" {
+		font.codeLength = 2
+		font.defaultWidth = 1000
+
+		if descendants := doc.array(fontDict["DescendantFonts"]); len(descendants) > 0 {
+			descendant := doc.dict(descendants[0])
+			if dw := doc.float(descendant["DW"]); dw > 0 {
+				font.defaultWidth = dw
+			}
+			doc.readCIDWidths(font, doc.array(descendant["W"]))
+		}
+		return font
+	}
+
+	switch encoding := doc.resolve(fontDict["Encoding"]).(type) {
+	case pdfName:
+		font.charmap = charmapOf(encoding)
+	case pdfDict:
+		if base := doc.name(encoding["BaseEncoding"]); base != "" {
+			font.charmap = charmapOf(base)
+		}
+		font.differences = doc.readDifferences(doc.array(encoding["Differences"]))
+	}
+
+	firstChar := doc.int(fontDict["FirstChar"])
+	for i, width := range doc.array(fontDict["Widths"]) {
+		font.widths[firstChar+i] = doc.float(width)
+	}
+
+	return font
+}
+
+// charmapOf returns the single byte encoding of a simple font
+func charmapOf(encoding pdfName) *charmap.Charmap {
+	if encoding == "MacRomanEncoding" {
+		return charmap.Macintosh
+	}
+	// WinAnsiEncoding, and the closest match for StandardEncoding and font built-in encodings
+	return charmap.Windows1252
+}
+
+// readDifferences reads a /Differences array: a code followed by the glyph names of consecutive codes
+func (doc *pdfDocument) readDifferences(differences []any) map[byte]string {
+	mapped := make(map[byte]string)
+	code := 0
+	for _, element := range differences {
+		switch v := doc.resolve(element).(type) {
+		case int64:
+			code = int(v)
+		case pdfName:
+			if text := glyphNameToText(string(v)); text != "" && code >= 0 && code < 256 {
+				mapped[byte(code)] = text
+			}
+			code++
+		}
+	}
+	return mapped
+}
+
+// readCIDWidths reads the /W array of a CID font: "c [w1 w2 ...]" or "cFirst cLast w"
+func (doc *pdfDocument) readCIDWidths(font *pdfFont, w []any) {
+	for i := 0; i < len(w); {
+		first := doc.int(w[i])
+		if i+1 < len(w) {
+			if widths := doc.array(w[i+1]); widths != nil {
+				for j, width := range widths {
+					font.widths[first+j] = doc.float(width)
+				}
+				i += 2
+				continue
+			}
+		}
+		if i+2 < len(w) {
+			for code := first; code <= doc.int(w[i+1]) && code-first < 65536; code++ {
+				font.widths[code] = doc.float(w[i+2])
+			}
+		}
+		i += 3
+	}
+}
+
+// decode splits the shown string into character codes and returns their glyphs
+func (font *pdfFont) decode(s []byte) []pdfGlyph {
+	var glyphs []pdfGlyph
+	for pos := 0; pos < len(s); {
+		length := font.codeLength
+		if font.toUnicode != nil {
+			length = font.toUnicode.codeLength(s[pos:], font.codeLength)
+		}
+		length = min(length, len(s)-pos)
+
+		code := 0
+		for _, b := range s[pos : pos+length] {
+			code = code<<8 | int(b)
+		}
+
+		glyph := pdfGlyph{text: font.text(code, length), width: font.defaultWidth, isSpace: length == 1 && code == 32}
+		if width, ok := font.widths[code]; ok {
+			glyph.width = width
+		}
+		glyphs = append(glyphs, glyph)
+		pos += length
+	}
+	return glyphs
+}
+
+// text returns the Unicode text of a character code
+func (font *pdfFont) text(code int, length int) string {
+	if font.toUnicode != nil {
+		if text, ok := font.toUnicode.lookup(code, length); ok {
+			return text
+		}
+	}
+	if length != 1 {
+		return "" // a CID without ToUnicode mapping can not be decoded
+	}
+	if text, ok := font.differences[byte(code)]; ok {
+		return text
+	}
+	if code < 32 {
+		return ""
+	}
+	return string(font.charmap.DecodeByte(byte(code)))
+}
+
+// toUnicodeCMap maps character codes to Unicode text
+type toUnicodeCMap struct {
+	codespaces []codespaceRange
+	mappings   map[int]map[int]string // code length -> code -> text
+}
+
+type codespaceRange struct {
+	low, high []byte
+}
+
+// parseToUnicodeCMap reads the codespace ranges and the bfchar and bfrange mappings of a CMap
+func parseToUnicodeCMap(data []byte) *toUnicodeCMap {
+	cmap := &toUnicodeCMap{mappings: make(map[int]map[int]string)}
+	lexer := &pdfLexer{data: data}
+
+	var operands []any
+	for {
+		token, err := lexer.readObject()
+		if err != nil {
+			break
+		}
+
+		keyword, ok := token.(pdfKeyword)
+		if !ok {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch keyword {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				low, ok1 := operands[i].([]byte)
+				high, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 && len(low) == len(high) && len(low) > 0 {
+					cmap.codespaces = append(cmap.codespaces, codespaceRange{low: low, high: high})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].([]byte)
+				dst, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 {
+					cmap.add(src, decodeUTF16(dst))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].([]byte)
+				high, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 || len(low) != len(high) || len(low) == 0 {
+					continue
+				}
+				cmap.addRange(low, bytesToInt(high), operands[i+2])
+			}
+		}
+
+		operands = operands[:0]
+	}
+
+	return cmap
+}
+
+// add maps the code src to text
+func (cmap *toUnicodeCMap) add(src []byte, text string) {
+	if len(src) == 0 {
+		return
+	}
+	if cmap.mappings[len(src)] == nil {
+		cmap.mappings[len(src)] = make(map[int]string)
+	}
+	cmap.mappings[len(src)][bytesToInt(src)] = text
+}
+
+// addRange maps the codes from low to high: to consecutive code points after dst, or to the elements of a dst array
+func (cmap *toUnicodeCMap) addRange(low []byte, high int, dst any) {
+	first := bytesToInt(low)
+	for code := first; code <= high && code-first < 65536; code++ {
+		src := intToBytes(code, len(low))
+
+		switch d := dst.(type) {
+		case []byte:
+			units := utf16.Decode(bytesToUTF16(d))
+			if len(units) == 0 {
+				return
+			}
+			units[len(units)-1] += rune(code - first)
+			cmap.add(src, string(units))
+		case []any:
+			if code-first < len(d) {
+				if text, ok := d[code-first].([]byte); ok {
+					cmap.add(src, decodeUTF16(text))
+				}
+			}
+		}
+	}
+}
+
+// codeLength returns the byte length of the code at the start of s
+func (cmap *toUnicodeCMap) codeLength(s []byte, fallback int) int {
+	for _, space := range cmap.codespaces {
+		n := len(space.low)
+		if n > len(s) {
+			continue
+		}
+		inside := true
+		for i := 0; i < n; i++ {
+			if s[i] < space.low[i] || s[i] > space.high[i] {
+				inside = false
+				break
+			}
+		}
+		if inside {
+			return n
+		}
+	}
+
+	// without codespace ranges use the length of the mapped codes
+	if len(cmap.codespaces) == 0 && len(cmap.mappings) == 1 {
+		for length := range cmap.mappings {
+			return length
+		}
+	}
+	return fallback
+}
+
+func (cmap *toUnicodeCMap) lookup(code int, length int) (string, bool) {
+	text, ok := cmap.mappings[length][code]
+	return text, ok
+}
+
+func bytesToInt(b []byte) int {
+	value := 0
+	for _, c := range b {
+		value = value<<8 | int(c)
+	}
+	return value
+}
+
+func intToBytes(value int, length int) []byte {
+	b := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		b[i] = byte(value)
+		value >>= 8
+	}
+	return b
+}
+
+func bytesToUTF16(b []byte) []uint16 {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return units
+}
+
+// decodeUTF16 decodes the UTF-16BE text of a CMap destination
+func decodeUTF16(b []byte) string {
+	if len(b) == 1 {
+		return string(rune(b[0]))
+	}
+	return string(utf16.Decode(bytesToUTF16(b)))
+}
+
+// glyphNames maps the glyph names of the Adobe glyph list that are common in text to their characters
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$", "percent": "%",
+	"ampersand": "&", "quotesingle": "'", "parenleft": "(", "parenright": ")", "asterisk": "*",
+	"plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/", "zero": "0", "one": "1",
+	"two": "2", "three": "3", "four": "4", "five": "5", "six": "6", "seven": "7", "eight": "8",
+	"nine": "9", "colon": ":", "semicolon": ";", "less": "<", "equal": "=", "greater": ">",
+	"question": "?", "at": "@", "bracketleft": "[", "backslash": "\\", "bracketright": "]",
+	"asciicircum": "^", "underscore": "_", "grave": "`", "braceleft": "{", "bar": "|",
+	"braceright": "}", "asciitilde": "~", "quoteleft": "‘", "quoteright": "’", "quotedblleft": "“",
+	"quotedblright": "”", "quotesinglbase": "‚", "quotedblbase": "„", "endash": "–", "emdash": "—",
+	"bullet": "•", "ellipsis": "…", "fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+	"dagger": "†", "daggerdbl": "‡", "trademark": "™", "copyright": "©", "registered": "®",
+	"degree": "°", "section": "§", "paragraph": "¶", "periodcentered": "·", "minus": "−",
+	"germandbls": "ß", "ae": "æ", "AE": "Æ", "oe": "œ", "OE": "Œ", "oslash": "ø", "Oslash": "Ø",
+	"exclamdown": "¡", "questiondown": "¿", "guillemotleft": "«", "guillemotright": "»",
+	"sterling": "£", "yen": "¥", "Euro": "€", "cent": "¢", "multiply": "×", "divide": "÷",
+	"nbspace": " ", "dotlessi": "ı",
+}
+
+// accentMarks maps the accent suffixes of glyph names like "eacute" to combining marks
+var accentMarks = map[string]string{
+	"acute": "\u0301", "grave": "\u0300", "circumflex": "\u0302", "dieresis": "\u0308",
+	"tilde": "\u0303", "ring": "\u030A", "cedilla": "\u0327", "caron": "\u030C",
+}
+
+// glyphNameToText returns the text of a glyph name: a listed name, a single letter,
+// a letter with an accent suffix or a uniXXXX / uXXXX[XX] code point
+func glyphNameToText(name string) string {
+	name, _, _ = strings.Cut(name, ".") // "a.sc" is a variant of "a"
+
+	if text, ok := glyphNames[name]; ok {
+		return text
+	}
+	if len(name) == 1 {
+		return name
+	}
+	if len(name) > 1 {
+		if mark, ok := accentMarks[name[1:]]; ok {
+			return norm.NFC.String(name[:1] + mark)
+		}
+	}
+
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 {
+		if code, err := strconv.ParseUint(name[3:7], 16, 32); err == nil {
+			return string(rune(code))
+		}
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		if code, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return string(rune(code))
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,670 @@
+package extractor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// The PDF object model: names, references, dictionaries, streams and keywords.
+// Numbers are int64 or float64, strings are []byte, arrays are []any
+type (
+	pdfName    string
+	pdfKeyword string // operators of content streams and the delimiters "[", "]", "<<", ">>"
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		data []byte // still encoded with the filters of the dict
+	}
+)
+
+var objectPattern = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// pdfDocument holds the objects of a PDF file by object number
+type pdfDocument struct {
+	objects map[int]any
+	trailer pdfDict
+}
+
+// parsePDF reads all objects of the file. Instead of trusting the cross-reference table,
+// which is often broken, the file is scanned for "n g obj" headers; later definitions
+// (incremental updates) replace earlier ones. Objects of object streams are loaded too
+func parsePDF(data []byte) (*pdfDocument, error) {
+	doc := &pdfDocument{objects: make(map[int]any), trailer: make(pdfDict)}
+
+	for pos := 0; pos < len(data); {
+		match := objectPattern.FindSubmatchIndex(data[pos:])
+		if match == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+match[2] : pos+match[3]]))
+
+		lexer := &pdfLexer{data: data, pos: pos + match[1]}
+		value, err := lexer.readObject()
+		if err != nil {
+			pos += match[1]
+			continue
+		}
+
+		if dict, ok := value.(pdfDict); ok {
+			if stream, ok := lexer.readStream(dict); ok {
+				value = stream
+			}
+		}
+		doc.objects[num] = value
+
+		pos = min(lexer.pos, len(data))
+		if end := bytes.Index(data[pos:], []byte("endobj")); end >= 0 && !objectPattern.Match(data[pos:pos+end]) {
+			pos += end + len("endobj")
+		}
+	}
+
+	doc.readTrailers(data)
+	doc.loadObjectStreams()
+
+	if len(doc.objects) == 0 {
+		return nil, errors.New("no objects found")
+	}
+	if doc.trailer["Encrypt"] != nil {
+		return nil, errors.New("encrypted PDFs are not supported")
+	}
+
+	return doc, nil
+}
+
+// readTrailers merges the trailer dictionaries of the file and of its cross-reference streams
+func (doc *pdfDocument) readTrailers(data []byte) {
+	for _, num := range doc.sortedObjectNumbers() {
+		if stream, ok := doc.objects[num].(*pdfStream); ok && stream.dict["Type"] == pdfName("XRef") {
+			for key, value := range stream.dict {
+				doc.trailer[key] = value
+			}
+		}
+	}
+
+	for pos := 0; ; {
+		index := bytes.Index(data[pos:], []byte("trailer"))
+		if index < 0 {
+			break
+		}
+		lexer := &pdfLexer{data: data, pos: pos + index + len("trailer")}
+		if dict, err := lexer.readObject(); err == nil {
+			if trailer, ok := dict.(pdfDict); ok {
+				for key, value := range trailer {
+					doc.trailer[key] = value
+				}
+			}
+		}
+		pos += index + len("trailer")
+	}
+}
+
+// loadObjectStreams adds the objects compressed into object streams,
+// objects that are also defined directly in the file keep their direct definition
+func (doc *pdfDocument) loadObjectStreams() {
+	for _, num := range doc.sortedObjectNumbers() {
+		stream, ok := doc.objects[num].(*pdfStream)
+		if !ok || stream.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+
+		data, err := doc.decodeStream(stream)
+		if err != nil {
+			continue
+		}
+
+		count, first := doc.int(stream.dict["N"]), doc.int(stream.dict["First"])
+		header := &pdfLexer{data: data}
+		for i := 0; i < count; i++ {
+			objectNum, err1 := header.next()
+			offset, err2 := header.next()
+			objNum, ok1 := objectNum.(int64)
+			objOffset, ok2 := offset.(int64)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				break
+			}
+
+			if _, exists := doc.objects[int(objNum)]; exists || first+int(objOffset) >= len(data) {
+				continue
+			}
+			lexer := &pdfLexer{data: data, pos: first + int(objOffset)}
+			if value, err := lexer.readObject(); err == nil {
+				doc.objects[int(objNum)] = value
+			}
+		}
+	}
+}
+
+// sortedObjectNumbers returns the object numbers in ascending order
+func (doc *pdfDocument) sortedObjectNumbers() []int {
+	nums := make([]int, 0, len(doc.objects))
+	for num := range doc.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// resolve follows references until it reaches a direct object, unknown references are nil
+func (doc *pdfDocument) resolve(value any) any {
+	for depth := 0; depth < 32; depth++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		value = doc.objects[ref.num]
+	}
+	return nil
+}
+
+// dict returns the resolved value as a dictionary, the dictionary of a stream included
+func (doc *pdfDocument) dict(value any) pdfDict {
+	switch v := doc.resolve(value).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	default:
+		return nil
+	}
+}
+
+func (doc *pdfDocument) array(value any) []any {
+	array, _ := doc.resolve(value).([]any)
+	return array
+}
+
+func (doc *pdfDocument) stream(value any) *pdfStream {
+	stream, _ := doc.resolve(value).(*pdfStream)
+	return stream
+}
+
+func (doc *pdfDocument) name(value any) pdfName {
+	name, _ := doc.resolve(value).(pdfName)
+	return name
+}
+
+func (doc *pdfDocument) int(value any) int {
+	return int(doc.float(value))
+}
+
+func (doc *pdfDocument) float(value any) float64 {
+	switch v := doc.resolve(value).(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return 0
+	}
+}
+
+// decodeStream applies the filters of the stream to its data
+func (doc *pdfDocument) decodeStream(stream *pdfStream) ([]byte, error) {
+	filters := doc.array(stream.dict["Filter"])
+	if name := doc.name(stream.dict["Filter"]); name != "" {
+		filters = []any{name}
+	}
+
+	params := doc.array(stream.dict["DecodeParms"])
+	if dict := doc.dict(stream.dict["DecodeParms"]); dict != nil {
+		params = []any{dict}
+	}
+
+	data := stream.data
+	for i, filter := range filters {
+		var param pdfDict
+		if i < len(params) {
+			param = doc.dict(params[i])
+		}
+
+		var err error
+		switch doc.name(filter) {
+		case "FlateDecode", "Fl":
+			data, err = flateDecode(data)
+			if err == nil {
+				data, err = doc.applyPredictor(data, param)
+			}
+		case "ASCIIHexDecode", "AHx":
+			data, err = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		default:
+			err = fmt.Errorf("unsupported filter %s", doc.name(filter))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// flateDecode inflates zlib data, the data of a truncated stream is returned as far as it could be read
+func flateDecode(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// a small stream may inflate to gigabytes
+	decoded, err := io.ReadAll(io.LimitReader(reader, maxZipEntrySize+1))
+	if err != nil && len(decoded) == 0 {
+		return nil, err
+	}
+	if len(decoded) > maxZipEntrySize {
+		return nil, fmt.Errorf("stream is larger than %d bytes", maxZipEntrySize)
+	}
+	return decoded, nil
+}
+
+// applyPredictor reverses the PNG predictors (Predictor >= 10) of the decode parameters
+func (doc *pdfDocument) applyPredictor(data []byte, param pdfDict) ([]byte, error) {
+	predictor := doc.int(param["Predictor"])
+	if predictor < 10 {
+		return data, nil
+	}
+
+	colors, bits, columns := 1, 8, 1
+	if value := doc.int(param["Colors"]); value > 0 {
+		colors = value
+	}
+	if value := doc.int(param["BitsPerComponent"]); value > 0 {
+		bits = value
+	}
+	if value := doc.int(param["Columns"]); value > 0 {
+		columns = value
+	}
+
+	// the parameters come from the file, a row can never be longer than the data
+	if colors > 32 || bits > 16 || columns > len(data) {
+		return nil, fmt.Errorf("invalid predictor parameters")
+	}
+	bytesPerPixel := max((colors*bits+7)/8, 1)
+	rowSize := (colors*bits*columns + 7) / 8
+	if rowSize <= 0 || rowSize > len(data) {
+		return nil, fmt.Errorf("invalid predictor parameters")
+	}
+
+	var out []byte
+	previous := make([]byte, rowSize)
+	for pos := 0; pos+rowSize+1 <= len(data); pos += rowSize + 1 {
+		filter, row := data[pos], append([]byte(nil), data[pos+1:pos+1+rowSize]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bytesPerPixel {
+				left, upLeft = row[i-bytesPerPixel], previous[i-bytesPerPixel]
+			}
+			up := previous[i]
+
+			switch filter {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		previous = row
+	}
+
+	return out, nil
+}
+
+// paeth is the Paeth predictor of the PNG specification
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	return hex.DecodeString(string(digits))
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+
+	decoded := make([]byte, 4*len(data))
+	n, _, err := ascii85.Decode(decoded, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return decoded[:n], nil
+}
+
+// pdfLexer reads the tokens and objects of PDF files and content streams
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return c == '(' || c == ')' || c == '<' || c == '>' || c == '[' || c == ']' || c == '{' || c == '}' || c == '/' || c == '%'
+}
+
+// skipSpace skips white space and comments
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// next returns the next token: a number, name, string or keyword. It returns io.EOF at the end
+func (l *pdfLexer) next() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		return pdfName(l.readName()), nil
+	case c == '(':
+		return l.readLiteralString(), nil
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		return l.readHexString(), nil
+	case c == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), nil
+		}
+		l.pos++
+		return pdfKeyword(">"), nil
+	case c == '[' || c == ']' || c == '{' || c == '}' || c == ')':
+		l.pos++
+		return pdfKeyword(c), nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+
+	if number, ok := parsePDFNumber(word); ok {
+		return number, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+// parsePDFNumber parses integers as int64 and reals as float64
+func parsePDFNumber(word string) (any, bool) {
+	if word == "" || !(word[0] == '+' || word[0] == '-' || word[0] == '.' || (word[0] >= '0' && word[0] <= '9')) {
+		return nil, false
+	}
+	if i, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return i, true
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, true
+	}
+	return nil, false
+}
+
+// readName reads a name after its slash, #xx escapes are decoded
+func (l *pdfLexer) readName() string {
+	var name []byte
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if decoded, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+				name = append(name, decoded[0])
+				l.pos += 3
+				continue
+			}
+		}
+		name = append(name, c)
+		l.pos++
+	}
+	return string(name)
+}
+
+// readLiteralString reads a string in balanced parentheses and decodes its escapes
+func (l *pdfLexer) readLiteralString() []byte {
+	var out []byte
+	depth := 0
+	l.pos++ // (
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			depth++
+			out = append(out, c)
+		case ')':
+			if depth == 0 {
+				return out
+			}
+			depth--
+			out = append(out, c)
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				// line continuation
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					value := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(value))
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// readHexString reads a string of hex digits in angle brackets
+func (l *pdfLexer) readHexString() []byte {
+	l.pos++ // <
+	start := l.pos
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		l.pos++
+	}
+	decoded, _ := asciiHexDecode(l.data[start:l.pos])
+	if l.pos < len(l.data) {
+		l.pos++ // >
+	}
+	return decoded
+}
+
+// readObject reads a complete object: arrays and dictionaries with their elements,
+// "n g R" as a reference. Content stream operators are returned as keywords
+func (l *pdfLexer) readObject() (any, error) {
+	token, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case pdfKeyword:
+		switch t {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		case "[":
+			var array []any
+			for {
+				l.skipSpace()
+				if l.pos < len(l.data) && l.data[l.pos] == ']' {
+					l.pos++
+					return array, nil
+				}
+				element, err := l.readObject()
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, element)
+			}
+		case "<<":
+			dict := make(pdfDict)
+			for {
+				key, err := l.readObject()
+				if err != nil {
+					return nil, err
+				}
+				if key == pdfKeyword(">>") {
+					return dict, nil
+				}
+				name, ok := key.(pdfName)
+				if !ok {
+					continue
+				}
+				value, err := l.readObject()
+				if err != nil {
+					return nil, err
+				}
+				if value == pdfKeyword(">>") {
+					return dict, nil
+				}
+				dict[name] = value
+			}
+		}
+		return t, nil
+	case int64:
+		// "n g R" is a reference
+		saved := l.pos
+		if gen, err := l.next(); err == nil {
+			if genNum, ok := gen.(int64); ok {
+				if r, err := l.next(); err == nil && r == pdfKeyword("R") {
+					return pdfRef{num: int(t), gen: int(genNum)}, nil
+				}
+			}
+		}
+		l.pos = saved
+		return t, nil
+	default:
+		return token, nil
+	}
+}
+
+// readStream reads the stream data following a dictionary, if there is one
+func (l *pdfLexer) readStream(dict pdfDict) (*pdfStream, bool) {
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		return nil, false
+	}
+	l.pos += len("stream")
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	// trust /Length only if it is direct and the stream really ends there
+	if length, ok := dict["Length"].(int64); ok && length >= 0 && start+int(length) <= len(l.data) {
+		end := start + int(length)
+		rest := bytes.TrimLeft(l.data[end:], " \r\n\t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = len(l.data) - len(rest) + len("endstream")
+			return &pdfStream{dict: dict, data: l.data[start:end]}, true
+		}
+	}
+
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		l.pos = len(l.data)
+		return &pdfStream{dict: dict, data: l.data[start:]}, true
+	}
+	l.pos = start + end + len("endstream")
+
+	data := l.data[start : start+end]
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	return &pdfStream{dict: dict, data: data}, true
+}
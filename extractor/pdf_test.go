@@ -0,0 +1,117 @@
+package extractor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF writes the objects with consecutive numbers starting at 1, the file has no
+// cross-reference table, which the parser does not need
+func buildPDF(objects ...string) []byte {
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.5\n")
+	for i, object := range objects {
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	pdf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+// flateStream returns a stream object with the compressed data and the extra dictionary entries
+func flateStream(data string, entries string) string {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write([]byte(data))
+	writer.Close()
+
+	return fmt.Sprintf("<< /Length %d /Filter /FlateDecode %s >>\nstream\n%s\nendstream", compressed.Len(), entries, compressed.String())
+}
+
+func TestExtractPDF(t *testing.T) {
+	toUnicode := `/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+1 beginbfchar <0003> <0020> endbfchar
+1 beginbfrange <0041> <005A> <0041> endbfrange
+endcmap`
+
+	fontInObjectStream := "12 0 << /Type /Font /Subtype /Type1 /BaseFont /Helvetica " +
+		"/Encoding << /Type /Encoding /BaseEncoding /WinAnsiEncoding /Differences [150 /fi] >> >>"
+
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 6 0 R] /Count 2 /Resources << /Font << /F1 12 0 R /F2 7 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		flateStream(fontInObjectStream, "/Type /ObjStm /N 1 /First 5"),
+		flateStream(`BT /F1 12 Tf 72 700 Td (Hello \226ne) Tj ( world) Tj
+0 -14 Td [(Second)-300(line)] TJ
+0 -40 Td (New paragraph \(x\)) Tj ET`, ""),
+		"<< /Type /Page /Parent 2 0 R /Contents [8 0 R 11 0 R] >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Sans /Encoding /Identity-H /DescendantFonts [10 0 R] /ToUnicode 9 0 R >>",
+		flateStream("BT /F2 10 Tf 50 50 Td <005000410047", ""),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(toUnicode), toUnicode),
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /Sans /DW 1000 >>",
+		flateStream("0045000300540057004F> Tj ET", ""),
+	)
+
+	extracted, err := Extract("book.pdf", pdf)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	expected := "Hello fine world\nSecond line\n\nNew paragraph (x)\n" + PageBreak + "\nPAGE TWO"
+	if extracted.Text != expected {
+		t.Errorf("Expected %q, got %q", expected, extracted.Text)
+	}
+	if extracted.Metadata["format"] != "pdf" {
+		t.Errorf("Expected format pdf, got %v", extracted.Metadata["format"])
+	}
+}
+
+func TestExtractPDFErrors(t *testing.T) {
+	if _, err := ExtractPDF([]byte("%PDF-1.4\nnot really a pdf")); err == nil {
+		t.Error("Expected an error for a PDF without objects")
+	}
+
+	// a page that only draws an image has no text
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		flateStream("q 100 0 0 100 0 0 cm /Im1 Do Q", ""),
+	)
+	if _, err := ExtractPDF(pdf); err == nil || !strings.Contains(err.Error(), "no extractable text") {
+		t.Errorf("Expected a no extractable text error, got %v", err)
+	}
+
+	// an unterminated hex string at the end of the file
+	if _, err := ExtractPDF([]byte("%PDF-1.4\n1 0 obj <")); err == nil {
+		t.Error("Expected an error for a truncated PDF")
+	}
+
+	// predictor rows longer than the stream and streams that inflate beyond the limit are rejected
+	pdf = buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		flateStream("BT (hidden) Tj ET", "/DecodeParms << /Predictor 12 /Columns 1099511627776 >>"),
+	)
+	if _, err := ExtractPDF(pdf); err == nil {
+		t.Error("Expected an error for invalid predictor parameters")
+	}
+
+	var bomb bytes.Buffer
+	writer := zlib.NewWriter(&bomb)
+	writer.Write(make([]byte, maxZipEntrySize+1))
+	writer.Close()
+	if _, err := flateDecode(bomb.Bytes()); err == nil {
+		t.Error("Expected an error for a stream larger than the limit")
+	}
+
+	if extracted, err := Extract("notes.txt", []byte("plain text")); err != nil || extracted.Text != "plain text" {
+		t.Errorf("Expected plain text to pass through, got %q, %v", extracted.Text, err)
+	}
+}
@@ -0,0 +1,406 @@
+package extractor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	maxFormDepth      = 8   // nesting limit of form XObjects
+	wordGapRatio      = 0.2 // a horizontal gap of this fraction of the font size separates words
+	lineChangeRatio   = 0.5 // a vertical move of this fraction of the font size starts a new line
+	paragraphGapRatio = 1.8 // a line advance of this multiple of the font size starts a new paragraph
+)
+
+// ExtractPDF returns the text of the PDF, the pages are separated by PageBreak.
+// Text is read from the content streams of the pages in drawing order, words and
+// lines are separated by the positions of the glyphs
+func ExtractPDF(content []byte) (string, error) {
+	doc, err := parsePDF(content)
+	if err != nil {
+		return "", fmt.Errorf("pdf_text.go|ExtractPDF: %w", err)
+	}
+
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return "", errors.New("pdf_text.go|ExtractPDF: the PDF has no pages")
+	}
+
+	texts := make([]string, len(pages))
+	hasText := false
+	fonts := make(map[pdfRef]*pdfFont) // fonts are shared by the pages
+	for i, page := range pages {
+		extractor := &pageExtractor{doc: doc, fonts: fonts}
+		extractor.run(doc.pageContent(page.dict), page.resources, identityMatrix, 0)
+
+		texts[i] = strings.TrimSpace(extractor.out.String())
+		hasText = hasText || texts[i] != ""
+	}
+
+	if !hasText {
+		return "", errors.New("pdf_text.go|ExtractPDF: the PDF contains no extractable text, it may be scanned")
+	}
+
+	return strings.Join(texts, "\n"+PageBreak+"\n"), nil
+}
+
+// pdfPage is a page dictionary with the resources it inherits from the page tree
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages returns the pages in the order of the page tree. Without a usable
+// catalog, every page object is returned in the order of the object numbers
+func (doc *pdfDocument) pages() []pdfPage {
+	var pages []pdfPage
+	visited := make(map[any]bool)
+
+	var walk func(node any, resources pdfDict)
+	walk = func(node any, resources pdfDict) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+
+		dict := doc.dict(node)
+		if dict == nil {
+			return
+		}
+		if own := doc.dict(dict["Resources"]); own != nil {
+			resources = own
+		}
+
+		if kids := doc.array(dict["Kids"]); kids != nil || doc.name(dict["Type"]) == "Pages" {
+			for _, kid := range kids {
+				walk(kid, resources)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{dict: dict, resources: resources})
+	}
+
+	catalog := doc.dict(doc.trailer["Root"])
+	if catalog == nil {
+		for _, num := range doc.sortedObjectNumbers() {
+			if dict := doc.dict(doc.objects[num]); doc.name(dict["Type"]) == "Catalog" {
+				catalog = dict
+				break
+			}
+		}
+	}
+	if catalog != nil {
+		walk(catalog["Pages"], nil)
+	}
+
+	if len(pages) == 0 {
+		for _, num := range doc.sortedObjectNumbers() {
+			if dict := doc.dict(doc.objects[num]); doc.name(dict["Type"]) == "Page" {
+				pages = append(pages, pdfPage{dict: dict, resources: doc.dict(dict["Resources"])})
+			}
+		}
+	}
+
+	return pages
+}
+
+// pageContent returns the decoded content stream of the page
+func (doc *pdfDocument) pageContent(page pdfDict) []byte {
+	streams := doc.array(page["Contents"])
+	if streams == nil {
+		streams = []any{page["Contents"]}
+	}
+
+	// the streams of an array are one content stream split at arbitrary token boundaries
+	var joined []byte
+	for _, ref := range streams {
+		stream := doc.stream(ref)
+		if stream == nil {
+			continue
+		}
+		data, err := doc.decodeStream(stream)
+		if err != nil {
+			continue
+		}
+		joined = append(joined, data...)
+		joined = append(joined, '\n')
+	}
+
+	return joined
+}
+
+// matrix is a PDF transformation matrix [a b c d e f]
+type matrix [6]float64
+
+var identityMatrix = matrix{1, 0, 0, 1, 0, 0}
+
+// multiply returns m × n
+func (m matrix) multiply(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translation(x float64, y float64) matrix {
+	return matrix{1, 0, 0, 1, x, y}
+}
+
+// textState holds the text parameters of the graphics state
+type textState struct {
+	font        *pdfFont
+	fontSize    float64
+	charSpacing float64
+	wordSpacing float64
+	scale       float64 // horizontal scaling, 1 is 100 %
+	leading     float64
+	rise        float64
+}
+
+// graphicsState is the part of the graphics state saved by q and restored by Q
+type graphicsState struct {
+	ctm  matrix
+	text textState
+}
+
+// pageExtractor runs the content streams of a page and writes the shown text
+type pageExtractor struct {
+	doc   *pdfDocument
+	fonts map[pdfRef]*pdfFont
+	out   strings.Builder
+
+	hasLast  bool
+	lastX    float64 // end of the last glyph in device space
+	lastY    float64
+	lastSize float64
+}
+
+// run interprets a content stream with the given resources and current transformation matrix
+func (p *pageExtractor) run(content []byte, resources pdfDict, ctm matrix, depth int) {
+	state := graphicsState{ctm: ctm, text: textState{scale: 1}}
+	var stack []graphicsState
+	var tm, lm matrix
+
+	lexer := &pdfLexer{data: content}
+	var operands []any
+
+	for {
+		token, err := lexer.readObject()
+		if err != nil {
+			return // the end of the stream, or a broken stream that is read as far as possible
+		}
+
+		op, ok := token.(pdfKeyword)
+		if !ok {
+			operands = append(operands, token)
+			continue
+		}
+
+		number := func(i int) float64 {
+			if i < len(operands) {
+				return p.doc.float(operands[i])
+			}
+			return 0
+		}
+
+		switch op {
+		case "q":
+			stack = append(stack, state)
+		case "Q":
+			if len(stack) > 0 {
+				state = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if len(operands) == 6 {
+				state.ctm = matrix{number(0), number(1), number(2), number(3), number(4), number(5)}.multiply(state.ctm)
+			}
+		case "BT":
+			tm, lm = identityMatrix, identityMatrix
+		case "Tc":
+			state.text.charSpacing = number(0)
+		case "Tw":
+			state.text.wordSpacing = number(0)
+		case "Tz":
+			state.text.scale = number(0) / 100
+		case "TL":
+			state.text.leading = number(0)
+		case "Ts":
+			state.text.rise = number(0)
+		case "Tf":
+			if len(operands) == 2 {
+				state.text.font = p.font(resources, p.doc.name(operands[0]))
+				state.text.fontSize = number(1)
+			}
+		case "Td", "TD":
+			if op == "TD" {
+				state.text.leading = -number(1)
+			}
+			lm = translation(number(0), number(1)).multiply(lm)
+			tm = lm
+		case "Tm":
+			if len(operands) == 6 {
+				lm = matrix{number(0), number(1), number(2), number(3), number(4), number(5)}
+				tm = lm
+			}
+		case "T*":
+			lm = translation(0, -state.text.leading).multiply(lm)
+			tm = lm
+		case "Tj", "'", "\"":
+			if op != "Tj" {
+				if op == "\"" && len(operands) == 3 {
+					state.text.wordSpacing, state.text.charSpacing = number(0), number(1)
+				}
+				lm = translation(0, -state.text.leading).multiply(lm)
+				tm = lm
+			}
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].([]byte); ok {
+					tm = p.show(s, tm, &state)
+				}
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				for _, element := range p.doc.array(operands[0]) {
+					switch v := element.(type) {
+					case []byte:
+						tm = p.show(v, tm, &state)
+					case int64, float64:
+						adjust := -p.doc.float(v) / 1000 * state.text.fontSize * state.text.scale
+						tm = translation(adjust, 0).multiply(tm)
+					}
+				}
+			}
+		case "Do":
+			if len(operands) > 0 && depth < maxFormDepth {
+				p.runForm(resources, p.doc.name(operands[0]), state.ctm, depth)
+			}
+		case "BI":
+			lexer.skipInlineImage()
+		}
+
+		operands = operands[:0]
+	}
+}
+
+// runForm runs the content of a form XObject
+func (p *pageExtractor) runForm(resources pdfDict, name pdfName, ctm matrix, depth int) {
+	stream := p.doc.stream(p.doc.dict(resources["XObject"])[name])
+	if stream == nil || p.doc.name(stream.dict["Subtype"]) != "Form" {
+		return
+	}
+
+	data, err := p.doc.decodeStream(stream)
+	if err != nil {
+		return
+	}
+
+	formMatrix := identityMatrix
+	if values := p.doc.array(stream.dict["Matrix"]); len(values) == 6 {
+		for i, value := range values {
+			formMatrix[i] = p.doc.float(value)
+		}
+	}
+
+	formResources := resources
+	if own := p.doc.dict(stream.dict["Resources"]); own != nil {
+		formResources = own
+	}
+
+	p.run(data, formResources, formMatrix.multiply(ctm), depth+1)
+}
+
+// font returns the font of the resources with the given name, referenced fonts are loaded once
+func (p *pageExtractor) font(resources pdfDict, name pdfName) *pdfFont {
+	value := p.doc.dict(resources["Font"])[name]
+	ref, isRef := value.(pdfRef)
+	if font, ok := p.fonts[ref]; ok && isRef {
+		return font
+	}
+
+	fontDict := p.doc.dict(value)
+	if fontDict == nil {
+		return nil
+	}
+
+	font := p.doc.loadFont(fontDict)
+	if isRef {
+		p.fonts[ref] = font
+	}
+	return font
+}
+
+// show writes the glyphs of the string at their positions and returns the advanced text matrix
+func (p *pageExtractor) show(s []byte, tm matrix, state *graphicsState) matrix {
+	text := state.text
+	if text.font == nil {
+		return tm
+	}
+
+	for _, glyph := range text.font.decode(s) {
+		trm := matrix{text.fontSize * text.scale, 0, 0, text.fontSize, 0, text.rise}.multiply(tm).multiply(state.ctm)
+
+		advance := glyph.width/1000*text.fontSize + text.charSpacing
+		if glyph.isSpace {
+			advance += text.wordSpacing
+		}
+		advance *= text.scale
+
+		tm = translation(advance, 0).multiply(tm)
+		end := translation(0, text.rise).multiply(tm).multiply(state.ctm)
+
+		size := math.Hypot(trm[2], trm[3])
+		p.write(glyph.text, trm[4], trm[5], end[4], size)
+	}
+
+	return tm
+}
+
+// write appends the text of a glyph drawn at x, y, separating it from the previous
+// glyph by a new line, a blank line or a space depending on their distance
+func (p *pageExtractor) write(text string, x float64, y float64, endX float64, size float64) {
+	if text == "" {
+		return
+	}
+	if size <= 0 {
+		size = 1
+	}
+
+	if p.hasLast {
+		lineSize := max(size, p.lastSize)
+		switch drop := p.lastY - y; {
+		case math.Abs(drop) > lineChangeRatio*lineSize:
+			if drop > paragraphGapRatio*lineSize || drop < 0 {
+				p.out.WriteString("\n\n")
+			} else {
+				p.out.WriteString("\n")
+			}
+		case x-p.lastX > wordGapRatio*lineSize && !strings.HasSuffix(p.out.String(), " ") && !strings.HasPrefix(text, " "):
+			p.out.WriteString(" ")
+		}
+	}
+
+	p.out.WriteString(text)
+	p.hasLast, p.lastX, p.lastY, p.lastSize = true, endX, y, size
+}
+
+// skipInlineImage skips the data of an inline image up to and including its EI operator
+func (l *pdfLexer) skipInlineImage() {
+	for l.pos+2 < len(l.data) {
+		if l.pos > 0 && l.data[l.pos] == 'E' && l.data[l.pos+1] == 'I' && isPDFSpace(l.data[l.pos-1]) &&
+			(l.pos+2 == len(l.data) || isPDFSpace(l.data[l.pos+2])) {
+			l.pos += 2
+			return
+		}
+		l.pos++
+	}
+	l.pos = len(l.data)
+}
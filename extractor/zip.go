@@ -0,0 +1,80 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// maxZipEntrySize limits the decompressed size of a single file of a ZIP container
+const maxZipEntrySize = 64 << 20
+
+// zipArchive holds the files of a ZIP container (EPUB, DOCX, ODT) by their names
+type zipArchive map[string]*zip.File
+
+// openZip returns the files of the ZIP container
+func openZip(content []byte) (zipArchive, error) {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("not a ZIP container: %w", err)
+	}
+
+	files := make(zipArchive, len(reader.File))
+	for _, file := range reader.File {
+		files[file.Name] = file
+	}
+	return files, nil
+}
+
+// hasZipMimetype reports whether the content is a ZIP container declaring the mimetype,
+// which EPUB and OpenDocument files store uncompressed as their first file
+func hasZipMimetype(content []byte, mimetype string) bool {
+	return bytes.HasPrefix(content, []byte("PK\x03\x04")) &&
+		bytes.Contains(content[:min(len(content), 100)], []byte(mimetype))
+}
+
+// hasZipFile reports whether the content is a ZIP container with the named file
+func hasZipFile(content []byte, name string) bool {
+	if !bytes.HasPrefix(content, []byte("PK\x03\x04")) {
+		return false
+	}
+	files, err := openZip(content)
+	return err == nil && files[name] != nil
+}
+
+// read returns the decompressed content of the file of the container
+func (files zipArchive) read(name string) ([]byte, error) {
+	file, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is missing", name)
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxZipEntrySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if len(data) > maxZipEntrySize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, maxZipEntrySize)
+	}
+	return data, nil
+}
+
+// readXML decodes the XML file of the container into v
+func (files zipArchive) readXML(name string, v any) error {
+	data, err := files.read(name)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
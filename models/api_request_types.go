@@ -1,5 +1,21 @@
 package models
 
 type AskRequest struct {
-	Query string `json:"query" validate:"required,min=3"`
+	Query  string        `json:"query" validate:"required,min=3"`
+	Filter PayloadFilter `json:"filter,omitempty"` // restricts the retrieval to the chunks with these payload values, e.g. {"symbol": "NewChunker"}
+}
+
+// RecordSettings names the fields of the records of a JSON, JSONL or CSV file
+type RecordSettings struct {
+	TextFields     []string `json:"textFields"`        // embedded, several fields are joined as "field: value" lines
+	MetadataFields []string `json:"metadataFields"`    // stored as filterable payload values
+	IDField        string   `json:"idField,omitempty"` // the record ID, defaults to the position of the record
+}
+
+// IngestURLRequest is the body of /api/ingest/url, the URL is a web page or a sitemap.xml
+type IngestURLRequest struct {
+	URL      string `json:"url"`
+	Depth    int    `json:"depth"`              // links followed from the start pages, 0 stores only the page or the pages of the sitemap
+	SameHost *bool  `json:"sameHost,omitempty"` // follows only links to the host of the URL, true if not set
+	MaxPages int    `json:"maxPages,omitempty"` // defaults to crawler.max_pages and can not exceed it
 }
@@ -1,6 +1,58 @@
 package models
 
 type Chunk struct {
-	ID   int    `json:"chunkID"`
-	Text string `json:"text"`
+	ID         int            `json:"chunkID"`
+	Text       string         `json:"text"`
+	DocumentID string         `json:"documentID,omitempty"`
+	Metadata   map[string]any `json:"metadata,omitempty"` // written into the vector db payload
+	Span       *Span          `json:"span,omitempty"`     // where the chunk is in the source document, nil if unknown
+}
+
+// Span is the position of a text in its source document. Offsets are byte offsets,
+// End is exclusive, lines start at 1
+type Span struct {
+	StartOffset int `json:"startOffset"`
+	EndOffset   int `json:"endOffset"`
+	StartLine   int `json:"startLine"`
+	EndLine     int `json:"endLine"`
+}
+
+// ChunkSettings selects the chunking strategy and its parameters
+type ChunkSettings struct {
+	Strategy   string   `yaml:"strategy" json:"strategy"` // "word", "sentence", "paragraph", "recursive", "markdown", "semantic" or "go"
+	Size       int      `yaml:"size" json:"size"`
+	Overlap    int      `yaml:"overlap" json:"overlap"`
+	Unit       string   `yaml:"unit" json:"unit"`                       // "words" or "tokens" of the configured tokenizer, "word", "recursive", "markdown" and "semantic" only
+	Separators []string `yaml:"separators" json:"separators,omitempty"` // "recursive" only, tried in order
+
+	BreakpointPercentile float64 `yaml:"breakpoint_percentile" json:"breakpointPercentile,omitempty"` // "semantic" only
+	MinSize              int     `yaml:"min_size" json:"minSize,omitempty"`                           // "semantic" only, Size is the maximum
+}
+
+// ChunkPreview is the result of a chunking dry run, nothing of it is embedded or stored
+type ChunkPreview struct {
+	Settings ChunkSettings  `json:"settings"`
+	Chunks   []PreviewChunk `json:"chunks"`
+	Stats    ChunkStats     `json:"stats"`
+	Warnings []string       `json:"warnings,omitempty"` // e.g. semantic chunks that fell back to size based chunks
+}
+
+// PreviewChunk is a chunk of a preview with its size
+type PreviewChunk struct {
+	Chunk
+	Words  int `json:"words"`
+	Tokens int `json:"tokens"` // tokens of the configured tokenizer
+}
+
+// ChunkStats summarizes the sizes of the chunks of a preview
+type ChunkStats struct {
+	ChunkCount  int     `json:"chunkCount"`
+	TotalWords  int     `json:"totalWords"`
+	MinWords    int     `json:"minWords"`
+	MaxWords    int     `json:"maxWords"`
+	AvgWords    float64 `json:"avgWords"`
+	TotalTokens int     `json:"totalTokens"`
+	MinTokens   int     `json:"minTokens"`
+	MaxTokens   int     `json:"maxTokens"`
+	AvgTokens   float64 `json:"avgTokens"`
 }
@@ -7,12 +7,27 @@ type Config struct {
 	} `yaml:"base_api"`
 
 	Chunk struct {
-		Size    int `yaml:"size"`
-		Overlap int `yaml:"overlap"`
+		ChunkSettings `yaml:",inline"`
+		Collections   map[string]ChunkSettings `yaml:"collections"` // per collection overrides
 	} `yaml:"chunk"`
 
+	Normalization NormalizationSettings `yaml:"normalization"`
+
+	ContextualHeaders struct {
+		Enabled           bool `yaml:"enabled"`
+		SummaryInputChars int  `yaml:"summary_input_chars"` // beginning of the document the summary is generated from
+	} `yaml:"contextual_headers"`
+
+	VectorStore string `yaml:"vector_store"` // "qdrant", "memory" or "local"
+
 	Retrieval struct {
-		TopK int `yaml:"top_k"`
+		TopK            int `yaml:"top_k"`
+		ExpandNeighbors int `yaml:"expand_neighbors"`
+		ParentChild     struct {
+			Enabled      bool `yaml:"enabled"`
+			ChildSize    int  `yaml:"child_size"`
+			ChildOverlap int  `yaml:"child_overlap"`
+		} `yaml:"parent_child"`
 	} `yaml:"retrieval"`
 
 	Qdrant struct {
@@ -20,12 +35,26 @@ type Config struct {
 		Port int    `yaml:"port"`
 	} `yaml:"qdrant"`
 
+	LocalStore struct {
+		M              int `yaml:"m"`
+		EfConstruction int `yaml:"ef_construction"`
+		EfSearch       int `yaml:"ef_search"`
+	} `yaml:"local_store"`
+
 	Embedding struct {
 		ModelDimension int    `yaml:"model_dimension"`
 		ModelName      string `yaml:"model_name"`
 		Endpoint       string `yaml:"endpoint"`
+		MaxTokens      int    `yaml:"max_tokens"`
+		BatchSize      int    `yaml:"batch_size"` // chunks per embedding request, 0 sends all chunks of a document at once
 	} `yaml:"embedding"`
 
+	Tokenizer struct {
+		Type      string `yaml:"type"`
+		VocabPath string `yaml:"vocab_path"`
+		Lowercase bool   `yaml:"lowercase"`
+	} `yaml:"tokenizer"`
+
 	Ollama struct {
 		BaseURL string `yaml:"base_url"`
 	} `yaml:"ollama"`
@@ -35,6 +64,33 @@ type Config struct {
 		Endpoint  string `yaml:"endpoint"`
 	} `yaml:"generator"`
 
+	Watcher struct {
+		Enabled  bool   `yaml:"enabled"`
+		Dir      string `yaml:"dir"`      // files dropped here are stored into the API collection
+		Interval int    `yaml:"interval"` // seconds between two scans of the folder
+	} `yaml:"watcher"`
+
+	Crawler struct {
+		UserAgent         string  `yaml:"user_agent"`          // sent with every request and matched against the robots.txt groups
+		MaxDepth          int     `yaml:"max_depth"`           // largest depth of a request
+		MaxPages          int     `yaml:"max_pages"`           // pages stored by one request at most
+		RequestsPerSecond float64 `yaml:"requests_per_second"` // per host, a longer Crawl-delay of the robots.txt wins
+		Timeout           int     `yaml:"timeout"`             // seconds per request
+		MaxPageSize       int     `yaml:"max_page_size"`       // bytes, larger pages are not stored
+	} `yaml:"crawler"`
+
+	Streaming struct {
+		MinSize int64 `yaml:"min_size"` // plain text uploads of at least this many bytes are streamed, 0 streams none
+	} `yaml:"streaming"`
+
+	Jobs struct {
+		Workers int `yaml:"workers"` // background ingest jobs processed at the same time
+	} `yaml:"jobs"`
+
+	Storage struct {
+		DataDir string `yaml:"data_dir"`
+	} `yaml:"storage"`
+
 	Evaluation struct {
 		RetrievalDataPath  string `yaml:"retrieval_data_path"`
 		GenerationDataPath string `yaml:"generation_data_path"`
@@ -42,3 +98,19 @@ type Config struct {
 		CollectionName     string `yaml:"collection_name"`
 	} `yaml:"evaluation"`
 }
+
+// NormalizationSettings switches the cleaning rules applied to a document before it is chunked
+type NormalizationSettings struct {
+	NFKC                 bool          `yaml:"nfkc"`                    // Unicode compatibility composition: ligatures, non-breaking spaces, full width forms
+	RemoveControlChars   bool          `yaml:"remove_control_chars"`    // control and invisible format characters except newlines and tabs
+	Dehyphenate          bool          `yaml:"dehyphenate"`             // joins words hyphenated across a line break
+	RemoveRepeatedLines  bool          `yaml:"remove_repeated_lines"`   // page headers, footers and boilerplate
+	RepeatedLineMinCount int           `yaml:"repeated_line_min_count"` // a line occurring this often is removed, digits are ignored when comparing
+	Filters              []RegexFilter `yaml:"filters"`                 // applied in order after the rules above
+}
+
+// RegexFilter replaces every match of Pattern with Replacement, which may refer to groups as $1
+type RegexFilter struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"`
+}
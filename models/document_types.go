@@ -0,0 +1,41 @@
+package models
+
+import (
+	"io"
+	"time"
+)
+
+type Document struct {
+	ID          string         `json:"id"`
+	Filename    string         `json:"filename"`
+	Size        int            `json:"size"`
+	ChunkCount  int            `json:"chunkCount"`
+	ContentHash string         `json:"contentHash"`
+	IngestedAt  time.Time      `json:"ingestedAt"`
+	Metadata    map[string]any `json:"metadata,omitempty"` // e.g. the title and canonical URL of a web page
+	Origin      string         `json:"origin,omitempty"`   // "watcher" for the files of the watched folder, empty for uploads
+}
+
+// ExtractedDocument is the plain text of an uploaded file and the metadata found in it
+type ExtractedDocument struct {
+	Text     string
+	Metadata map[string]any
+	Chapters []string // titles of the chapters of an e-book, the chapters of Text are separated by page breaks
+}
+
+// Upload is a file sent to the storebook endpoint
+type Upload struct {
+	Filename string
+	Content  []byte
+	File     io.ReadSeeker // read instead of Content if set, e.g. the temporary file of a form upload
+	Size     int64         // size of File
+}
+
+// StoreResult is the outcome of storing one uploaded file or one file of an uploaded archive
+type StoreResult struct {
+	Filename   string `json:"filename"`
+	Status     string `json:"status"` // "stored", "skipped" or "failed", a file of a job may also be "queued" or "cancelled"
+	DocumentID string `json:"documentId,omitempty"`
+	ChunkCount int    `json:"chunkCount,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Job is a background ingest of the files of one storebook request
+type Job struct {
+	ID           string        `json:"id"`
+	State        string        `json:"state"` // "queued", "running", "completed", "failed" or "cancelled"
+	Files        []StoreResult `json:"files"` // the status of a file is "queued" until it is processed
+	Progress     JobProgress   `json:"progress"`
+	StoredChunks int           `json:"storedChunks,omitempty"` // chunks of the file in progress already stored, a resumed job does not embed them again
+	Error        string        `json:"error,omitempty"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	UpdatedAt    time.Time     `json:"updatedAt"`
+}
+
+// JobProgress counts the processed files and the embedded chunks of a job. The chunk total
+// grows while the job runs, the chunks of a file are known once the file is chunked
+type JobProgress struct {
+	FilesDone      int `json:"filesDone"`
+	FilesTotal     int `json:"filesTotal"`
+	ChunksEmbedded int `json:"chunksEmbedded"`
+	ChunksTotal    int `json:"chunksTotal"`
+}
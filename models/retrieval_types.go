@@ -1,7 +1,24 @@
 package models
 
 type RetrievalResult struct {
-	ChunkID int
-	Text    string
-	Score   float32 // Cosine similarity score
+	ChunkID    int
+	DocumentID string
+	Text       string
+	Score      float32        // Cosine similarity score
+	Metadata   map[string]any // remaining payload fields of the chunk
+	Span       *Span          // nil for chunks stored without a span
+}
+
+// PayloadFilter matches the points whose payload values equal all of the given values
+type PayloadFilter map[string]any
+
+// ContextPassage is a piece of retrieved context that is sent to the generator
+type ContextPassage struct {
+	DocumentID      string         `json:"documentID"`
+	Text            string         `json:"text"`               // the text the generator sees
+	MatchedChunkIDs []int          `json:"matchedChunkIDs"`    // chunks of the passage returned by the vector search
+	ParentID        *int           `json:"parentID,omitempty"` // set when the matched child chunks were resolved to their parent
+	Score           float32        `json:"score"`              // best score of the matched chunks
+	Metadata        map[string]any `json:"metadata,omitempty"`
+	Span            *Span          `json:"span,omitempty"` // where the passage text is in the source document
 }
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+	"rag-pipeline/extractor"
+	"rag-pipeline/models"
+)
+
+// PreviewChunks returns the chunks the given settings would store for the file, with their
+// sizes and statistics. Nothing is embedded or stored, only the "semantic" strategy calls
+// the embedding model to find its breakpoints
+func (r *RAGService) PreviewChunks(filename string, content []byte, settings models.ChunkSettings) (*models.ChunkPreview, error) {
+	chunker, err := NewChunker(settings, r.Tokenizer, r.Embedder)
+	if err != nil {
+		return nil, fmt.Errorf("chunk_preview.go|PreviewChunks: %w", err)
+	}
+
+	preview := &models.ChunkPreview{
+		Settings: settings,
+		Chunks:   []models.PreviewChunk{},
+	}
+
+	extracted, err := extractor.Extract(filename, content)
+	if err != nil {
+		return nil, fmt.Errorf("chunk_preview.go|PreviewChunks: %w", err)
+	}
+
+	fallback := false
+	for _, chunk := range r.chunkDocument(chunker, filename, extracted) {
+		preview.Chunks = append(preview.Chunks, models.PreviewChunk{
+			Chunk:  chunk,
+			Words:  wordCount(chunk.Text),
+			Tokens: r.Tokenizer.CountTokens(chunk.Text),
+		})
+		_, ok := chunk.Metadata["chunking_fallback"]
+		fallback = fallback || ok
+	}
+	preview.Stats = chunkStats(preview.Chunks)
+
+	if fallback {
+		preview.Warnings = append(preview.Warnings, "the sentences could not be embedded, the chunks are only bounded by the size and not split at semantic breakpoints")
+	}
+
+	return preview, nil
+}
+
+// chunkStats returns the count, total, minimum, maximum and average sizes of the chunks
+func chunkStats(chunks []models.PreviewChunk) models.ChunkStats {
+	stats := models.ChunkStats{ChunkCount: len(chunks)}
+	if len(chunks) == 0 {
+		return stats
+	}
+
+	stats.MinWords, stats.MinTokens = chunks[0].Words, chunks[0].Tokens
+	for _, chunk := range chunks {
+		stats.TotalWords += chunk.Words
+		stats.TotalTokens += chunk.Tokens
+		stats.MinWords = min(stats.MinWords, chunk.Words)
+		stats.MaxWords = max(stats.MaxWords, chunk.Words)
+		stats.MinTokens = min(stats.MinTokens, chunk.Tokens)
+		stats.MaxTokens = max(stats.MaxTokens, chunk.Tokens)
+	}
+	stats.AvgWords = float64(stats.TotalWords) / float64(len(chunks))
+	stats.AvgTokens = float64(stats.TotalTokens) / float64(len(chunks))
+
+	return stats
+}
@@ -1,125 +1,381 @@
 package services
 
 import (
+	"fmt"
 	"log"
 	"rag-pipeline/models"
+	"rag-pipeline/utils"
 	"strings"
+	"unicode"
 )
 
-type ChunkConfig struct {
+// Chunker splits a text into chunks
+type Chunker interface {
+	ChunkText(text string) []models.Chunk
+}
+
+// FileChunker is implemented by the chunkers whose chunks record the path of their file
+type FileChunker interface {
+	ChunkFile(path string, text string) []models.Chunk
+}
+
+// NewChunker creates and returns the chunker selected by settings.Strategy.
+// The tokenizer measures the chunk size when settings.Unit is "tokens",
+// the embedder finds the breakpoints of the "semantic" strategy
+func NewChunker(settings models.ChunkSettings, tokenizer Tokenizer, embedder Embedder) (Chunker, error) {
+	if settings.Size <= 0 {
+		return nil, fmt.Errorf("chunker.go|NewChunker: chunk size must be positive, got %d", settings.Size)
+	}
+	if settings.Overlap < 0 || settings.Overlap >= settings.Size {
+		return nil, fmt.Errorf("chunker.go|NewChunker: chunk overlap must be in [0, %d), got %d", settings.Size, settings.Overlap)
+	}
+
+	switch settings.Unit {
+	case "", "words":
+		tokenizer = nil
+	case "tokens":
+		if settings.Strategy == "sentence" || settings.Strategy == "paragraph" {
+			return nil, fmt.Errorf("chunker.go|NewChunker: unit \"tokens\" is not supported by the %q strategy", settings.Strategy)
+		}
+	default:
+		return nil, fmt.Errorf("chunker.go|NewChunker: unknown chunk unit %q", settings.Unit)
+	}
+
+	switch settings.Strategy {
+	case "", "word":
+		chunker := NewWordChunker(settings.Size, settings.Overlap)
+		chunker.Tokenizer = tokenizer
+		return chunker, nil
+	case "sentence":
+		return NewSentenceChunker(settings.Size, settings.Overlap), nil
+	case "paragraph":
+		return NewParagraphChunker(settings.Size, settings.Overlap), nil
+	case "recursive":
+		chunker := NewRecursiveChunker(settings.Size, settings.Overlap, settings.Separators)
+		if tokenizer != nil {
+			chunker.Length = tokenizer.CountTokens
+		}
+		return chunker, nil
+	case "markdown":
+		chunker := NewMarkdownChunker(settings.Size)
+		chunker.Tokenizer = tokenizer
+		return chunker, nil
+	case "go":
+		fallback := NewRecursiveChunker(settings.Size, settings.Overlap, settings.Separators)
+		if tokenizer != nil {
+			fallback.Length = tokenizer.CountTokens
+		}
+		return NewGoChunker(fallback), nil
+	case "semantic":
+		chunker, err := NewSemanticChunker(embedder, settings.BreakpointPercentile, settings.MinSize, settings.Size)
+		if err != nil {
+			return nil, fmt.Errorf("chunker.go|NewChunker: %w", err)
+		}
+		chunker.Tokenizer = tokenizer
+		return chunker, nil
+	default:
+		return nil, fmt.Errorf("chunker.go|NewChunker: unknown chunk strategy %q", settings.Strategy)
+	}
+}
+
+// ChunkSettingsFor returns the chunk settings of the collection:
+// the defaults of config.Chunk with the collection overrides applied
+func ChunkSettingsFor(config *models.Config, collectionName string) models.ChunkSettings {
+	settings := config.Chunk.ChunkSettings
+
+	override, ok := config.Chunk.Collections[collectionName]
+	if !ok {
+		return settings
+	}
+
+	if override.Strategy != "" {
+		settings.Strategy = override.Strategy
+	}
+	if override.Size > 0 {
+		settings.Size = override.Size
+	}
+	// a collection that sets its own size also owns its overlap, even if that is 0
+	if override.Overlap > 0 || override.Size > 0 {
+		settings.Overlap = override.Overlap
+	}
+	if override.Unit != "" {
+		settings.Unit = override.Unit
+	}
+	if len(override.Separators) > 0 {
+		settings.Separators = override.Separators
+	}
+	if override.BreakpointPercentile > 0 {
+		settings.BreakpointPercentile = override.BreakpointPercentile
+	}
+	if override.MinSize > 0 {
+		settings.MinSize = override.MinSize
+	}
+
+	return settings
+}
+
+// WordChunker splits the text into fixed size word windows
+type WordChunker struct {
 	ChunkSize    int
 	ChunkOverlap int
+	Tokenizer    Tokenizer // if set, size and overlap count tokens instead of words
 }
 
-// NewChunker creates and returns a new ChunkConfig
-func NewChunker(chunkSize int, chunkOverlap int) *ChunkConfig {
-	return &ChunkConfig{
+// NewWordChunker creates and returns a new WordChunker
+func NewWordChunker(chunkSize int, chunkOverlap int) *WordChunker {
+	return &WordChunker{
 		ChunkSize:    chunkSize,
 		ChunkOverlap: chunkOverlap,
 	}
 }
 
-// ChunkText splits the input text into chunks based on the config.Chunk
-func (config ChunkConfig) ChunkText(text string) []models.Chunk {
+// ChunkText splits the input text into chunks of ChunkSize words, consecutive chunks share ChunkOverlap words
+func (config WordChunker) ChunkText(text string) []models.Chunk {
 	log.Println("Chunking is started...")
-	words := strings.Fields(text)
+	words := textWords(text, 0)
 	log.Printf(" Document length: %d words", len(words))
 
+	var chunks []models.Chunk
+	if config.Tokenizer != nil {
+		chunks = tokenWindow(words, config.Tokenizer, config.ChunkSize, config.ChunkOverlap)
+	} else {
+		chunks = slidingWindow(words, config.ChunkSize, config.ChunkOverlap, " ")
+	}
+	setLines(text, chunks)
+
+	log.Printf(" Chunk size: %d", len(chunks))
+	log.Println("Exiting ChunkText")
+	return chunks
+}
+
+// textUnit is a word, sentence or paragraph of the chunked text and its byte offsets in it.
+// The text of a unit may differ from the bytes between the offsets in its whitespace
+type textUnit struct {
+	text       string
+	start, end int
+}
+
+// textWords returns the whitespace separated words of the text, their offsets are shifted by offset
+func textWords(text string, offset int) []textUnit {
+	var words []textUnit
+	start := -1
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				words = append(words, textUnit{text: text[start:i], start: offset + start, end: offset + i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, textUnit{text: text[start:], start: offset + start, end: offset + len(text)})
+	}
+	return words
+}
+
+// trimSpan returns the offsets of text[start:end] without its leading and trailing whitespace
+func trimSpan(text string, start int, end int) (int, int) {
+	trimmed := strings.TrimLeftFunc(text[start:end], unicode.IsSpace)
+	start = end - len(trimmed)
+	return start, start + len(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+}
+
+// unitSpan returns the span from the start of the first to the end of the last unit,
+// the lines are set by setLines
+func unitSpan(units []textUnit) *models.Span {
+	return &models.Span{StartOffset: units[0].start, EndOffset: units[len(units)-1].end}
+}
+
+// joinUnits joins the texts of the units with sep
+func joinUnits(units []textUnit, sep string) string {
+	texts := make([]string, len(units))
+	for i, unit := range units {
+		texts[i] = unit.text
+	}
+	return strings.Join(texts, sep)
+}
+
+// slidingWindow groups the units into windows of size units, consecutive windows share overlap units.
+// The units of a window are joined with sep, the window spans from its first to its last unit
+func slidingWindow(units []textUnit, size int, overlap int, sep string) []models.Chunk {
 	var chunks []models.Chunk
 	chunkID := 0
 
-	for i := 0; i < len(words); i += (config.ChunkSize - config.ChunkOverlap) {
+	for i := 0; i < len(units); i += (size - overlap) {
 
-		end := i + config.ChunkSize
+		end := i + size
 
 		//for last chunk
-		if end > len(words) {
-			end = len(words)
+		if end > len(units) {
+			end = len(units)
 		}
 
-		chunk := strings.Join(words[i:end], " ")
+		chunk := joinUnits(units[i:end], sep)
 
-		chunks = append(chunks, models.Chunk{ID: chunkID, Text: chunk})
+		chunks = append(chunks, models.Chunk{ID: chunkID, Text: chunk, Span: unitSpan(units[i:end])})
 		chunkID += 1
 
-		if end == len(words) {
+		if end == len(units) {
 			break
 		}
 	}
 
-	//utils.StoreChunk(&chunks)
-
-	log.Printf(" Chunk size: %d", len(chunks))
-	log.Println("Exiting ChunkText")
 	return chunks
 }
 
-// I do not delete them, maybe we will use them again
-/*
-	for i := 0; i < len(words); i += (config.ChunkSize - config.ChunkOverlap) {
-
-		end := i + config.ChunkSize
+// tokenWindow groups the words into windows of at most size tokens, consecutive windows
+// share the last words of the previous window that fit into overlap tokens.
+// A single word with more than size tokens becomes a window of its own
+func tokenWindow(words []textUnit, tokenizer Tokenizer, size int, overlap int) []models.Chunk {
+	counts := make([]int, len(words))
+	for i, word := range words {
+		counts[i] = tokenizer.CountTokens(word.text)
+	}
 
-		//for last chunk
-		if end > len(words) {
-			end = len(words)
+	var chunks []models.Chunk
+	for start := 0; start < len(words); {
+		end, total := start, 0
+		for end < len(words) && (end == start || total+counts[end] <= size) {
+			total += counts[end]
+			end++
 		}
 
-		chunk := strings.Join(words[i:end], " ")
-
-		chunks = append(chunks, models.Chunk{ID: chunkID, Text: chunk})
-		chunkID += 1
-
+		chunks = append(chunks, models.Chunk{ID: len(chunks), Text: joinUnits(words[start:end], " "), Span: unitSpan(words[start:end])})
 		if end == len(words) {
 			break
 		}
+
+		next, shared := end, 0
+		for next-1 > start && shared+counts[next-1] <= overlap {
+			next--
+			shared += counts[next]
+		}
+		start = next
 	}
-*/
-/*
-	segmenter := sentencizer.NewSegmenter("en")
-	sentences := segmenter.Segment(text)
-	log.Println(len(sentences))
 
-	for i := 0; i < len(sentences); i += (config.ChunkSize - config.ChunkOverlap) {
-		end := i + config.ChunkSize
+	return chunks
+}
 
-		if end > len(sentences) {
-			end = len(sentences)
-		}
+// chunkWords returns the words of the chunk with their offsets in the text the chunk was cut from.
+// Without a span the offsets are those in the chunk text, ok is false then
+func chunkWords(text string, chunk models.Chunk) (words []textUnit, ok bool) {
+	if chunk.Span == nil {
+		return textWords(chunk.Text, 0), false
+	}
+	return textWords(text[chunk.Span.StartOffset:chunk.Span.EndOffset], chunk.Span.StartOffset), true
+}
 
-		chunk := strings.Join(sentences[i:end], " ")
-		chunks = append(chunks, models.Chunk{ID: chunkID, Text: chunk})
-		chunkID += 1
+// splitOversizedChunks re-splits every chunk with more than maxTokens tokens into
+// token windows that fit and renumbers the chunks. The spans of the windows are cut from
+// the span of the chunk in text. A maxTokens of 0 disables the check
+func splitOversizedChunks(text string, chunks []models.Chunk, tokenizer Tokenizer, maxTokens int) []models.Chunk {
+	if maxTokens <= 0 {
+		return chunks
+	}
 
-		if end == len(sentences) {
-			break
+	var result []models.Chunk
+	for _, chunk := range chunks {
+		tokens := tokenizer.CountTokens(chunk.Text)
+		if tokens <= maxTokens {
+			chunk.ID = len(result)
+			result = append(result, chunk)
+			continue
+		}
+
+		log.Printf("chunker.go|splitOversizedChunks: chunk %d has %d tokens, the limit is %d, re-splitting", chunk.ID, tokens, maxTokens)
+		words, located := chunkWords(text, chunk)
+		parts := tokenWindow(words, tokenizer, maxTokens, 0)
+		setLines(text, parts)
+		for _, part := range parts {
+			part.ID = len(result)
+			part.DocumentID = chunk.DocumentID
+			part.Metadata = chunk.Metadata
+			if !located {
+				part.Span = nil
+			}
+			result = append(result, part)
 		}
-	}
-*/ /*
-	doc, err := prose.NewDocument(text)
-	if err != nil {
-		log.Fatalf("Error creating document: %v", err)
 	}
 
-	sentences := make([]string, len(doc.Sentences()))
-	for i, s := range doc.Sentences() {
-		sentences[i] = s.Text
+	return result
+}
+
+// splitParentChild splits every parent chunk into word windows of childSize words, the spans
+// of the children are cut from the span of the parent in text. The children are numbered
+// across the document and carry the parent id, the parent text, span and metadata, until
+// takeParents moves the parents out of them for storage
+func splitParentChild(text string, parents []models.Chunk, childSize int, childOverlap int) []models.Chunk {
+	var children []models.Chunk
+	for _, parent := range parents {
+		words, located := chunkWords(text, parent)
+		windows := slidingWindow(words, childSize, childOverlap, " ")
+		setLines(text, windows)
+		for _, child := range windows {
+			child.ID = len(children)
+			child.Metadata = mergeMetadata(parent.Metadata, map[string]any{
+				"parent_id":   parent.ID,
+				"parent_text": parent.Text,
+			})
+			if located {
+				child.Metadata["parent_start_offset"] = parent.Span.StartOffset
+				child.Metadata["parent_end_offset"] = parent.Span.EndOffset
+				child.Metadata["parent_start_line"] = parent.Span.StartLine
+				child.Metadata["parent_end_line"] = parent.Span.EndLine
+			} else {
+				child.Span = nil
+			}
+			children = append(children, child)
+		}
 	}
 
-	var chunks []models.Chunk
-	chunkID := 0
-	for i := 0; i < len(sentences); i += (config.ChunkSize - config.ChunkOverlap) {
-		end := i + config.ChunkSize
+	log.Printf("chunker.go|splitParentChild: %d parents, %d children", len(parents), len(children))
+	return children
+}
 
-		if end > len(sentences) {
-			end = len(sentences)
+// takeParents returns the distinct parents of the children of splitParentChild and removes
+// the parent text and span from the children, so they are stored once and not in every child.
+// The parents have the metadata of their children and their parent id as chunk id
+func takeParents(children []models.Chunk) []models.Chunk {
+	var parents []models.Chunk
+	seen := make(map[int]bool)
+	for i := range children {
+		text, ok := children[i].Metadata["parent_text"].(string)
+		if !ok {
+			continue
 		}
+		metadata := children[i].Metadata
+		children[i].Metadata = make(map[string]any, len(metadata))
 
-		chunk := strings.Join(sentences[i:end], " ")
-		chunks = append(chunks, models.Chunk{ID: chunkID, Text: chunk})
-		chunkID += 1
+		parent := models.Chunk{ID: utils.ToInt(metadata["parent_id"]), Text: text, DocumentID: children[i].DocumentID, Metadata: make(map[string]any)}
+		for key, value := range metadata {
+			if key == "parent_id" || !strings.HasPrefix(key, "parent_") {
+				children[i].Metadata[key] = value
+			}
+			if !strings.HasPrefix(key, "parent_") {
+				parent.Metadata[key] = value
+			}
+		}
+		if seen[parent.ID] {
+			continue
+		}
+		seen[parent.ID] = true
 
-		if end == len(sentences) {
-			break
+		if _, ok := metadata["parent_start_offset"]; ok {
+			parent.Span = &models.Span{
+				StartOffset: utils.ToInt(metadata["parent_start_offset"]),
+				EndOffset:   utils.ToInt(metadata["parent_end_offset"]),
+				StartLine:   utils.ToInt(metadata["parent_start_line"]),
+				EndLine:     utils.ToInt(metadata["parent_end_line"]),
+			}
 		}
-	}*/
+		parents = append(parents, parent)
+	}
+	return parents
+}
+
+// wordCount returns the number of whitespace separated words in the text
+func wordCount(text string) int {
+	return len(strings.Fields(text))
+}
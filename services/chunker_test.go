@@ -0,0 +1,270 @@
+package services
+
+import (
+	"errors"
+	"rag-pipeline/models"
+	"strings"
+	"testing"
+)
+
+func chunkTexts(chunks []models.Chunk) []string {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	return texts
+}
+
+func assertChunks(t *testing.T, got []models.Chunk, want []string) {
+	t.Helper()
+
+	texts := chunkTexts(got)
+	if len(texts) != len(want) {
+		t.Fatalf("Expected %d chunks, got %d: %q", len(want), len(texts), texts)
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			t.Errorf("Chunk %d: expected %q, got %q", i, want[i], texts[i])
+		}
+		if got[i].ID != i {
+			t.Errorf("Chunk %d: expected ID %d, got %d", i, i, got[i].ID)
+		}
+	}
+}
+
+func TestWordChunker(t *testing.T) {
+	chunker := NewWordChunker(4, 1)
+
+	chunks := chunker.ChunkText("one two\nthree  four five six seven")
+	assertChunks(t, chunks, []string{"one two three four", "four five six seven"})
+}
+
+func TestSentenceChunker(t *testing.T) {
+	chunker := NewSentenceChunker(2, 1)
+
+	text := "Dr. Smith went to Washington. He met J. Doe there! Was it fun? Yes."
+	chunks := chunker.ChunkText(text)
+	assertChunks(t, chunks, []string{
+		"Dr. Smith went to Washington. He met J. Doe there!",
+		"He met J. Doe there! Was it fun?",
+		"Was it fun? Yes.",
+	})
+}
+
+func TestParagraphChunker(t *testing.T) {
+	chunker := NewParagraphChunker(2, 0)
+
+	text := "First line\nstill first.\n\n\nSecond.\n  \nThird."
+	chunks := chunker.ChunkText(text)
+	assertChunks(t, chunks, []string{"First line\nstill first.\n\nSecond.", "Third."})
+}
+
+func TestRecursiveChunker(t *testing.T) {
+	chunker := NewRecursiveChunker(6, 2, nil)
+
+	text := "Alpha beta gamma.\n\nDelta epsilon zeta eta theta. Iota kappa lambda mu nu xi omicron."
+	chunks := chunker.ChunkText(text)
+	assertChunks(t, chunks, []string{
+		"Alpha beta gamma.",
+		"Delta epsilon zeta eta theta.",
+		"Iota kappa lambda mu nu xi",
+		"nu xi omicron.",
+	})
+
+	for _, chunk := range chunks {
+		if !strings.Contains(text, chunk.Text) {
+			t.Errorf("Chunk %q is not a substring of the text", chunk.Text)
+		}
+		if wordCount(chunk.Text) > 6 {
+			t.Errorf("Chunk %q exceeds the chunk size", chunk.Text)
+		}
+	}
+}
+
+func TestChunkSettingsFor(t *testing.T) {
+	var config models.Config
+	config.Chunk.Strategy = "word"
+	config.Chunk.Size = 300
+	config.Chunk.Overlap = 55
+	config.Chunk.Collections = map[string]models.ChunkSettings{
+		"eval_collection": {Strategy: "sentence", Size: 5},
+	}
+
+	settings := ChunkSettingsFor(&config, "eval_collection")
+	if settings.Strategy != "sentence" || settings.Size != 5 || settings.Overlap != 0 {
+		t.Errorf("Unexpected override settings: %+v", settings)
+	}
+
+	settings = ChunkSettingsFor(&config, "api_collection")
+	if settings.Strategy != "word" || settings.Size != 300 || settings.Overlap != 55 {
+		t.Errorf("Unexpected default settings: %+v", settings)
+	}
+}
+
+func TestMarkdownChunker(t *testing.T) {
+	chunker := NewMarkdownChunker(12)
+
+	text := "# Academics\n\n## Colleges\n\n### Engineering\n\nThe college has five departments.\n\n" +
+		"```go\n# not a heading\n\nfmt.Println(\"one two three four five six seven eight\")\n```\n\n" +
+		"| Department | Students |\n|---|---|\n| Civil | 300 |\n\n" +
+		"Research\n--------\n\nLabs work on many topics."
+
+	chunks := chunker.ChunkText(text)
+	assertChunks(t, chunks, []string{
+		"### Engineering\n\nThe college has five departments.",
+		"```go\n# not a heading\n\nfmt.Println(\"one two three four five six seven eight\")\n```",
+		"| Department | Students |\n|---|---|\n| Civil | 300 |",
+		"Research\n--------\n\nLabs work on many topics.",
+	})
+
+	wantPaths := []string{
+		"Academics > Colleges > Engineering",
+		"Academics > Colleges > Engineering",
+		"Academics > Colleges > Engineering",
+		"Academics > Research",
+	}
+	for i, chunk := range chunks {
+		if chunk.Metadata["heading_path"] != wantPaths[i] {
+			t.Errorf("Chunk %d: expected heading path %q, got %v", i, wantPaths[i], chunk.Metadata["heading_path"])
+		}
+	}
+}
+
+// topicEmbedder embeds a sentence by the topic words it contains
+type topicEmbedder struct{}
+
+func (topicEmbedder) EmbedChunks(chunks []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(chunks))
+	for i, chunk := range chunks {
+		vector := []float32{0.1, 0.1}
+		if strings.Contains(chunk, "football") {
+			vector[0] = 1
+		}
+		if strings.Contains(chunk, "library") {
+			vector[1] = 1
+		}
+		embeddings[i] = vector
+	}
+	return embeddings, nil
+}
+
+// newSemanticChunker creates a SemanticChunker of valid sizes for the tests
+func newSemanticChunker(t *testing.T, embedder Embedder, breakpointPercentile float64, minSize int, maxSize int) *SemanticChunker {
+	t.Helper()
+	chunker, err := NewSemanticChunker(embedder, breakpointPercentile, minSize, maxSize)
+	if err != nil {
+		t.Fatalf("NewSemanticChunker failed: %v", err)
+	}
+	return chunker
+}
+
+func TestSemanticChunker(t *testing.T) {
+	chunker := newSemanticChunker(t, topicEmbedder{}, 50, 1, 100)
+
+	text := "The football team won. The football stadium is big. The library opened. " +
+		"The library has books. Football season starts soon."
+	chunks := chunker.ChunkText(text)
+	assertChunks(t, chunks, []string{
+		"The football team won. The football stadium is big.",
+		"The library opened. The library has books.",
+		"Football season starts soon.",
+	})
+
+	// the maximum size closes chunks even without a breakpoint
+	chunker = newSemanticChunker(t, topicEmbedder{}, 100, 1, 5)
+	chunks = chunker.ChunkText("The football team won. The football stadium is big.")
+	assertChunks(t, chunks, []string{"The football team won.", "The football stadium is big."})
+}
+
+// failingEmbedder fails every request, like an unreachable embedding model
+type failingEmbedder struct{}
+
+func (failingEmbedder) EmbedChunks(chunks []string) ([][]float32, error) {
+	return nil, errors.New("embedding model unavailable")
+}
+
+func TestSemanticChunkerFallback(t *testing.T) {
+	chunker := newSemanticChunker(t, failingEmbedder{}, 50, 1, 5)
+	text := "The football team won.\nThe football stadium is big. The  football team won."
+	chunks := chunker.ChunkText(text)
+	assertChunks(t, chunks, []string{"The football team won.", "The football stadium is big.", "The football team won."})
+	assertSpans(t, "semantic fallback", text, chunks)
+
+	for _, chunk := range chunks {
+		if chunk.Metadata["chunking_fallback"] != "size" {
+			t.Errorf("Expected the fallback in the metadata of chunk %d, got %v", chunk.ID, chunk.Metadata)
+		}
+	}
+
+	// without breakpoints the chunks are filled up to the maximum size, not closed after every sentence
+	chunker = newSemanticChunker(t, failingEmbedder{}, 50, 0, 10)
+	assertChunks(t, chunker.ChunkText(text), []string{
+		"The football team won. The football stadium is big.",
+		"The football team won.",
+	})
+}
+
+func TestNewSemanticChunkerSizes(t *testing.T) {
+	for _, sizes := range [][2]int{{0, 0}, {1, 0}, {0, -1}, {-1, 5}, {6, 5}} {
+		if _, err := NewSemanticChunker(topicEmbedder{}, 50, sizes[0], sizes[1]); err == nil {
+			t.Errorf("Expected an error for min size %d and max size %d", sizes[0], sizes[1])
+		}
+	}
+
+	_, err := NewChunker(models.ChunkSettings{Strategy: "semantic", Size: 5, MinSize: 6}, nil, topicEmbedder{})
+	if err == nil {
+		t.Errorf("Expected NewChunker to reject a min_size above the size")
+	}
+}
+
+func TestGoChunker(t *testing.T) {
+	source := `package sample
+
+import "fmt"
+
+// Greeting is the default greeting
+const Greeting = "hello"
+
+var (
+	count int
+	name  string
+)
+
+// Greeter greets people
+type Greeter struct{}
+
+// Greet prints the greeting
+func (g *Greeter) Greet() {
+	fmt.Println(Greeting, name)
+}
+
+func helper() {}
+`
+	chunker := NewGoChunker(NewWordChunker(5, 0))
+	chunks := chunker.ChunkFile("sample/greeter.go", source)
+
+	assertChunks(t, chunks, []string{
+		"// Greeting is the default greeting\nconst Greeting = \"hello\"",
+		"var (\n\tcount int\n\tname  string\n)",
+		"// Greeter greets people\ntype Greeter struct{}",
+		"// Greet prints the greeting\nfunc (g *Greeter) Greet() {\n\tfmt.Println(Greeting, name)\n}",
+		"func helper() {}",
+	})
+
+	method := chunks[3].Metadata
+	if method["symbol"] != "Greet" || method["kind"] != "method" || method["receiver"] != "*Greeter" {
+		t.Errorf("Unexpected method metadata: %v", method)
+	}
+	if method["package"] != "sample" || method["file_path"] != "sample/greeter.go" {
+		t.Errorf("Unexpected method package or path: %v", method)
+	}
+	if symbols, ok := chunks[1].Metadata["symbol"].([]any); !ok || len(symbols) != 2 || symbols[1] != "name" {
+		t.Errorf("Expected the symbols of the var block, got %v", chunks[1].Metadata["symbol"])
+	}
+	if _, ok := chunks[4].Metadata["receiver"]; ok || chunks[4].Metadata["kind"] != "func" {
+		t.Errorf("Unexpected func metadata: %v", chunks[4].Metadata)
+	}
+
+	// a file that does not parse is split by the fallback chunker
+	assertChunks(t, chunker.ChunkText("not go at all"), []string{"not go at all"})
+}
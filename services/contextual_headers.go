@@ -0,0 +1,49 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"rag-pipeline/models"
+	"strings"
+)
+
+// documentContextHeader returns the header prepended to every chunk of the document before
+// it is embedded: the document title and a one-line summary from the generator model.
+// If the summary can not be generated, the header only holds the title
+func (r *RAGService) documentContextHeader(doc models.Document, text string) string {
+	title := documentTitle(doc)
+
+	input := text
+	if limit := r.Config.ContextualHeaders.SummaryInputChars; limit > 0 && len(input) > limit {
+		input = strings.ToValidUTF8(input[:limit], "")
+	}
+
+	summary, err := r.Generator.SummarizeDocument(title, input)
+	if err != nil {
+		log.Printf("contextual_headers.go|documentContextHeader: no summary for %s, %v", doc.Filename, err)
+		summary = ""
+	}
+
+	return contextHeader(title, summary)
+}
+
+// documentTitle returns the title of the document: the extracted title, e.g. of a web page,
+// or else its file name without directory and extension
+func documentTitle(doc models.Document) string {
+	if title, ok := doc.Metadata["title"].(string); ok && title != "" {
+		return title
+	}
+
+	base := filepath.Base(doc.Filename)
+	title := strings.TrimSuffix(base, filepath.Ext(base))
+	return strings.TrimSpace(strings.NewReplacer("_", " ", "-", " ").Replace(title))
+}
+
+// contextHeader formats the title and the summary, an empty summary is left out
+func contextHeader(title string, summary string) string {
+	if summary == "" {
+		return fmt.Sprintf("Document: %s", title)
+	}
+	return fmt.Sprintf("Document: %s\nSummary: %s", title, summary)
+}
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"rag-pipeline/extractor"
+	"rag-pipeline/models"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCrawl = errors.New("invalid crawl request")
+
+// maxSitemaps limits the sitemaps read by one crawl, a sitemap index may name many of them
+const maxSitemaps = 50
+
+// IngestURL fetches the web page, or the pages listed by the sitemap, and the pages linked from
+// them up to the requested depth, and stores every page with its URL as "source_url" in the
+// chunk payloads. The robots.txt of every host is obeyed and the requests to a host are spaced
+// by crawler.requests_per_second, redirects are followed like links. A page that fails does not
+// stop the others, only the stored pages count toward the page limit
+func (r *RAGService) IngestURL(request models.IngestURLRequest) ([]models.StoreResult, error) {
+	settings := r.Config.Crawler
+
+	start, err := url.Parse(strings.TrimSpace(request.URL))
+	if err != nil || (start.Scheme != "http" && start.Scheme != "https") || start.Host == "" {
+		return nil, fmt.Errorf("crawler.go|IngestURL: %w: %q is not an http or https URL", ErrInvalidCrawl, request.URL)
+	}
+	if request.Depth < 0 || request.Depth > settings.MaxDepth {
+		return nil, fmt.Errorf("crawler.go|IngestURL: %w: the depth must be between 0 and %d", ErrInvalidCrawl, settings.MaxDepth)
+	}
+	start.Fragment = ""
+
+	maxPages := max(settings.MaxPages, 1)
+	if request.MaxPages > 0 {
+		maxPages = min(request.MaxPages, maxPages)
+	}
+	sameHost := request.SameHost == nil || *request.SameHost
+
+	type queuedPage struct {
+		url   *url.URL
+		depth int
+	}
+	queue := []queuedPage{{url: start}}
+	visited := map[string]bool{start.String(): true}
+	enqueue := func(link *url.URL, depth int) {
+		if sameHost && !strings.EqualFold(link.Host, start.Host) {
+			return
+		}
+		if !visited[link.String()] {
+			visited[link.String()] = true
+			queue = append(queue, queuedPage{url: link, depth: depth})
+		}
+	}
+
+	c := newCrawler(r.Config)
+	var results []models.StoreResult
+	sitemaps, stored := 0, 0
+	for len(queue) > 0 && stored < maxPages {
+		page := queue[0]
+		queue = queue[1:]
+		result := models.StoreResult{Filename: page.url.String()}
+
+		if !c.allowed(page.url) {
+			result.Status = "skipped"
+			result.Error = "disallowed by robots.txt"
+			results = append(results, result)
+			continue
+		}
+
+		fetched, err := c.fetch(page.url)
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		// the target of a redirect is fetched next, so it passes robots.txt, the host check and the rate limit too
+		if target := fetched.redirect; target != nil {
+			if sameHost && !strings.EqualFold(target.Host, start.Host) {
+				result.Status = "skipped"
+				result.Error = "redirected to another host: " + target.String()
+				results = append(results, result)
+			} else if !visited[target.String()] {
+				visited[target.String()] = true
+				queue = append([]queuedPage{{url: target, depth: page.depth}}, queue...)
+			}
+			continue
+		}
+
+		// the pages of a sitemap are start pages, the sitemap itself is not stored
+		if locations, ok := parseSitemap(fetched); ok {
+			if sitemaps++; sitemaps > maxSitemaps {
+				log.Printf("crawler.go|IngestURL: skipped the sitemap %s, more than %d sitemaps", page.url, maxSitemaps)
+				continue
+			}
+			for _, location := range locations {
+				if link, err := page.url.Parse(location); err == nil && (link.Scheme == "http" || link.Scheme == "https") {
+					link.Fragment = ""
+					enqueue(link, page.depth)
+				}
+			}
+			continue
+		}
+
+		if !extractor.SupportedMediaType(fetched.mediaType) {
+			result.Status = "skipped"
+			result.Error = "unsupported content type " + fetched.mediaType
+			results = append(results, result)
+			continue
+		}
+
+		result = r.storeWebPage(fetched)
+		results = append(results, result)
+		if result.Status == "stored" {
+			stored++
+		}
+
+		if page.depth < request.Depth && (fetched.mediaType == "text/html" || fetched.mediaType == "application/xhtml+xml") {
+			links, err := extractor.ExtractLinks(fetched.content, fetched.url)
+			if err != nil {
+				log.Printf("crawler.go|IngestURL: %v", err)
+			}
+			for _, link := range links {
+				enqueue(link, page.depth+1)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// storeWebPage stores the fetched page under its URL
+func (r *RAGService) storeWebPage(page fetchedPage) models.StoreResult {
+	pageURL := page.url.String()
+	result := models.StoreResult{Filename: pageURL}
+
+	extracted, err := extractor.ExtractMediaType(page.url.Path, page.mediaType, page.content)
+	if err == nil {
+		extracted.Metadata["source_url"] = pageURL
+		var doc *models.Document
+		if doc, err = r.storeExtracted(pageURL, page.content, extracted, nil); err == nil {
+			result.Status = "stored"
+			result.DocumentID = doc.ID
+			result.ChunkCount = doc.ChunkCount
+			return result
+		}
+	}
+
+	log.Printf("crawler.go|storeWebPage: failed to store %s: %v", pageURL, err)
+	result.Status = "failed"
+	result.Error = err.Error()
+	return result
+}
+
+// crawler fetches the pages of one crawl, it keeps the robots.txt rules of the hosts
+// and the time of the last request to every host
+type crawler struct {
+	client      *http.Client
+	userAgent   string
+	interval    time.Duration // between two requests to the same host
+	maxPageSize int
+	robots      map[string]*robotsRules
+	lastRequest map[string]time.Time
+}
+
+// fetchedPage is the response to a request, a redirect has only the URL it points to
+type fetchedPage struct {
+	url       *url.URL
+	mediaType string
+	content   []byte
+	redirect  *url.URL
+}
+
+// maxRobotsRedirects limits the redirects followed to a robots.txt
+const maxRobotsRedirects = 5
+
+func newCrawler(config *models.Config) *crawler {
+	settings := config.Crawler
+
+	interval := time.Duration(0)
+	if settings.RequestsPerSecond > 0 {
+		interval = time.Duration(float64(time.Second) / settings.RequestsPerSecond)
+	}
+
+	// the redirects are not followed by the client, every hop is a request of the crawler
+	client := &http.Client{
+		Timeout: time.Duration(max(settings.Timeout, 1)) * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &crawler{
+		client:      client,
+		userAgent:   settings.UserAgent,
+		interval:    interval,
+		maxPageSize: settings.MaxPageSize,
+		robots:      make(map[string]*robotsRules),
+		lastRequest: make(map[string]time.Time),
+	}
+}
+
+// allowed reports whether the robots.txt of the host allows fetching the URL. A missing
+// robots.txt allows everything, one that can not be read because of a server or network
+// error allows nothing
+func (c *crawler) allowed(page *url.URL) bool {
+	host := page.Scheme + "://" + page.Host
+	rules, ok := c.robots[host]
+	if !ok {
+		rules = c.fetchRobots(page)
+		c.robots[host] = rules
+	}
+
+	path := page.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if page.RawQuery != "" {
+		path += "?" + page.RawQuery
+	}
+	return rules.allowed(path)
+}
+
+func (c *crawler) fetchRobots(page *url.URL) *robotsRules {
+	robotsURL := &url.URL{Scheme: page.Scheme, Host: page.Host, Path: "/robots.txt"}
+
+	for range maxRobotsRedirects + 1 {
+		response, err := c.get(robotsURL)
+		if err != nil {
+			log.Printf("crawler.go|fetchRobots: %v", err)
+			return &robotsRules{disallowAll: true}
+		}
+
+		if target := redirectTarget(response); target != nil {
+			response.Body.Close()
+			robotsURL = target
+			continue
+		}
+		defer response.Body.Close()
+
+		switch {
+		case response.StatusCode >= 500:
+			return &robotsRules{disallowAll: true}
+		case response.StatusCode != http.StatusOK:
+			return nil
+		}
+
+		content, err := io.ReadAll(io.LimitReader(response.Body, 512<<10))
+		if err != nil {
+			return &robotsRules{disallowAll: true}
+		}
+		return parseRobots(content, c.userAgent)
+	}
+
+	// too many redirects, as if there was no robots.txt
+	return nil
+}
+
+// fetch returns the page at the URL
+func (c *crawler) fetch(page *url.URL) (fetchedPage, error) {
+	response, err := c.get(page)
+	if err != nil {
+		return fetchedPage{}, err
+	}
+	defer response.Body.Close()
+
+	if target := redirectTarget(response); target != nil {
+		return fetchedPage{url: page, redirect: target}, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return fetchedPage{}, fmt.Errorf("crawler.go|fetch: %s returned status %d", page, response.StatusCode)
+	}
+
+	limit := c.maxPageSize
+	if limit <= 0 {
+		limit = maxArchiveFileSize
+	}
+	content, err := io.ReadAll(io.LimitReader(response.Body, int64(limit)+1))
+	if err != nil {
+		return fetchedPage{}, fmt.Errorf("crawler.go|fetch: failed to read %s: %w", page, err)
+	}
+	if len(content) > limit {
+		return fetchedPage{}, fmt.Errorf("crawler.go|fetch: %s is larger than %d bytes", page, limit)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = http.DetectContentType(content)
+		mediaType, _, _ = mime.ParseMediaType(mediaType)
+	}
+
+	return fetchedPage{url: response.Request.URL, mediaType: strings.ToLower(mediaType), content: content}, nil
+}
+
+// get sends a GET request, after waiting for the interval of the host since its last request.
+// The robots.txt Crawl-delay of the host is used if it is longer
+func (c *crawler) get(page *url.URL) (*http.Response, error) {
+	host := page.Scheme + "://" + page.Host
+
+	interval := c.interval
+	if rules := c.robots[host]; rules != nil {
+		interval = max(interval, rules.crawlDelay)
+	}
+	if last, ok := c.lastRequest[host]; ok {
+		if wait := interval - time.Since(last); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	c.lastRequest[host] = time.Now()
+
+	request, err := http.NewRequest(http.MethodGet, page.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("crawler.go|get: %w", err)
+	}
+	if c.userAgent != "" {
+		request.Header.Set("User-Agent", c.userAgent)
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("crawler.go|get: request to %s failed: %w", page, err)
+	}
+	return response, nil
+}
+
+// redirectTarget returns the http or https URL a redirect response points to, nil for other responses
+func redirectTarget(response *http.Response) *url.URL {
+	switch response.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil
+	}
+
+	target, err := response.Request.URL.Parse(response.Header.Get("Location"))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return nil
+	}
+	target.Fragment = ""
+	return target
+}
+
+// sitemap is a <urlset> of pages or a <sitemapindex> of sitemaps
+type sitemap struct {
+	XMLName  xml.Name
+	Pages    []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// parseSitemap returns the locations listed by the page if it is a sitemap, gzip compressed or not
+func parseSitemap(page fetchedPage) ([]string, bool) {
+	isXML := strings.HasSuffix(page.mediaType, "/xml") || page.mediaType == "application/gzip" || page.mediaType == "application/x-gzip" ||
+		strings.HasSuffix(page.url.Path, ".xml") || strings.HasSuffix(page.url.Path, ".xml.gz")
+	if !isXML {
+		return nil, false
+	}
+
+	content := page.content
+	if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, false
+		}
+		if content, err = io.ReadAll(io.LimitReader(reader, maxArchiveFileSize)); err != nil {
+			return nil, false
+		}
+	}
+
+	var parsed sitemap
+	if err := xml.Unmarshal(content, &parsed); err != nil {
+		return nil, false
+	}
+
+	var locations []string
+	switch parsed.XMLName.Local {
+	case "urlset":
+		locations = parsed.Pages
+	case "sitemapindex":
+		locations = parsed.Sitemaps
+	default:
+		return nil, false
+	}
+
+	for i := range locations {
+		locations[i] = strings.TrimSpace(locations[i])
+	}
+	return locations, true
+}
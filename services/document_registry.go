@@ -0,0 +1,129 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rag-pipeline/models"
+	"sort"
+	"sync"
+)
+
+var ErrDocumentNotFound = errors.New("document not found")
+
+// DocumentRegistry keeps the records of the documents stored in a collection
+type DocumentRegistry struct {
+	path      string
+	mu        sync.RWMutex
+	documents map[string]models.Document
+}
+
+// NewDocumentRegistry creates a DocumentRegistry and loads the records stored in path.
+// If path is empty, the records are kept only in memory
+func NewDocumentRegistry(path string) (*DocumentRegistry, error) {
+	registry := &DocumentRegistry{
+		path:      path,
+		documents: make(map[string]models.Document),
+	}
+
+	if path == "" {
+		return registry, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return registry, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("document_registry.go|NewDocumentRegistry: failed to read %s: %w", path, err)
+	}
+
+	var documents []models.Document
+	if err := json.Unmarshal(data, &documents); err != nil {
+		return nil, fmt.Errorf("document_registry.go|NewDocumentRegistry: failed to parse %s: %w", path, err)
+	}
+
+	for _, doc := range documents {
+		registry.documents[doc.ID] = doc
+	}
+
+	return registry, nil
+}
+
+// Add adds or replaces the given document record
+func (dr *DocumentRegistry) Add(doc models.Document) error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	dr.documents[doc.ID] = doc
+	return dr.save()
+}
+
+// Get returns the document record with the given id
+func (dr *DocumentRegistry) Get(id string) (models.Document, bool) {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	doc, ok := dr.documents[id]
+	return doc, ok
+}
+
+// List returns all document records ordered by their ingest time
+func (dr *DocumentRegistry) List() []models.Document {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	documents := make([]models.Document, 0, len(dr.documents))
+	for _, doc := range dr.documents {
+		documents = append(documents, doc)
+	}
+
+	sort.Slice(documents, func(i, j int) bool {
+		return documents[i].IngestedAt.Before(documents[j].IngestedAt)
+	})
+
+	return documents
+}
+
+// Remove removes the document record with the given id
+func (dr *DocumentRegistry) Remove(id string) error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	if _, ok := dr.documents[id]; !ok {
+		return ErrDocumentNotFound
+	}
+
+	delete(dr.documents, id)
+	return dr.save()
+}
+
+// save writes the records to the registry file, the caller must hold the lock
+func (dr *DocumentRegistry) save() error {
+	if dr.path == "" {
+		return nil
+	}
+
+	documents := make([]models.Document, 0, len(dr.documents))
+	for _, doc := range dr.documents {
+		documents = append(documents, doc)
+	}
+
+	data, err := json.MarshalIndent(documents, "", "  ")
+	if err != nil {
+		return fmt.Errorf("document_registry.go|save: failed to marshal documents: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dr.path), 0o755); err != nil {
+		return fmt.Errorf("document_registry.go|save: failed to create directory: %w", err)
+	}
+
+	// write to a temporary file first, so a crash never leaves a half written registry
+	tmpPath := dr.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("document_registry.go|save: failed to write registry: %w", err)
+	}
+
+	return os.Rename(tmpPath, dr.path)
+}
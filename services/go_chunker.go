@@ -0,0 +1,117 @@
+package services
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"rag-pipeline/models"
+)
+
+// GoChunker parses Go source files and emits one chunk per top-level declaration
+// (func, method, type, const or var block) including its doc comment. The chunks
+// carry the package, symbol, kind, receiver and file path as metadata.
+// Files that do not parse are split by the Fallback chunker
+type GoChunker struct {
+	Fallback Chunker
+}
+
+// NewGoChunker creates and returns a new GoChunker
+func NewGoChunker(fallback Chunker) *GoChunker {
+	return &GoChunker{Fallback: fallback}
+}
+
+// ChunkText splits the Go source into its top-level declarations
+func (config GoChunker) ChunkText(text string) []models.Chunk {
+	return config.ChunkFile("", text)
+}
+
+// ChunkFile splits the Go source of the file at path into its top-level declarations
+func (config GoChunker) ChunkFile(path string, text string) []models.Chunk {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, text, parser.ParseComments)
+	if err != nil {
+		log.Printf("go_chunker.go|ChunkFile: falling back to the text chunker, %v", err)
+		if config.Fallback == nil {
+			return nil
+		}
+		return config.Fallback.ChunkText(text)
+	}
+
+	var chunks []models.Chunk
+	for _, decl := range file.Decls {
+		metadata := map[string]any{"package": file.Name.Name}
+		if path != "" {
+			metadata["file_path"] = path
+		}
+
+		var doc *ast.CommentGroup
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			doc = d.Doc
+			metadata["symbol"] = d.Name.Name
+			metadata["kind"] = "func"
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				metadata["kind"] = "method"
+				metadata["receiver"] = types.ExprString(d.Recv.List[0].Type)
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			doc = d.Doc
+			metadata["kind"] = d.Tok.String()
+
+			names := declaredNames(d)
+			if len(names) == 1 {
+				metadata["symbol"] = names[0]
+			} else if len(names) > 1 {
+				// a block declares several symbols, a filter on one of them matches the block.
+				// []any because the Qdrant payload conversion only accepts untyped lists
+				symbols := make([]any, len(names))
+				for i, name := range names {
+					symbols[i] = name
+				}
+				metadata["symbol"] = symbols
+			}
+		default:
+			continue
+		}
+
+		pos := decl.Pos()
+		if doc != nil {
+			pos = doc.Pos()
+		}
+		start, end := fset.Position(pos).Offset, fset.Position(decl.End()).Offset
+
+		chunks = append(chunks, models.Chunk{
+			ID:       len(chunks),
+			Text:     text[start:end],
+			Span:     &models.Span{StartOffset: start, EndOffset: end},
+			Metadata: metadata,
+		})
+	}
+	setLines(text, chunks)
+
+	log.Printf("go_chunker.go|ChunkFile: %d declarations in package %s", len(chunks), file.Name.Name)
+	return chunks
+}
+
+// declaredNames returns the names declared by a type, const or var declaration
+func declaredNames(decl *ast.GenDecl) []string {
+	var names []string
+	for _, spec := range decl.Specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			names = append(names, s.Name.Name)
+		case *ast.ValueSpec:
+			for _, name := range s.Names {
+				if name.Name != "_" {
+					names = append(names, name.Name)
+				}
+			}
+		}
+	}
+	return names
+}
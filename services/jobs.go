@@ -0,0 +1,487 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"rag-pipeline/models"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// JobQueue runs the ingest jobs in a pool of background workers. The job records and the
+// uploaded files of the unfinished jobs are kept next to the document registry, so the jobs
+// interrupted by a restart are resumed
+type JobQueue struct {
+	service *RAGService
+	path    string // file of the job records, empty keeps the jobs and their files in memory
+	dir     string // directory of the uploaded files
+
+	mu      sync.Mutex
+	wake    *sync.Cond
+	jobs    map[string]*models.Job
+	pending []string
+	files   map[string][]models.Upload // uploaded files of the jobs kept in memory
+	cancels map[string]context.CancelFunc
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// NewJobQueue creates a JobQueue, loads the jobs stored in path and starts the workers.
+// Queued jobs and jobs that were running when the service stopped are queued again
+func NewJobQueue(service *RAGService, path string, workers int) (*JobQueue, error) {
+	queue := &JobQueue{
+		service: service,
+		path:    path,
+		jobs:    make(map[string]*models.Job),
+		files:   make(map[string][]models.Upload),
+		cancels: make(map[string]context.CancelFunc),
+	}
+	queue.wake = sync.NewCond(&queue.mu)
+
+	if path != "" {
+		queue.dir = path[:len(path)-len(filepath.Ext(path))]
+
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("jobs.go|NewJobQueue: failed to read %s: %w", path, err)
+		}
+
+		var jobs []models.Job
+		if err == nil {
+			if err := json.Unmarshal(data, &jobs); err != nil {
+				return nil, fmt.Errorf("jobs.go|NewJobQueue: failed to parse %s: %w", path, err)
+			}
+		}
+
+		for _, job := range jobs {
+			if job.State == "queued" || job.State == "running" {
+				job.State = "queued"
+				queue.pending = append(queue.pending, job.ID)
+				log.Printf("jobs.go|NewJobQueue: resuming job %s", job.ID)
+			}
+			queue.jobs[job.ID] = &job
+		}
+	}
+
+	for range max(workers, 1) {
+		queue.workers.Add(1)
+		go queue.work()
+	}
+
+	return queue, nil
+}
+
+// Submit queues a job that stores the uploads like StoreFiles and returns it.
+// The archives are unpacked right away, so the job knows all of its files
+func (q *JobQueue) Submit(uploads []models.Upload) (models.Job, error) {
+	files, results, cleanup := planUploads(uploads)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	job := &models.Job{
+		ID:        newJobID(),
+		State:     "queued",
+		Files:     results,
+		Progress:  models.JobProgress{FilesTotal: len(results)},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for i := range job.Files {
+		if job.Files[i].Status == "" {
+			job.Files[i].Status = "queued"
+		} else {
+			job.Progress.FilesDone++
+		}
+	}
+
+	if err := q.saveFiles(job, files); err != nil {
+		return models.Job{}, fmt.Errorf("jobs.go|Submit: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		q.removeFiles(job.ID)
+		return models.Job{}, fmt.Errorf("jobs.go|Submit: the job queue is closed")
+	}
+	q.jobs[job.ID] = job
+	q.pending = append(q.pending, job.ID)
+	if err := q.save(); err != nil {
+		return models.Job{}, fmt.Errorf("jobs.go|Submit: %w", err)
+	}
+	q.wake.Signal()
+
+	return snapshot(job), nil
+}
+
+// Get returns the job with the given id
+func (q *JobQueue) Get(id string) (models.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return models.Job{}, ErrJobNotFound
+	}
+	return snapshot(job), nil
+}
+
+// List returns all jobs ordered by their creation time
+func (q *JobQueue) List() []models.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]models.Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, snapshot(job))
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	return jobs
+}
+
+// Cancel cancels the job with the given id. A queued job is cancelled at once, a running job
+// stops before its next embedding batch and the chunks of its unfinished file are removed.
+// The files stored before stay in the collection
+func (q *JobQueue) Cancel(id string) (models.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return models.Job{}, ErrJobNotFound
+	}
+
+	switch job.State {
+	case "queued":
+		q.pending = slices.DeleteFunc(q.pending, func(pending string) bool { return pending == id })
+		cancelFiles(job)
+		job.UpdatedAt = time.Now().UTC()
+		q.removeFiles(id)
+		if err := q.save(); err != nil {
+			return models.Job{}, fmt.Errorf("jobs.go|Cancel: %w", err)
+		}
+	case "running":
+		q.cancels[id]()
+	default:
+		return models.Job{}, ErrJobFinished
+	}
+
+	return snapshot(job), nil
+}
+
+// Close stops the workers and waits for them. A running job stops after its current file and
+// stays queued, so it is resumed by the next JobQueue of the same path. Jobs can not be submitted
+// to a closed queue
+func (q *JobQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.wake.Broadcast()
+	q.mu.Unlock()
+
+	q.workers.Wait()
+}
+
+// work runs the queued jobs one after another until the queue is closed
+func (q *JobQueue) work() {
+	defer q.workers.Done()
+
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closed {
+			q.wake.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		id := q.pending[0]
+		q.pending = q.pending[1:]
+
+		job := q.jobs[id]
+		ctx, cancel := context.WithCancel(context.Background())
+		q.cancels[id] = cancel
+		job.State = "running"
+		job.UpdatedAt = time.Now().UTC()
+		if err := q.save(); err != nil {
+			log.Printf("jobs.go|work: %v", err)
+		}
+		q.mu.Unlock()
+
+		q.run(ctx, job)
+
+		q.mu.Lock()
+		delete(q.cancels, id)
+		q.mu.Unlock()
+		cancel()
+	}
+}
+
+// run stores the queued files of the job. Only the worker of the job changes it while it
+// runs, the changes are made under the lock because the handlers read the job
+func (q *JobQueue) run(ctx context.Context, job *models.Job) {
+	for i := range job.Files {
+		if job.Files[i].Status != "queued" {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if q.isClosed() {
+			// the job is resumed from this file when the service starts again
+			q.update(job, func() { job.State = "queued" })
+			return
+		}
+
+		stored := storedChunks(job)
+		run := &ingestRun{
+			ctx:  ctx,
+			skip: job.StoredChunks,
+			progress: func(embedded, total int) {
+				q.update(job, func() {
+					job.StoredChunks = embedded
+					job.Progress.ChunksEmbedded = stored + embedded
+					job.Progress.ChunksTotal = stored + total
+				})
+			},
+		}
+
+		result := q.storeFile(job, i, run)
+
+		// the file of a cancelled job stays queued and becomes cancelled below
+		if result.Status == "failed" && ctx.Err() != nil {
+			break
+		}
+
+		q.update(job, func() {
+			job.Files[i] = result
+			job.StoredChunks = 0
+			job.Progress.FilesDone++
+			job.Progress.ChunksEmbedded = storedChunks(job)
+			job.Progress.ChunksTotal = job.Progress.ChunksEmbedded
+		})
+	}
+
+	q.update(job, func() {
+		if ctx.Err() != nil {
+			cancelFiles(job)
+			return
+		}
+
+		stored, failed := 0, 0
+		for _, file := range job.Files {
+			switch file.Status {
+			case "stored":
+				stored++
+			case "failed":
+				failed++
+			}
+		}
+
+		// the job failed only if nothing could be stored
+		job.State = "completed"
+		if stored == 0 && failed > 0 {
+			job.State = "failed"
+		}
+		if failed > 0 {
+			job.Error = fmt.Sprintf("%d of %d files failed", failed, len(job.Files))
+		}
+	})
+
+	q.mu.Lock()
+	q.removeFiles(job.ID)
+	q.mu.Unlock()
+}
+
+// isClosed reports whether Close was called
+func (q *JobQueue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// update changes the job under the lock and saves the jobs
+func (q *JobQueue) update(job *models.Job, change func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	change()
+	job.UpdatedAt = time.Now().UTC()
+	if err := q.save(); err != nil {
+		log.Printf("jobs.go|update: %v", err)
+	}
+}
+
+// saveFiles keeps the queued files of the job until it is finished. The files of the uploads
+// are copied, so they may be closed once the job is submitted
+func (q *JobQueue) saveFiles(job *models.Job, files []models.Upload) error {
+	if q.path == "" {
+		for i := range files {
+			file, err := readUpload(files[i])
+			if err != nil {
+				return err
+			}
+			files[i] = file
+		}
+
+		q.mu.Lock()
+		q.files[job.ID] = files
+		q.mu.Unlock()
+		return nil
+	}
+
+	dir := filepath.Join(q.dir, job.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	for i, file := range files {
+		if job.Files[i].Status != "queued" {
+			continue
+		}
+		if err := writeUpload(filepath.Join(dir, strconv.Itoa(i)), file); err != nil {
+			os.RemoveAll(dir)
+			return fmt.Errorf("failed to write %s: %w", file.Filename, err)
+		}
+	}
+	return nil
+}
+
+// writeUpload writes the content or the file of the upload to the path
+func writeUpload(path string, upload models.Upload) error {
+	if upload.File == nil {
+		return os.WriteFile(path, upload.Content, 0o644)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, upload.File); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// storeFile stores the i-th file of the job, a saved file is read from its disk file
+// so large plain text files are streamed
+func (q *JobQueue) storeFile(job *models.Job, i int, run *ingestRun) models.StoreResult {
+	filename := job.Files[i].Filename
+	if q.path == "" {
+		q.mu.Lock()
+		upload := q.files[job.ID][i]
+		q.mu.Unlock()
+		return q.service.storeFile(upload, run)
+	}
+
+	file, err := os.Open(filepath.Join(q.dir, job.ID, strconv.Itoa(i)))
+	if err != nil {
+		return models.StoreResult{Filename: filename, Status: "failed", Error: fmt.Sprintf("jobs.go|storeFile: failed to open the uploaded file: %v", err)}
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return models.StoreResult{Filename: filename, Status: "failed", Error: fmt.Sprintf("jobs.go|storeFile: failed to read the uploaded file: %v", err)}
+	}
+	return q.service.storeFileReader(filename, file, info.Size(), run)
+}
+
+// removeFiles deletes the uploaded files of the job, the caller must hold the lock
+func (q *JobQueue) removeFiles(id string) {
+	delete(q.files, id)
+	if q.path == "" {
+		return
+	}
+	if err := os.RemoveAll(filepath.Join(q.dir, id)); err != nil {
+		log.Printf("jobs.go|removeFiles: %v", err)
+	}
+}
+
+// save writes the job records to the job file, the caller must hold the lock
+func (q *JobQueue) save() error {
+	if q.path == "" {
+		return nil
+	}
+
+	jobs := make([]*models.Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("jobs.go|save: failed to marshal jobs: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o755); err != nil {
+		return fmt.Errorf("jobs.go|save: failed to create directory: %w", err)
+	}
+
+	// write to a temporary file first, so a crash never leaves a half written job file
+	tmpPath := q.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("jobs.go|save: failed to write jobs: %w", err)
+	}
+
+	return os.Rename(tmpPath, q.path)
+}
+
+// cancelFiles marks the job and its queued files as cancelled
+func cancelFiles(job *models.Job) {
+	job.State = "cancelled"
+	job.StoredChunks = 0
+	for i := range job.Files {
+		if job.Files[i].Status == "queued" {
+			job.Files[i].Status = "cancelled"
+		}
+	}
+}
+
+// storedChunks returns the chunks of the stored files of the job
+func storedChunks(job *models.Job) int {
+	total := 0
+	for _, file := range job.Files {
+		if file.Status == "stored" {
+			total += file.ChunkCount
+		}
+	}
+	return total
+}
+
+// snapshot returns a copy of the job that the caller can read without the lock
+func snapshot(job *models.Job) models.Job {
+	copied := *job
+	copied.Files = slices.Clone(job.Files)
+	return copied
+}
+
+// newJobID returns a random job ID
+func newJobID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
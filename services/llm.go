@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"rag-pipeline/models"
+	"rag-pipeline/utils"
+	"strings"
 	"time"
 )
 
@@ -33,12 +35,23 @@ func (llm *LLMService) GenerateResponseWithoutChunks(question string) (string, e
 	return generatedResponse, err
 }
 
-// GenerateResponse generates a response using the LLM with provided context chunks
-func (llm *LLMService) GenerateResponse(question string, chunks []string) (string, error) {
+// GenerateResponse generates a response using the LLM with provided context passages.
+// The heading path, page and contextual header of a passage, if it has them, tell the model
+// where the passage sits in its document
+func (llm *LLMService) GenerateResponse(question string, passages []models.ContextPassage) (string, error) {
 
 	data := ""
-	for i, chunk := range chunks {
-		data += fmt.Sprintf("Chunk %d: %s\n\n", i+1, chunk)
+	for i, passage := range passages {
+		text := passage.Text
+		if header, ok := passage.Metadata["context_header"].(string); ok && header != "" {
+			text = header + "\n" + text
+		}
+
+		if label := passageLabel(passage.Metadata); label != "" {
+			data += fmt.Sprintf("Chunk %d (%s): %s\n\n", i+1, label, text)
+		} else {
+			data += fmt.Sprintf("Chunk %d: %s\n\n", i+1, text)
+		}
 	}
 
 	prompt := fmt.Sprintf(`We have provided context information below.
@@ -57,6 +70,54 @@ Answer: \
 	return generatedResponse, err
 }
 
+// passageLabel returns the heading path or chapter and the pages of the passage metadata, e.g. "Intro, page 4"
+func passageLabel(metadata map[string]any) string {
+	var parts []string
+	if headingPath, ok := metadata["heading_path"].(string); ok && headingPath != "" {
+		parts = append(parts, headingPath)
+	} else if chapter, ok := metadata["chapter"].(string); ok && chapter != "" {
+		parts = append(parts, chapter)
+	}
+
+	if _, ok := metadata["page"]; ok {
+		page, pageEnd := utils.ToInt(metadata["page"]), utils.ToInt(metadata["page_end"])
+		if pageEnd > page {
+			parts = append(parts, fmt.Sprintf("pages %d-%d", page, pageEnd))
+		} else {
+			parts = append(parts, fmt.Sprintf("page %d", page))
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// SummarizeDocument returns a one-line summary of the document generated from its title and text
+func (llm *LLMService) SummarizeDocument(title string, text string) (string, error) {
+	prompt := fmt.Sprintf(`Summarize the following document in one sentence of at most 30 words.
+Write only the sentence.
+Title: %s
+---------------------
+%s
+---------------------
+Summary: \
+`,
+		title,
+		text,
+	)
+
+	summary, err := llm.generateResponse(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	// keep only the first line and drop the formatting small models like to add
+	summary = strings.TrimSpace(summary)
+	if i := strings.IndexByte(summary, '\n'); i >= 0 {
+		summary = summary[:i]
+	}
+	return strings.Trim(strings.TrimSpace(summary), `"*`), nil
+}
+
 // generateResponse sends the prompt to the LLM and returns the generated response
 func (llm *LLMService) generateResponse(prompt string) (string, error) {
 
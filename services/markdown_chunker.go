@@ -0,0 +1,268 @@
+package services
+
+import (
+	"log"
+	"rag-pipeline/models"
+	"regexp"
+	"strings"
+)
+
+var (
+	atxHeadingPattern    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextHeadingPattern = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	fencePattern         = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+)
+
+// MarkdownChunker splits Markdown at its headings. Every section becomes a chunk that
+// carries its heading path (e.g. "Academics > Colleges > Engineering") as metadata.
+// Sections larger than ChunkSize are split between blocks, fenced code blocks and
+// tables are never split
+type MarkdownChunker struct {
+	ChunkSize int
+	Tokenizer Tokenizer // if set, the size counts tokens instead of words
+}
+
+// markdownSection is the content below a heading up to the next heading
+type markdownSection struct {
+	headingPath []string
+	lines       []textUnit // the lines without their line breaks
+	hasContent  bool       // false while the section holds only its heading
+}
+
+// NewMarkdownChunker creates and returns a new MarkdownChunker
+func NewMarkdownChunker(chunkSize int) *MarkdownChunker {
+	return &MarkdownChunker{ChunkSize: chunkSize}
+}
+
+// ChunkText splits the Markdown text into heading sections of at most ChunkSize
+func (config MarkdownChunker) ChunkText(text string) []models.Chunk {
+	var chunks []models.Chunk
+
+	for _, section := range splitMarkdownSections(text) {
+		headingPath := strings.Join(section.headingPath, " > ")
+
+		for _, chunk := range config.splitSection(text, section.lines) {
+			chunk.ID = len(chunks)
+			if headingPath != "" {
+				chunk.Metadata = map[string]any{"heading_path": headingPath}
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+	setLines(text, chunks)
+
+	log.Printf("markdown_chunker.go|ChunkText: %d chunks", len(chunks))
+	return chunks
+}
+
+// splitSection merges the blocks of the section lines of text into parts of at most ChunkSize
+func (config MarkdownChunker) splitSection(text string, lines []textUnit) []models.Chunk {
+	var parts []models.Chunk
+	var current []textUnit
+	total := 0
+
+	flush := func() {
+		if len(current) > 0 {
+			parts = append(parts, models.Chunk{Text: joinUnits(current, "\n\n"), Span: unitSpan(current)})
+			current = nil
+			total = 0
+		}
+	}
+
+	for _, block := range splitMarkdownBlocks(text, lines) {
+		length := config.length(block.text)
+
+		if length > config.ChunkSize && !block.atomic {
+			flush()
+			parts = append(parts, config.window(textWords(text[block.start:block.end], block.start))...)
+			continue
+		}
+
+		if total+length > config.ChunkSize {
+			flush()
+		}
+		current = append(current, block.textUnit)
+		total += length
+	}
+	flush()
+
+	return parts
+}
+
+// length returns the size of the text in words or tokens
+func (config MarkdownChunker) length(text string) int {
+	if config.Tokenizer != nil {
+		return config.Tokenizer.CountTokens(text)
+	}
+	return wordCount(text)
+}
+
+// window splits the words of a large paragraph into windows of ChunkSize words or tokens
+func (config MarkdownChunker) window(words []textUnit) []models.Chunk {
+	if config.Tokenizer != nil {
+		return tokenWindow(words, config.Tokenizer, config.ChunkSize, 0)
+	}
+	return slidingWindow(words, config.ChunkSize, 0, " ")
+}
+
+// splitMarkdownSections splits the text at its ATX and setext headings,
+// headings inside fenced code blocks are ignored. Sections without content are dropped
+func splitMarkdownSections(text string) []markdownSection {
+	var lines []textUnit
+	for offset := 0; offset <= len(text); {
+		end := strings.IndexByte(text[offset:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += offset
+		}
+		line := strings.TrimSuffix(text[offset:end], "\r")
+		lines = append(lines, textUnit{text: line, start: offset, end: offset + len(line)})
+		offset = end + 1
+	}
+
+	var sections []markdownSection
+	var headings []string // headings[level-1] is the current heading of that level
+	current := markdownSection{}
+	fence := ""
+
+	flush := func() {
+		if current.hasContent {
+			sections = append(sections, current)
+		}
+	}
+
+	addContent := func(line textUnit) {
+		current.lines = append(current.lines, line)
+		if strings.TrimSpace(line.text) != "" {
+			current.hasContent = true
+		}
+	}
+
+	startSection := func(level int, title string) {
+		flush()
+
+		if len(headings) >= level {
+			headings = headings[:level-1]
+		}
+		for len(headings) < level-1 {
+			headings = append(headings, "")
+		}
+		headings = append(headings, title)
+
+		var path []string
+		for _, heading := range headings {
+			if heading != "" {
+				path = append(path, heading)
+			}
+		}
+		current = markdownSection{headingPath: path}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if fence != "" {
+			addContent(line)
+			if strings.HasPrefix(strings.TrimSpace(line.text), fence) {
+				fence = ""
+			}
+			continue
+		}
+
+		if match := fencePattern.FindStringSubmatch(line.text); match != nil {
+			fence = match[1]
+			addContent(line)
+			continue
+		}
+
+		if match := atxHeadingPattern.FindStringSubmatch(line.text); match != nil {
+			startSection(len(match[1]), strings.TrimSpace(match[2]))
+			current.lines = append(current.lines, line)
+			continue
+		}
+
+		// a text line underlined with "===" or "---" is a level 1 or 2 heading
+		if i+1 < len(lines) && strings.TrimSpace(line.text) != "" && !strings.HasPrefix(strings.TrimSpace(line.text), "|") {
+			if match := setextHeadingPattern.FindStringSubmatch(lines[i+1].text); match != nil && isParagraphStart(current.lines) {
+				level := 2
+				if strings.HasPrefix(match[1], "=") {
+					level = 1
+				}
+				startSection(level, strings.TrimSpace(line.text))
+				current.lines = append(current.lines, line, lines[i+1])
+				i++
+				continue
+			}
+		}
+
+		addContent(line)
+	}
+	flush()
+
+	return sections
+}
+
+// isParagraphStart reports whether a line added after lines starts a new paragraph.
+// Only single line paragraphs are read as setext headings, otherwise the underline stays text
+func isParagraphStart(lines []textUnit) bool {
+	return len(lines) == 0 || strings.TrimSpace(lines[len(lines)-1].text) == ""
+}
+
+// markdownBlock is a paragraph, list, table or fenced code block of a section
+type markdownBlock struct {
+	textUnit      // the lines joined with "\n", spanning the block without surrounding whitespace
+	atomic   bool // fenced code blocks and tables are never split
+}
+
+// splitMarkdownBlocks groups the section lines of text into blocks separated by blank lines,
+// a fenced code block is one block even if it contains blank lines
+func splitMarkdownBlocks(text string, lines []textUnit) []markdownBlock {
+	var blocks []markdownBlock
+	var current []textUnit
+	fence := ""
+	atomic := false
+
+	flush := func() {
+		if len(current) > 0 {
+			start, end := trimSpan(text, current[0].start, current[len(current)-1].end)
+			blocks = append(blocks, markdownBlock{textUnit: textUnit{text: joinUnits(current, "\n"), start: start, end: end}, atomic: atomic})
+			current = nil
+			atomic = false
+		}
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line.text)
+
+		if fence != "" {
+			current = append(current, line)
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+				flush()
+			}
+			continue
+		}
+
+		if match := fencePattern.FindStringSubmatch(line.text); match != nil {
+			flush()
+			fence = match[1]
+			atomic = true
+			current = append(current, line)
+			continue
+		}
+
+		if trimmed == "" {
+			flush()
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "|") {
+			atomic = true
+		}
+		current = append(current, line)
+	}
+	flush()
+
+	return blocks
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"rag-pipeline/extractor"
+	"rag-pipeline/models"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// a letter, a hyphen at the end of the line and a lower case letter on the next line
+	hyphenationPattern = regexp.MustCompile(`(\p{L})-[ \t]*\n[ \t]*(\p{Ll})`)
+	digitsPattern      = regexp.MustCompile(`\d+`)
+)
+
+// Normalizer cleans a document before it is chunked, the rules run in the order of its fields
+type Normalizer struct {
+	RemoveControlChars   bool
+	NFKC                 bool
+	RemoveRepeatedLines  bool
+	RepeatedLineMinCount int
+	Dehyphenate          bool
+	Filters              []compiledFilter
+}
+
+// compiledFilter is a models.RegexFilter with its compiled pattern
+type compiledFilter struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// NewNormalizer creates and returns the Normalizer of the settings, it fails on invalid filter patterns
+func NewNormalizer(settings models.NormalizationSettings) (*Normalizer, error) {
+	normalizer := &Normalizer{
+		RemoveControlChars:   settings.RemoveControlChars,
+		NFKC:                 settings.NFKC,
+		RemoveRepeatedLines:  settings.RemoveRepeatedLines,
+		RepeatedLineMinCount: settings.RepeatedLineMinCount,
+		Dehyphenate:          settings.Dehyphenate,
+	}
+
+	if normalizer.RepeatedLineMinCount < 2 {
+		normalizer.RepeatedLineMinCount = 3
+	}
+
+	for _, filter := range settings.Filters {
+		pattern, err := regexp.Compile(filter.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("normalizer.go|NewNormalizer: invalid filter pattern %q: %w", filter.Pattern, err)
+		}
+		normalizer.Filters = append(normalizer.Filters, compiledFilter{pattern: pattern, replacement: filter.Replacement})
+	}
+
+	return normalizer, nil
+}
+
+// Normalize returns the cleaned text. Line breaks are always normalized to "\n"
+func (n *Normalizer) Normalize(text string) string {
+	text, _ = n.normalize(text)
+	return text
+}
+
+// normalize returns the cleaned text and the map of its offsets to the offsets of the text
+func (n *Normalizer) normalize(text string) (string, *offsetMap) {
+	offsets := &offsetMap{}
+	apply := func(edits []textEdit) {
+		if len(edits) > 0 {
+			text = applyEdits(text, edits)
+			offsets.steps = append(offsets.steps, edits)
+		}
+	}
+
+	apply(replaceEdits(text, "\r\n", "\n"))
+
+	if n.RemoveControlChars {
+		apply(controlCharEdits(text))
+	}
+	if n.NFKC {
+		apply(nfkcEdits(text))
+	}
+	if n.RemoveRepeatedLines {
+		apply(repeatedLineEdits(text, n.RepeatedLineMinCount))
+	}
+	if n.Dehyphenate {
+		var edits []textEdit
+		// the hyphen and the line break between the two letters are dropped
+		for _, match := range hyphenationPattern.FindAllStringSubmatchIndex(text, -1) {
+			edits = append(edits, textEdit{start: match[3], end: match[4]})
+		}
+		apply(edits)
+	}
+	for _, filter := range n.Filters {
+		var edits []textEdit
+		for _, match := range filter.pattern.FindAllStringSubmatchIndex(text, -1) {
+			replacement := filter.pattern.ExpandString(nil, filter.replacement, text, match)
+			edits = append(edits, textEdit{start: match[0], end: match[1], text: string(replacement)})
+		}
+		apply(edits)
+	}
+
+	return text, offsets
+}
+
+// textEdit replaces the bytes start to end of the input of a normalization rule with text,
+// which starts at out in the output of the rule
+type textEdit struct {
+	start, end int
+	text       string
+	out        int
+}
+
+// applyEdits returns the text with the edits, which are ordered and do not overlap, and sets their output offsets
+func applyEdits(text string, edits []textEdit) string {
+	var out strings.Builder
+	out.Grow(len(text))
+
+	from := 0
+	for i := range edits {
+		out.WriteString(text[from:edits[i].start])
+		edits[i].out = out.Len()
+		out.WriteString(edits[i].text)
+		from = edits[i].end
+	}
+	out.WriteString(text[from:])
+
+	return out.String()
+}
+
+// offsetMap maps the byte offsets of a normalized text back to the text before the normalization
+type offsetMap struct {
+	steps [][]textEdit // the edits of the rules that changed the text, in the order they ran
+}
+
+// source returns the offset in the text before the normalization. A start offset inside a
+// replaced part maps to the start of the part, an end offset to its end, so a span covers
+// the whole source of the normalized text it covers. A nil map keeps the offsets
+func (m *offsetMap) source(offset int, end bool) int {
+	if m == nil {
+		return offset
+	}
+	for i := len(m.steps) - 1; i >= 0; i-- {
+		offset = sourceOffset(m.steps[i], offset, end)
+	}
+	return offset
+}
+
+// sourceOffset maps the offset in the output of the edits to their input
+func sourceOffset(edits []textEdit, offset int, end bool) int {
+	if end {
+		// an end right before an edit does not take in the removed or replaced bytes
+		i := sort.Search(len(edits), func(i int) bool { return edits[i].out >= offset })
+		if i < len(edits) && edits[i].out == offset {
+			return edits[i].start
+		}
+	}
+
+	i := sort.Search(len(edits), func(i int) bool { return edits[i].out > offset }) - 1
+	if i < 0 {
+		return offset
+	}
+
+	edit := edits[i]
+	outEnd := edit.out + len(edit.text)
+	switch {
+	case offset >= outEnd:
+		return edit.end + offset - outEnd
+	case end:
+		return edit.end
+	default:
+		return edit.start
+	}
+}
+
+// replaceEdits replaces every old with new
+func replaceEdits(text string, old string, new string) []textEdit {
+	var edits []textEdit
+	for from := 0; ; {
+		i := strings.Index(text[from:], old)
+		if i < 0 {
+			return edits
+		}
+		from += i
+		edits = append(edits, textEdit{start: from, end: from + len(old), text: new})
+		from += len(old)
+	}
+}
+
+// controlCharEdits drops control and invisible format characters (e.g. soft hyphens and
+// zero width spaces). Newlines, tabs and form feeds, the page breaks, are kept
+func controlCharEdits(text string) []textEdit {
+	var edits []textEdit
+	for i, r := range text {
+		size := utf8.RuneLen(r)
+		if r == utf8.RuneError {
+			_, size = utf8.DecodeRuneInString(text[i:])
+		}
+
+		switch {
+		case r == '\n' || r == '\t' || r == '\f':
+		case r == '\r' || r == '\v':
+			edits = append(edits, textEdit{start: i, end: i + size, text: "\n"})
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r) || r == unicode.ReplacementChar:
+			edits = append(edits, textEdit{start: i, end: i + size})
+		}
+	}
+	return edits
+}
+
+// nfkcEdits replaces every segment of the text that changes under Unicode NFKC
+func nfkcEdits(text string) []textEdit {
+	var edits []textEdit
+	var iter norm.Iter
+	iter.InitString(norm.NFKC, text)
+	for !iter.Done() {
+		start := iter.Pos()
+		segment := string(iter.Next())
+		if end := iter.Pos(); segment != text[start:end] {
+			edits = append(edits, textEdit{start: start, end: end, text: segment})
+		}
+	}
+	return edits
+}
+
+// repeatedLineEdits drops every non-empty line that occurs at least minCount times, as page
+// headers and footers do. Lines are compared trimmed and with their numbers ignored, so
+// "Page 12" and "Page 13" are the same line
+func repeatedLineEdits(text string, minCount int) []textEdit {
+	lines := strings.Split(text, "\n")
+
+	key := func(line string) string {
+		return digitsPattern.ReplaceAllString(strings.Join(strings.Fields(line), " "), "#")
+	}
+
+	counts := make(map[string]int)
+	for _, line := range lines {
+		if k := key(line); k != "" {
+			counts[k]++
+		}
+	}
+
+	var edits []textEdit
+	removed := 0
+	lastKept := -1 // offset of the line break after the last kept line
+	for i, start := 0, 0; i < len(lines); start, i = start+len(lines[i])+1, i+1 {
+		end := start + len(lines[i])
+		if k := key(lines[i]); k == "" || counts[k] < minCount {
+			lastKept = end
+			continue
+		}
+
+		removed++
+		switch {
+		case strings.Contains(lines[i], extractor.PageBreak):
+			// the page break of a removed line is kept
+			edits = append(edits, textEdit{start: start, end: end, text: extractor.PageBreak})
+			lastKept = end
+		case i < len(lines)-1:
+			edits = append(edits, textEdit{start: start, end: end + 1})
+		default:
+			// the last line goes with the line break before it
+			if lastKept >= 0 {
+				edits = append(edits, textEdit{start: lastKept, end: lastKept + 1})
+			}
+			edits = append(edits, textEdit{start: start, end: end})
+		}
+	}
+
+	if removed > 0 {
+		log.Printf("normalizer.go|removeRepeatedLines: removed %d repeated lines", removed)
+	}
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	return edits
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"rag-pipeline/models"
+	"strings"
+	"testing"
+)
+
+func TestNormalizer(t *testing.T) {
+	normalizer, err := NewNormalizer(models.NormalizationSettings{
+		NFKC:                 true,
+		RemoveControlChars:   true,
+		Dehyphenate:          true,
+		RemoveRepeatedLines:  true,
+		RepeatedLineMinCount: 2,
+		Filters:              []models.RegexFilter{{Pattern: `\[(\d+)\]`, Replacement: "(ref $1)"}},
+	})
+	if err != nil {
+		t.Fatalf("NewNormalizer failed: %v", err)
+	}
+
+	text := "TREASURE ISLAND\r\n" +
+		"The ﬁrst chapter was long-\n  winded​ and\u0007 well-known [3].\n" +
+		"Page 1\n\f" +
+		"TREASURE ISLAND\n" +
+		"The end.\n" +
+		"Page 2"
+
+	expected := "The first chapter was longwinded and well-known (ref 3).\n\f\nThe end."
+	if got := normalizer.Normalize(text); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	// the offsets of the normalized text map back to the text it was normalized from
+	normalized, offsets := normalizer.normalize(text)
+	for word, source := range map[string]string{
+		"first":      "ﬁrst",
+		"longwinded": "long-\n  winded",
+		"and well":   "and\u0007 well",
+		"(ref 3)":    "[3]",
+		"The end.":   "The end.",
+	} {
+		start := strings.Index(normalized, word)
+		if got := text[offsets.source(start, false):offsets.source(start+len(word), true)]; got != source {
+			t.Errorf("Expected %q to map to %q, got %q", word, source, got)
+		}
+	}
+
+	// every rule can be switched off
+	disabled, _ := NewNormalizer(models.NormalizationSettings{})
+	if got := disabled.Normalize("ﬁne-\nprint\r\n"); got != "ﬁne-\nprint\n" {
+		t.Errorf("Expected only the line breaks to change, got %q", got)
+	}
+
+	if _, err := NewNormalizer(models.NormalizationSettings{Filters: []models.RegexFilter{{Pattern: "("}}}); err == nil {
+		t.Error("Expected an error for an invalid filter pattern")
+	}
+}
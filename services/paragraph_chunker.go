@@ -0,0 +1,65 @@
+package services
+
+import (
+	"log"
+	"rag-pipeline/models"
+	"strings"
+)
+
+// ParagraphChunker splits the text into windows of paragraphs and keeps their line breaks
+type ParagraphChunker struct {
+	ChunkSize    int // paragraphs per chunk
+	ChunkOverlap int // paragraphs shared by consecutive chunks
+}
+
+// NewParagraphChunker creates and returns a new ParagraphChunker
+func NewParagraphChunker(chunkSize int, chunkOverlap int) *ParagraphChunker {
+	return &ParagraphChunker{
+		ChunkSize:    chunkSize,
+		ChunkOverlap: chunkOverlap,
+	}
+}
+
+// ChunkText splits the input text into chunks of ChunkSize paragraphs
+func (config ParagraphChunker) ChunkText(text string) []models.Chunk {
+	paragraphs := splitParagraphs(text)
+	log.Printf("paragraph_chunker.go|ChunkText: %d paragraphs", len(paragraphs))
+
+	chunks := slidingWindow(paragraphs, config.ChunkSize, config.ChunkOverlap, "\n\n")
+	setLines(text, chunks)
+	return chunks
+}
+
+// splitParagraphs splits the text at blank lines and returns the non empty paragraphs,
+// their lines are trimmed and joined with "\n"
+func splitParagraphs(text string) []textUnit {
+	var paragraphs []textUnit
+	var lines []textUnit
+
+	flush := func() {
+		if len(lines) > 0 {
+			paragraphs = append(paragraphs, textUnit{text: joinUnits(lines, "\n"), start: lines[0].start, end: lines[len(lines)-1].end})
+			lines = nil
+		}
+	}
+
+	for offset := 0; offset <= len(text); {
+		end := strings.IndexByte(text[offset:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += offset
+		}
+
+		start, stop := trimSpan(text, offset, end)
+		if start == stop {
+			flush()
+		} else {
+			lines = append(lines, textUnit{text: text[start:stop], start: start, end: stop})
+		}
+		offset = end + 1
+	}
+	flush()
+
+	return paragraphs
+}
@@ -1,32 +1,95 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"path/filepath"
 	"rag-pipeline/db"
+	"rag-pipeline/extractor"
 	"rag-pipeline/models"
+	"rag-pipeline/utils"
+	"strings"
+	"time"
 )
 
+// embeddingSpecialTokens are the [CLS] and [SEP] tokens the embedding model adds to every chunk
+const embeddingSpecialTokens = 2
+
 type RAGService struct {
-	Chunker   *ChunkConfig
-	Embedder  *OllamaEmbedder
-	QdrantDB  *db.QdrantDatabase
-	Generator *LLMService
-	Config    *models.Config
+	Chunker       Chunker
+	ChunkSettings models.ChunkSettings // settings of Chunker, the defaults of a chunk preview
+	Normalizer    *Normalizer
+	Tokenizer     Tokenizer
+	Embedder      *OllamaEmbedder
+	VectorDB      db.VectorStore
+	Parents       db.VectorStore // parent chunks of parent-child retrieval, nil if it is disabled
+	Generator     *LLMService
+	Documents     *DocumentRegistry
+	Jobs          *JobQueue
+	Watcher       *FolderWatcher // nil unless watcher.enabled
+	Config        *models.Config
 }
 
-// NewRAGService initializes the RAG service by setting up the Qdrant client and preparing the vector database
+// NewRAGService initializes the RAG service by setting up the configured vector store and preparing the collection
 func NewRAGService(config *models.Config, collectionName string) (*RAGService, error) {
-	qdrantDB, err := db.NewQdrantDatabase(config.Qdrant.Host, config.Qdrant.Port, collectionName)
+	vectorDB, err := db.NewVectorStore(config, collectionName)
+	if err != nil {
+		return nil, fmt.Errorf("rag_service.go| NewRAGService: initialization error %w", err)
+	}
+
+	tokenizer, err := NewTokenizer(config)
+	if err != nil {
+		return nil, fmt.Errorf("rag_service.go| NewRAGService: initialization error %w", err)
+	}
+
+	embedder := NewOllamaEmbedder(config.Ollama.BaseURL, config.Embedding.ModelName, config.Embedding.Endpoint)
+
+	chunkSettings := ChunkSettingsFor(config, collectionName)
+	chunker, err := NewChunker(chunkSettings, tokenizer, embedder)
+	if err != nil {
+		return nil, fmt.Errorf("rag_service.go| NewRAGService: initialization error %w", err)
+	}
+
+	normalizer, err := NewNormalizer(config.Normalization)
+	if err != nil {
+		return nil, fmt.Errorf("rag_service.go| NewRAGService: initialization error %w", err)
+	}
+
+	var parents db.VectorStore
+	if parentChild := config.Retrieval.ParentChild; parentChild.Enabled {
+		if parentChild.ChildSize <= 0 || parentChild.ChildOverlap < 0 || parentChild.ChildOverlap >= parentChild.ChildSize {
+			return nil, fmt.Errorf("rag_service.go| NewRAGService: invalid parent_child child_size %d / child_overlap %d", parentChild.ChildSize, parentChild.ChildOverlap)
+		}
+
+		parents, err = db.NewVectorStore(config, parentsCollection(collectionName))
+		if err != nil {
+			return nil, fmt.Errorf("rag_service.go| NewRAGService: initialization error %w", err)
+		}
+	}
+
+	// the word tokenizer counts words, a word is often several tokens of the model
+	if tokenizerType := config.Tokenizer.Type; config.Embedding.MaxTokens > 0 && (tokenizerType == "" || tokenizerType == "word") {
+		log.Printf("rag_service.go| NewRAGService: embedding.max_tokens %d counts words with the word tokenizer, set tokenizer.type \"wordpiece\" to count the tokens of the embedding model", config.Embedding.MaxTokens)
+	}
+
+	documents, err := NewDocumentRegistry(registryPath(config, collectionName))
 	if err != nil {
 		return nil, fmt.Errorf("rag_service.go| NewRAGService: initialization error %w", err)
 	}
 
 	ragService := RAGService{
-		Chunker:   NewChunker(config.Chunk.Size, config.Chunk.Overlap),
-		Embedder:  NewOllamaEmbedder(config.Ollama.BaseURL, config.Embedding.ModelName, config.Embedding.Endpoint),
-		Generator: NewLLMService(config.Ollama.BaseURL, config.Generator.Endpoint, config.Generator.ModelName),
-		QdrantDB:  qdrantDB,
-		Config:    config,
+		Chunker:       chunker,
+		ChunkSettings: chunkSettings,
+		Normalizer:    normalizer,
+		Tokenizer:     tokenizer,
+		Embedder:      embedder,
+		Generator:     NewLLMService(config.Ollama.BaseURL, config.Generator.Endpoint, config.Generator.ModelName),
+		VectorDB:      vectorDB,
+		Parents:       parents,
+		Documents:     documents,
+		Config:        config,
 	}
 
 	if err := ragService.initializeRAGService(); err != nil {
@@ -36,27 +99,76 @@ func NewRAGService(config *models.Config, collectionName string) (*RAGService, e
 	return &ragService, nil
 }
 
-// StoreData sends the given text data to the vector database
-func (r *RAGService) StoreData(text string) error {
-	return r.storeData(text)
+// StartJobs starts the workers of the background ingest jobs of the collection, they resume
+// the jobs interrupted by a restart. Stop them with Jobs.Close
+func (r *RAGService) StartJobs(collectionName string) error {
+	jobs, err := NewJobQueue(r, jobsPath(r.Config, collectionName), r.Config.Jobs.Workers)
+	if err != nil {
+		return fmt.Errorf("rag_service.go| StartJobs: %w", err)
+	}
+
+	r.Jobs = jobs
+	return nil
 }
 
-// GenerateResponse retrieves the most relevant chunks for the given question,
-// sends them with the query to the generator model and returns the generated answer
-func (r *RAGService) GenerateResponse(question string) (string, []string, error) {
-	retrievalResult, err := r.RetrieveRelevantChunks(question, r.Config.Retrieval.TopK)
+// StartWatcher starts the folder watcher of the collection, see FolderWatcher.
+// Stop it with Watcher.Close
+func (r *RAGService) StartWatcher(collectionName string) error {
+	watcher, err := NewFolderWatcher(r, r.Config, collectionName)
 	if err != nil {
-		return "", nil, err
+		return fmt.Errorf("rag_service.go| StartWatcher: %w", err)
+	}
+
+	r.Watcher = watcher
+	go watcher.Run()
+	return nil
+}
+
+// StoreData sends the given file content to the vector database
+// and returns the record of the stored document
+func (r *RAGService) StoreData(filename string, content []byte) (*models.Document, error) {
+	return r.storeData(filename, content, nil)
+}
+
+// ListDocuments returns the records of all documents stored in the collection
+func (r *RAGService) ListDocuments() []models.Document {
+	return r.Documents.List()
+}
+
+// GetDocument returns the record of the document with the given id
+func (r *RAGService) GetDocument(id string) (models.Document, error) {
+	doc, ok := r.Documents.Get(id)
+	if !ok {
+		return models.Document{}, ErrDocumentNotFound
+	}
+
+	return doc, nil
+}
+
+// DeleteDocument removes all chunks of the document with the given id and its record
+func (r *RAGService) DeleteDocument(id string) error {
+	if _, ok := r.Documents.Get(id); !ok {
+		return ErrDocumentNotFound
+	}
+
+	if err := r.deleteChunks(id); err != nil {
+		return fmt.Errorf("rag_service.go| DeleteDocument: %w", err)
 	}
 
-	var chunks []string
-	for _, res := range retrievalResult {
-		chunks = append(chunks, res.Text)
+	return r.Documents.Remove(id)
+}
+
+// GenerateResponse retrieves the most relevant context for the given question from the chunks
+// matching the filter, sends it with the query to the generator model and returns the generated answer
+func (r *RAGService) GenerateResponse(question string, filter models.PayloadFilter) (string, []models.ContextPassage, error) {
+	passages, err := r.RetrieveContext(question, filter)
+	if err != nil {
+		return "", nil, err
 	}
 
-	generatedResponse, err := r.Generator.GenerateResponse(question, chunks)
+	generatedResponse, err := r.Generator.GenerateResponse(question, passages)
 
-	return generatedResponse, chunks, err
+	return generatedResponse, passages, err
 }
 
 // GenerateResponseWithoutChunks sends the given question directly to the the generator model
@@ -65,74 +177,361 @@ func (r *RAGService) GenerateResponseWithoutChunks(question string) (string, err
 	return r.Generator.GenerateResponseWithoutChunks(question)
 }
 
-// RetrieveRelevantChunks retrieves the most relevant chunks for the given query
-func (r *RAGService) RetrieveRelevantChunks(query string, topK int) ([]models.RetrievalResult, error) {
+// RetrieveRelevantChunks retrieves the most relevant chunks matching the filter for the given query
+func (r *RAGService) RetrieveRelevantChunks(query string, topK int, filter models.PayloadFilter) ([]models.RetrievalResult, error) {
 
 	queryEmbedding, err := r.Embedder.EmbedQuery(query)
 	if err != nil {
 		return nil, fmt.Errorf("RetrieveRelevantChunks: failed to embed query: %w", err)
 	}
 
-	searchResult, err := r.QdrantDB.QueryQdrant(queryEmbedding, uint64(topK))
+	results, err := r.VectorDB.Query(queryEmbedding, uint64(topK), filter)
 	if err != nil {
-		return nil, fmt.Errorf("RetrieveRelevantChunks: failed to query Qdrant: %w", err)
-	}
-
-	var results []models.RetrievalResult
-	for _, point := range searchResult {
-		results = append(results, models.RetrievalResult{
-			ChunkID: int(point.Payload["id"].GetIntegerValue()),
-			Text:    point.Payload["text"].GetStringValue(),
-			Score:   point.Score,
-		})
+		return nil, fmt.Errorf("RetrieveRelevantChunks: failed to query the vector store: %w", err)
 	}
 
 	return results, nil
 }
 
 func (r *RAGService) initializeRAGService() error {
-	isExist, err := r.QdrantDB.CollectionExists()
-	if err != nil {
+	if err := createCollection(r.VectorDB, uint64(r.Config.Embedding.ModelDimension)); err != nil {
 		return fmt.Errorf("rag_serivece| initializeRAGService: %w", err)
 	}
 
+	// the parents are not searched, their vectors are placeholders of one dimension
+	if r.Parents != nil {
+		if err := createCollection(r.Parents, 1); err != nil {
+			return fmt.Errorf("rag_serivece| initializeRAGService: parents: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// createCollection creates the collection of the store if it does not exist yet
+func createCollection(store db.VectorStore, vectorSize uint64) error {
+	isExist, err := store.CollectionExists()
+	if err != nil {
+		return err
+	}
+
 	if isExist {
 		return nil
 	}
 
-	if err := r.QdrantDB.CreateQdrantCollection(uint64(r.Config.Embedding.ModelDimension)); err != nil {
-		return fmt.Errorf("rag_serivece| initializeRAGService: %w", err)
-	}
+	return store.CreateCollection(vectorSize)
+}
 
-	return nil
+// ingestRun lets a background job follow and stop the ingest of a document
+type ingestRun struct {
+	ctx      context.Context
+	skip     int                     // chunks stored by an interrupted run, they are not embedded again
+	progress func(stored, total int) // called after every stored batch
 }
 
-// prepareVectorDatabase insert chunked and embedded data to db
-func (r *RAGService) storeData(text string) error {
+// storeData inserts the chunked and embedded content into the db and registers the document,
+// run is nil for a synchronous ingest
+func (r *RAGService) storeData(filename string, content []byte, run *ingestRun) (*models.Document, error) {
+
+	// PDFs, web pages and the other supported formats are turned into plain text first
+	extracted, err := extractor.Extract(filename, content)
+	if err != nil {
+		return nil, fmt.Errorf("rag_serivece| storeData: failed to extract the text of %s: %w", filename, err)
+	}
+
+	return r.storeExtracted(filename, content, extracted, run)
+}
 
+// storeExtracted chunks and stores the extracted text of the content like storeData
+func (r *RAGService) storeExtracted(filename string, content []byte, extracted models.ExtractedDocument, run *ingestRun) (*models.Document, error) {
 	//Chunks
-	chunks := r.Chunker.ChunkText(text)
+	chunks := r.chunkDocument(r.Chunker, filename, extracted)
 	if len(chunks) == 0 {
-		return fmt.Errorf("rag_serivece| prepareVectorDatabase: chunking failed: no chunks were created from the given text")
+		return nil, fmt.Errorf("rag_serivece| storeExtracted: chunking failed: no chunks were created from the given text")
+	}
+
+	doc := newDocument(filename, content, len(chunks), extracted.Metadata)
+
+	// the header is only embedded, the payload keeps the original chunk text for display
+	header := ""
+	if r.Config.ContextualHeaders.Enabled {
+		header = r.documentContextHeader(doc, extracted.Text)
+	}
+
+	if err := r.storeChunks(doc, chunks, header, run); err != nil {
+		return nil, fmt.Errorf("rag_serivece| storeExtracted: %w", err)
+	}
+
+	return &doc, nil
+}
+
+// newDocument returns the record of the uploaded file. The document ID is derived from the
+// content, so uploading the same file again produces the same point IDs and the upsert stays idempotent
+func newDocument(filename string, content []byte, chunkCount int, metadata map[string]any) models.Document {
+	return newDocumentWithHash(filename, utils.HashContent(content), len(content), chunkCount, metadata)
+}
+
+// newDocumentWithHash returns the record of a file with the given content hash and size, for files that are not read whole
+func newDocumentWithHash(filename string, contentHash string, size int, chunkCount int, metadata map[string]any) models.Document {
+	return models.Document{
+		ID:          contentHash[:32],
+		Filename:    filename,
+		Size:        size,
+		ChunkCount:  chunkCount,
+		ContentHash: contentHash,
+		IngestedAt:  time.Now().UTC(),
+		Metadata:    metadata,
 	}
+}
 
+// storeChunks embeds the chunks of the document, with the header prepended if it is not empty,
+// inserts them into the db and registers the document. The chunks are embedded and inserted in
+// batches of embedding.batch_size, so no embedding request grows with the size of the document
+func (r *RAGService) storeChunks(doc models.Document, chunks []models.Chunk, header string, run *ingestRun) error {
 	//prepare chunks for embeddings
 	chunk_texts := make([]string, len(chunks)) // 'make' for fast, direct indext assignment and no allocation
-	for i, chunk := range chunks {
-		chunk_texts[i] = chunk.Text
+	for i := range chunks {
+		chunks[i].DocumentID = doc.ID
+		chunks[i].Metadata = mergeMetadata(chunks[i].Metadata, documentMetadata(doc))
+		chunk_texts[i] = chunks[i].Text
+
+		if header != "" {
+			chunks[i].Metadata["context_header"] = header
+			chunk_texts[i] = header + "\n\n" + chunks[i].Text
+		}
 	}
 
-	//embedding
-	embeddings, err := r.Embedder.EmbedChunks(chunk_texts)
-	if err != nil {
-		return fmt.Errorf("rag_serivece.go| storeData: Fail EmbedChunks : %w", err)
+	start := 0
+	if run != nil {
+		start = min(run.skip, len(chunks))
 	}
 
-	//stores vectors in db
-	err = r.QdrantDB.AddVectorsToQdrant(chunks, embeddings)
-	if err != nil {
-		return fmt.Errorf("rag_serivece| prepareVectorDatabase: %w", err)
+	// a re-ingest of the document overwrites the points of its old chunks with the same IDs and
+	// deletes the others once all new chunks are stored, so a failed re-ingest keeps a complete
+	// document. A failed first ingest leaves no chunks
+	old, replacing := r.Documents.Get(doc.ID)
+	fail := func(err error) error {
+		if !replacing {
+			r.discardChunks(doc)
+		}
+		return err
+	}
+
+	// the parents are stored before their children, so every stored child can be resolved
+	parents := takeParents(chunks)
+	if len(parents) > 0 {
+		if err := r.storeParents(parents); err != nil {
+			return fail(err)
+		}
+	}
+
+	batchSize := r.Config.Embedding.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(chunks)
+	}
+
+	for ; start < len(chunks); start += batchSize {
+		// a cancelled job leaves no chunks of a document that is not registered
+		if run != nil && run.ctx.Err() != nil {
+			return fail(run.ctx.Err())
+		}
+
+		end := min(start+batchSize, len(chunks))
+
+		//embedding
+		embeddings, err := r.Embedder.EmbedChunks(chunk_texts[start:end])
+		if err != nil {
+			return fail(fmt.Errorf("Fail EmbedChunks : %w", err))
+		}
+
+		//stores vectors in db
+		if err := r.VectorDB.Upsert(chunks[start:end], embeddings); err != nil {
+			return fail(err)
+		}
+
+		if run != nil && run.progress != nil {
+			run.progress(end, len(chunks))
+		}
+	}
+
+	if replacing {
+		if err := r.deleteStaleChunks(doc.ID, old.ChunkCount, len(chunks), parentCount(parents)); err != nil {
+			return fmt.Errorf("failed to delete the old chunks: %w", err)
+		}
+	}
+
+	if err := r.Documents.Add(doc); err != nil {
+		return fmt.Errorf("failed to register document: %w", err)
+	}
+
+	return nil
+}
+
+// storeParents inserts the parent chunks of parent-child retrieval into the parent store
+func (r *RAGService) storeParents(parents []models.Chunk) error {
+	if r.Parents == nil {
+		return fmt.Errorf("failed to store parents: parent_child is not enabled")
 	}
 
+	placeholders := make([][]float32, len(parents))
+	for i := range placeholders {
+		placeholders[i] = []float32{1}
+	}
+	if err := r.Parents.Upsert(parents, placeholders); err != nil {
+		return fmt.Errorf("failed to store parents: %w", err)
+	}
+	return nil
+}
+
+// deleteChunks removes the chunks and the parents of the document
+func (r *RAGService) deleteChunks(documentID string) error {
+	filter := models.PayloadFilter{"document_id": documentID}
+	if err := r.VectorDB.Delete(filter); err != nil {
+		return err
+	}
+	if r.Parents != nil {
+		return r.Parents.Delete(filter)
+	}
+	return nil
+}
+
+// deleteStaleChunks removes the chunks and parents of an earlier ingest of the document with
+// oldCount chunks whose IDs are not used again. Parents have fewer IDs than their children
+func (r *RAGService) deleteStaleChunks(documentID string, oldCount int, chunkCount int, parentCount int) error {
+	stale := func(from int) models.PayloadFilter {
+		ids := make([]any, 0, oldCount-from)
+		for id := from; id < oldCount; id++ {
+			ids = append(ids, id)
+		}
+		return models.PayloadFilter{"document_id": documentID, "id": ids}
+	}
+
+	if chunkCount < oldCount {
+		if err := r.VectorDB.Delete(stale(chunkCount)); err != nil {
+			return err
+		}
+	}
+	if r.Parents != nil && parentCount < oldCount {
+		return r.Parents.Delete(stale(parentCount))
+	}
 	return nil
 }
+
+// parentCount returns the number of parent IDs of takeParents, 0 without parents
+func parentCount(parents []models.Chunk) int {
+	count := 0
+	for _, parent := range parents {
+		count = max(count, parent.ID+1)
+	}
+	return count
+}
+
+// discardChunks removes the chunks inserted for the document. The chunks of an earlier upload
+// of the same content were replaced, so its record is removed as well
+func (r *RAGService) discardChunks(doc models.Document) {
+	if err := r.deleteChunks(doc.ID); err != nil {
+		log.Printf("rag_service.go|discardChunks: failed to delete the chunks of %s: %v", doc.Filename, err)
+		return
+	}
+	if err := r.Documents.Remove(doc.ID); err != nil && !errors.Is(err, ErrDocumentNotFound) {
+		log.Printf("rag_service.go|discardChunks: failed to remove the record of %s: %v", doc.Filename, err)
+	}
+}
+
+// chunkDocument splits the text into the chunks that are embedded: the normalized text is
+// chunked, re-split to fit into the embedding model and gets parent-child and source spans applied.
+// The spans refer to the extracted text before the normalization, for plain text files the
+// uploaded bytes. Chunks of documents with page breaks record their pages, or their chapters
+// if the document is an e-book
+func (r *RAGService) chunkDocument(chunker Chunker, filename string, document models.ExtractedDocument) []models.Chunk {
+	text := document.Text
+	var offsets *offsetMap
+	if r.Normalizer != nil {
+		text, offsets = r.Normalizer.normalize(text)
+	}
+	source := newSourceSpans(document.Text, offsets)
+
+	// the page breaks become newlines of the same length, so the offsets stay valid
+	pageStarts := pageStartOffsets(text)
+	text = strings.ReplaceAll(text, extractor.PageBreak, "\n")
+
+	var chunks []models.Chunk
+	if fileChunker, ok := chunker.(FileChunker); ok {
+		chunks = fileChunker.ChunkFile(filename, text)
+	} else {
+		chunks = chunker.ChunkText(text)
+	}
+
+	// chunks that do not fit into the embedding model would be truncated by it
+	chunks = splitOversizedChunks(text, chunks, r.Tokenizer, r.chunkTokenLimit())
+	if len(document.Chapters) > 0 {
+		assignChapters(chunks, pageStarts, document.Chapters)
+	} else {
+		assignPages(chunks, pageStarts)
+	}
+
+	// the chunks become parents, only their small children are embedded
+	if parentChild := r.Config.Retrieval.ParentChild; parentChild.Enabled {
+		chunks = splitParentChild(text, chunks, parentChild.ChildSize, parentChild.ChildOverlap)
+	}
+	source.apply(chunks)
+
+	return chunks
+}
+
+// chunkTokenLimit returns the tokens a chunk may have so it is not truncated by the embedding model,
+// which adds [CLS] and [SEP] to embedding.max_tokens. 0 disables the check
+func (r *RAGService) chunkTokenLimit() int {
+	if r.Config.Embedding.MaxTokens <= 0 {
+		return 0
+	}
+	return max(r.Config.Embedding.MaxTokens-embeddingSpecialTokens, 1)
+}
+
+// documentMetadata returns the document fields and the extracted metadata written into every chunk payload
+func documentMetadata(doc models.Document) map[string]any {
+	return mergeMetadata(doc.Metadata, map[string]any{
+		"filename":     doc.Filename,
+		"size":         doc.Size,
+		"chunk_count":  doc.ChunkCount,
+		"content_hash": doc.ContentHash,
+		"ingested_at":  doc.IngestedAt.Format(time.RFC3339),
+	})
+}
+
+// mergeMetadata returns a new map with the entries of base and extra, extra wins on conflicts
+func mergeMetadata(base map[string]any, extra map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(extra))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range extra {
+		merged[key] = value
+	}
+	return merged
+}
+
+// registryPath returns the file of the document registry of the collection,
+// an empty path keeps the registry in memory
+func registryPath(config *models.Config, collectionName string) string {
+	if config.Storage.DataDir == "" {
+		return ""
+	}
+
+	return filepath.Join(config.Storage.DataDir, collectionName+"_documents.json")
+}
+
+// parentsCollection returns the collection of the parent chunks of the collection
+func parentsCollection(collectionName string) string {
+	return collectionName + "_parents"
+}
+
+// jobsPath returns the file of the ingest jobs of the collection, their uploaded files are kept
+// in the directory of the same name. An empty path keeps the jobs in memory
+func jobsPath(config *models.Config, collectionName string) string {
+	if config.Storage.DataDir == "" {
+		return ""
+	}
+
+	return filepath.Join(config.Storage.DataDir, collectionName+"_jobs.json")
+}
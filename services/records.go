@@ -0,0 +1,330 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"rag-pipeline/models"
+	"rag-pipeline/utils"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidRecords = errors.New("invalid records")
+
+// reservedPayloadKeys are written by the pipeline, record fields can not be stored under them.
+// The "parent_" keys of parent-child retrieval are reserved as well
+var reservedPayloadKeys = map[string]bool{
+	// chunk
+	"id": true, "text": true, "document_id": true, "record_id": true,
+	"start_offset": true, "end_offset": true, "start_line": true, "end_line": true,
+	// document
+	"filename": true, "size": true, "chunk_count": true, "content_hash": true,
+	"ingested_at": true, "format": true, "record_count": true,
+	"title": true, "author": true, "canonical_url": true, "source_url": true,
+	// chunkers and enrichment
+	"page": true, "page_end": true, "chapter": true, "chapter_number": true,
+	"heading_path": true, "context_header": true, "chunking_fallback": true,
+	"package": true, "symbol": true, "kind": true, "receiver": true, "file_path": true,
+}
+
+// StoreRecords stores every record of the JSON, JSONL or CSV file as its own retrievable unit.
+// The text fields of a record are embedded, its metadata fields become filterable payload values
+// and every chunk links back to the record by "record_id". The whole file is one document
+func (r *RAGService) StoreRecords(filename string, content []byte, settings models.RecordSettings) (*models.Document, error) {
+	if err := validateRecordSettings(settings); err != nil {
+		return nil, fmt.Errorf("records.go|StoreRecords: %w", err)
+	}
+
+	records, format, err := parseRecords(filename, content)
+	if err != nil {
+		return nil, fmt.Errorf("records.go|StoreRecords: %w", err)
+	}
+
+	var chunks []models.Chunk
+	parentBase, skipped := 0, 0
+	for i, record := range records {
+		text := recordText(record, settings.TextFields)
+		if text == "" {
+			skipped++
+			continue
+		}
+
+		metadata := recordMetadata(record, settings.MetadataFields)
+		metadata["record_id"] = recordID(record, settings.IDField, i)
+
+		// the chunks and parents are numbered across the file, so they stay unique within the document.
+		// The spans would point into the "field: value" text of the record, not into the file
+		parents := 0
+		for _, chunk := range r.chunkDocument(r.Chunker, filename, models.ExtractedDocument{Text: text}) {
+			chunk.ID = len(chunks)
+			chunk.Span = nil
+			chunk.Metadata = mergeMetadata(chunk.Metadata, metadata)
+			for _, key := range []string{"parent_start_offset", "parent_end_offset", "parent_start_line", "parent_end_line"} {
+				delete(chunk.Metadata, key)
+			}
+			if parentID, ok := chunk.Metadata["parent_id"]; ok {
+				chunk.Metadata["parent_id"] = parentBase + utils.ToInt(parentID)
+				parents = max(parents, utils.ToInt(parentID)+1)
+			}
+			chunks = append(chunks, chunk)
+		}
+		parentBase += parents
+	}
+
+	if skipped > 0 {
+		log.Printf("records.go|StoreRecords: skipped %d of %d records without text", skipped, len(records))
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("records.go|StoreRecords: %w: no record has text in the fields %v", ErrInvalidRecords, settings.TextFields)
+	}
+
+	doc := newDocument(filename, content, len(chunks), map[string]any{
+		"format":       format,
+		"record_count": len(records) - skipped,
+	})
+
+	if err := r.storeChunks(doc, chunks, "", nil); err != nil {
+		return nil, fmt.Errorf("records.go|StoreRecords: %w", err)
+	}
+
+	return &doc, nil
+}
+
+// validateRecordSettings checks that there are text fields and that no metadata field
+// would overwrite a payload value of the pipeline
+func validateRecordSettings(settings models.RecordSettings) error {
+	if len(settings.TextFields) == 0 {
+		return fmt.Errorf("%w: at least one text field is required", ErrInvalidRecords)
+	}
+	for _, field := range settings.MetadataFields {
+		if reservedPayloadKeys[field] || strings.HasPrefix(field, "parent_") {
+			return fmt.Errorf("%w: the metadata field %q is reserved", ErrInvalidRecords, field)
+		}
+	}
+	return nil
+}
+
+// parseRecords returns the records of the file and its format. JSON files hold an array of
+// objects, JSONL files one object per line and CSV files a header row with the field names.
+// Without a known extension the format is detected from the first character
+func parseRecords(filename string, content []byte) ([]map[string]any, string, error) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimSpace(content)
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	switch format {
+	case "json", "jsonl", "ndjson", "csv", "tsv":
+	default:
+		switch {
+		case bytes.HasPrefix(trimmed, []byte("[")):
+			format = "json"
+		case bytes.HasPrefix(trimmed, []byte("{")):
+			format = "jsonl"
+		default:
+			format = "csv"
+		}
+	}
+
+	var records []map[string]any
+	var err error
+	if format == "csv" || format == "tsv" {
+		records, err = parseCSVRecords(content, format == "tsv")
+	} else {
+		records, err = parseJSONRecords(content)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidRecords, err)
+	}
+	if len(records) == 0 {
+		return nil, "", fmt.Errorf("%w: the file contains no records", ErrInvalidRecords)
+	}
+
+	return records, format, nil
+}
+
+// parseJSONRecords decodes a JSON array of objects or a stream of objects, e.g. JSONL
+func parseJSONRecords(content []byte) ([]map[string]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber() // record IDs keep all their digits
+
+	var values []any
+	for {
+		var value any
+		if err := decoder.Decode(&value); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("record %d: %v", len(values)+1, err)
+		}
+
+		if array, ok := value.([]any); ok {
+			values = append(values, array...)
+		} else {
+			values = append(values, value)
+		}
+	}
+
+	records := make([]map[string]any, 0, len(values))
+	for i, value := range values {
+		record, ok := normalizeJSONValue(value).(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("record %d is not an object", i+1)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// normalizeJSONValue converts the json.Number values to int64 or float64
+func normalizeJSONValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i := range v {
+			v[i] = normalizeJSONValue(v[i])
+		}
+	case map[string]any:
+		for key := range v {
+			v[key] = normalizeJSONValue(v[key])
+		}
+	}
+	return value
+}
+
+// parseCSVRecords reads the rows of a CSV or TSV file, the first row names the fields
+func parseCSVRecords(content []byte, tabs bool) ([]map[string]any, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if tabs {
+		reader.Comma = '\t'
+	}
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := rows[0]
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	records := make([]map[string]any, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := make(map[string]any, len(header))
+		for i, name := range header {
+			if i < len(row) && name != "" {
+				record[name] = row[i]
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// recordField returns the value of the field, nested JSON fields are named by dotted paths, e.g. "customer.name"
+func recordField(record map[string]any, field string) (any, bool) {
+	if value, ok := record[field]; ok {
+		return value, true
+	}
+
+	var current any = record
+	for _, key := range strings.Split(field, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// recordText returns the text of the fields, several fields become "field: value" lines
+func recordText(record map[string]any, fields []string) string {
+	var lines []string
+	for _, field := range fields {
+		value, ok := recordField(record, field)
+		if !ok {
+			continue
+		}
+		text := strings.TrimSpace(valueText(value))
+		if text == "" {
+			continue
+		}
+		if len(fields) > 1 {
+			text = field + ": " + text
+		}
+		lines = append(lines, text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// recordMetadata returns the payload values of the fields. Numbers, booleans, strings and
+// lists of them are stored as they are, nested objects as JSON
+func recordMetadata(record map[string]any, fields []string) map[string]any {
+	metadata := make(map[string]any, len(fields)+1)
+	for _, field := range fields {
+		value, ok := recordField(record, field)
+		if !ok || value == nil {
+			continue
+		}
+		if object, ok := value.(map[string]any); ok {
+			encoded, _ := json.Marshal(object)
+			value = string(encoded)
+		}
+		metadata[field] = value
+	}
+	return metadata
+}
+
+// recordID returns the ID of the record as a string, the 1 based position of the
+// record if it has no ID field
+func recordID(record map[string]any, idField string, index int) string {
+	if idField != "" {
+		if value, ok := recordField(record, idField); ok && value != nil {
+			if id := strings.TrimSpace(valueText(value)); id != "" {
+				return id
+			}
+		}
+	}
+	return strconv.Itoa(index + 1)
+}
+
+// valueText returns the text of a record value, list elements are separated by ", "
+func valueText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, element := range v {
+			if text := valueText(element); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, ", ")
+	case map[string]any:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	default:
+		return fmt.Sprint(v)
+	}
+}
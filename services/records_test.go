@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"rag-pipeline/models"
+	"testing"
+)
+
+func TestParseRecords(t *testing.T) {
+	csv := "\xef\xbb\xbfticket, subject ,body\n42,Login fails,\"Cannot log in,\nsince Monday\"\n43,Short row\n"
+	records, format, err := parseRecords("tickets.csv", []byte(csv))
+	if err != nil {
+		t.Fatalf("parseRecords failed: %v", err)
+	}
+	if format != "csv" || len(records) != 2 {
+		t.Fatalf("Expected 2 csv records, got %d %s", len(records), format)
+	}
+	if records[0]["subject"] != "Login fails" || records[0]["body"] != "Cannot log in,\nsince Monday" {
+		t.Errorf("Unexpected first record %v", records[0])
+	}
+	if _, ok := records[1]["body"]; ok {
+		t.Errorf("Expected no body in the short row, got %v", records[1])
+	}
+
+	if text := recordText(records[0], []string{"body"}); text != "Cannot log in,\nsince Monday" {
+		t.Errorf("Expected the body alone, got %q", text)
+	}
+	if id := recordID(records[1], "ticket", 1); id != "43" {
+		t.Errorf("Expected ID 43, got %s", id)
+	}
+	if id := recordID(records[1], "missing", 1); id != "2" {
+		t.Errorf("Expected the position 2 as ID, got %s", id)
+	}
+
+	// a JSON array is detected without an extension, numbers keep all their digits
+	records, format, err = parseRecords("upload", []byte(` [{"id": 12345678901234567, "user": {"name": "Ada"}}]`))
+	if err != nil || format != "json" || len(records) != 1 {
+		t.Fatalf("Expected 1 json record, got %v %s %v", records, format, err)
+	}
+	if id := recordID(records[0], "id", 0); id != "12345678901234567" {
+		t.Errorf("Expected the full ID, got %s", id)
+	}
+	if metadata := recordMetadata(records[0], []string{"user.name", "user"}); metadata["user.name"] != "Ada" || metadata["user"] != `{"name":"Ada"}` {
+		t.Errorf("Unexpected metadata %v", metadata)
+	}
+
+	if _, _, err := parseRecords("bad.jsonl", []byte("{\"a\": 1}\n[1]\n")); !errors.Is(err, ErrInvalidRecords) {
+		t.Errorf("Expected ErrInvalidRecords for a record that is not an object, got %v", err)
+	}
+}
+
+func TestValidateRecordSettings(t *testing.T) {
+	// every payload key the pipeline writes
+	reserved := []string{
+		"id", "text", "document_id", "record_id", "start_offset", "end_offset", "start_line", "end_line",
+		"filename", "size", "chunk_count", "content_hash", "ingested_at", "format", "record_count",
+		"title", "author", "canonical_url", "source_url", "page", "page_end", "chapter", "chapter_number",
+		"heading_path", "context_header", "chunking_fallback", "package", "symbol", "kind", "receiver", "file_path",
+		"parent_id", "parent_text", "parent_start_offset",
+	}
+	for _, field := range reserved {
+		if err := validateRecordSettings(models.RecordSettings{TextFields: []string{"a"}, MetadataFields: []string{field}}); !errors.Is(err, ErrInvalidRecords) {
+			t.Errorf("Expected ErrInvalidRecords for the reserved metadata field %q, got %v", field, err)
+		}
+	}
+
+	if err := validateRecordSettings(models.RecordSettings{TextFields: []string{"a"}, MetadataFields: []string{"category", "customer.plan"}}); err != nil {
+		t.Errorf("Expected the metadata fields to be accepted, got %v", err)
+	}
+}
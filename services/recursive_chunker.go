@@ -0,0 +1,128 @@
+package services
+
+import (
+	"log"
+	"rag-pipeline/models"
+	"strings"
+)
+
+var defaultSeparators = []string{"\n\n", "\n", ". ", " "}
+
+// RecursiveChunker splits the text with the first separator that occurs in it,
+// splits pieces that are still too large with the next separators and merges
+// the small pieces back into chunks of at most ChunkSize, like the recursive
+// text splitters of the common RAG frameworks. Chunks are substrings of the text
+type RecursiveChunker struct {
+	ChunkSize    int
+	ChunkOverlap int
+	Separators   []string
+	Length       func(string) int // size of a piece, words by default
+}
+
+// NewRecursiveChunker creates and returns a new RecursiveChunker
+func NewRecursiveChunker(chunkSize int, chunkOverlap int, separators []string) *RecursiveChunker {
+	if len(separators) == 0 {
+		separators = defaultSeparators
+	}
+
+	return &RecursiveChunker{
+		ChunkSize:    chunkSize,
+		ChunkOverlap: chunkOverlap,
+		Separators:   separators,
+		Length:       wordCount,
+	}
+}
+
+// ChunkText splits the input text into chunks of at most ChunkSize
+func (config RecursiveChunker) ChunkText(text string) []models.Chunk {
+	var chunks []models.Chunk
+	for _, piece := range config.split(textUnit{text: text, end: len(text)}, config.Separators) {
+		start, end := trimSpan(text, piece.start, piece.end)
+		if start == end {
+			continue
+		}
+		chunks = append(chunks, models.Chunk{ID: len(chunks), Text: text[start:end], Span: &models.Span{StartOffset: start, EndOffset: end}})
+	}
+	setLines(text, chunks)
+
+	log.Printf("recursive_chunker.go|ChunkText: %d chunks", len(chunks))
+	return chunks
+}
+
+// split splits the text with the first separator found in it and returns the merged chunks
+func (config RecursiveChunker) split(text textUnit, separators []string) []textUnit {
+	separator := ""
+	var remaining []string
+	for i, candidate := range separators {
+		if strings.Contains(text.text, candidate) {
+			separator = candidate
+			remaining = separators[i+1:]
+			break
+		}
+	}
+
+	// no separator left, the text can not be split any further
+	if separator == "" {
+		return []textUnit{text}
+	}
+
+	var chunks []textUnit
+	var small []textUnit
+	for _, piece := range splitKeepSeparator(text, separator) {
+		if config.Length(piece.text) <= config.ChunkSize {
+			small = append(small, piece)
+			continue
+		}
+
+		chunks = append(chunks, config.merge(small)...)
+		small = nil
+		chunks = append(chunks, config.split(piece, remaining)...)
+	}
+	chunks = append(chunks, config.merge(small)...)
+
+	return chunks
+}
+
+// merge joins consecutive pieces into chunks of at most ChunkSize,
+// each chunk starts with up to ChunkOverlap of the end of the previous chunk
+func (config RecursiveChunker) merge(pieces []textUnit) []textUnit {
+	var chunks []textUnit
+	var current []textUnit
+	total := 0
+
+	for _, piece := range pieces {
+		length := config.Length(piece.text)
+
+		if total+length > config.ChunkSize && len(current) > 0 {
+			chunks = append(chunks, textUnit{text: joinUnits(current, ""), start: current[0].start, end: current[len(current)-1].end})
+
+			for len(current) > 0 && (total > config.ChunkOverlap || total+length > config.ChunkSize) {
+				total -= config.Length(current[0].text)
+				current = current[1:]
+			}
+		}
+
+		current = append(current, piece)
+		total += length
+	}
+
+	if len(current) > 0 {
+		chunks = append(chunks, textUnit{text: joinUnits(current, ""), start: current[0].start, end: current[len(current)-1].end})
+	}
+
+	return chunks
+}
+
+// splitKeepSeparator splits the text at every separator, the separator stays at the end of the piece before it
+func splitKeepSeparator(text textUnit, separator string) []textUnit {
+	var pieces []textUnit
+	offset := text.start
+	for _, piece := range strings.SplitAfter(text.text, separator) {
+		if piece == "" {
+			continue
+		}
+		pieces = append(pieces, textUnit{text: piece, start: offset, end: offset + len(piece)})
+		offset += len(piece)
+	}
+	return pieces
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"fmt"
+	"rag-pipeline/models"
+	"rag-pipeline/utils"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// RetrieveContext retrieves the most relevant chunks for the question and turns them into
+// the passages for the generator. With parent-child retrieval the matched children
+// are resolved to their deduplicated parents. A nil filter searches all chunks
+func (r *RAGService) RetrieveContext(question string, filter models.PayloadFilter) ([]models.ContextPassage, error) {
+	results, err := r.RetrieveRelevantChunks(question, r.Config.Retrieval.TopK, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Config.Retrieval.ParentChild.Enabled {
+		return r.resolveParents(results)
+	}
+
+	if r.Config.Retrieval.ExpandNeighbors > 0 {
+		return r.expandNeighbors(results, r.Config.Retrieval.ExpandNeighbors)
+	}
+
+	return chunkPassages(results), nil
+}
+
+// expandNeighbors extends every hit with the n chunks before and after it in the same document.
+// Hits whose windows touch are merged into one passage, the overlap between consecutive
+// chunks is removed and the passages are ordered by the best score of their hits
+func (r *RAGService) expandNeighbors(results []models.RetrievalResult, n int) ([]models.ContextPassage, error) {
+	// the records of a record file are separate units, a window never crosses them
+	type unit struct{ documentID, recordID string }
+
+	var unitOrder []unit
+	hitsByUnit := make(map[unit][]models.RetrievalResult)
+	for _, result := range results {
+		key := unit{result.DocumentID, recordOf(result.Metadata)}
+		if _, ok := hitsByUnit[key]; !ok {
+			unitOrder = append(unitOrder, key)
+		}
+		hitsByUnit[key] = append(hitsByUnit[key], result)
+	}
+
+	var passages []models.ContextPassage
+	for _, key := range unitOrder {
+		hits := hitsByUnit[key]
+		sort.SliceStable(hits, func(i, j int) bool {
+			return hits[i].ChunkID < hits[j].ChunkID
+		})
+
+		for start := 0; start < len(hits); {
+			// hits[start:end] expand into the contiguous window [first, last]
+			first, last := max(hits[start].ChunkID-n, 0), hits[start].ChunkID+n
+			end := start + 1
+			for end < len(hits) && hits[end].ChunkID-n <= last+1 {
+				last = hits[end].ChunkID + n
+				end++
+			}
+
+			passage, err := r.neighborPassage(key.documentID, hits[start:end], first, last)
+			if err != nil {
+				return nil, err
+			}
+			passages = append(passages, passage)
+			start = end
+		}
+	}
+
+	sort.SliceStable(passages, func(i, j int) bool {
+		return passages[i].Score > passages[j].Score
+	})
+
+	return passages, nil
+}
+
+// neighborPassage fetches the chunks first to last of the document and merges them into one passage
+func (r *RAGService) neighborPassage(documentID string, hits []models.RetrievalResult, first int, last int) (models.ContextPassage, error) {
+	ids := make([]int, 0, last-first+1)
+	for id := first; id <= last; id++ {
+		ids = append(ids, id)
+	}
+
+	neighbors, err := r.VectorDB.Get(documentID, ids)
+	if err != nil {
+		return models.ContextPassage{}, fmt.Errorf("retriever.go|neighborPassage: %w", err)
+	}
+	neighbors = slices.DeleteFunc(neighbors, func(neighbor models.RetrievalResult) bool {
+		return recordOf(neighbor.Metadata) != recordOf(hits[0].Metadata)
+	})
+	sort.Slice(neighbors, func(i, j int) bool {
+		return neighbors[i].ChunkID < neighbors[j].ChunkID
+	})
+
+	var span *models.Span
+	if len(neighbors) > 0 && neighbors[0].Span != nil && neighbors[len(neighbors)-1].Span != nil {
+		first, last := neighbors[0].Span, neighbors[len(neighbors)-1].Span
+		span = &models.Span{StartOffset: first.StartOffset, EndOffset: last.EndOffset, StartLine: first.StartLine, EndLine: last.EndLine}
+	}
+
+	best := hits[0]
+	passage := models.ContextPassage{DocumentID: documentID}
+	for _, hit := range hits {
+		passage.MatchedChunkIDs = append(passage.MatchedChunkIDs, hit.ChunkID)
+		if hit.Score > best.Score {
+			best = hit
+		}
+	}
+	passage.Text = mergeNeighborTexts(neighbors)
+	passage.Score = best.Score
+	passage.Metadata = best.Metadata
+	passage.Span = span
+
+	// the chunks may be missing if the document was deleted meanwhile
+	if passage.Text == "" {
+		passage.Text = best.Text
+		passage.Span = best.Span
+	}
+
+	return passage, nil
+}
+
+// recordOf returns the record ID of the chunk metadata, "" for chunks of documents
+func recordOf(metadata map[string]any) string {
+	if id, ok := metadata["record_id"]; ok {
+		return fmt.Sprint(id)
+	}
+	return ""
+}
+
+// mergeNeighborTexts joins the texts of consecutive chunks, the part a chunk shares with the
+// previous chunk (the chunk overlap) is only kept once. The overlap is taken from the spans,
+// so text that merely repeats at a chunk boundary is kept; chunks without spans fall back
+// to the longest run of words the two texts share
+func mergeNeighborTexts(chunks []models.RetrievalResult) string {
+	var merged strings.Builder
+	for i, chunk := range chunks {
+		if i == 0 {
+			merged.WriteString(chunk.Text)
+			continue
+		}
+
+		prev, text := chunks[i-1], chunk.Text
+		limit := len(text)
+		if prev.Span != nil && chunk.Span != nil {
+			limit = prev.Span.EndOffset - chunk.Span.StartOffset
+			// a chunker that keeps the text as it is repeats the overlap byte for byte
+			if limit > 0 && limit <= len(text) && strings.HasSuffix(prev.Text, text[:limit]) {
+				merged.WriteString(text[limit:])
+				continue
+			}
+		}
+
+		if cut := sharedPrefix(prev.Text, text, limit); cut > 0 {
+			merged.WriteString(text[cut:])
+			continue
+		}
+
+		separator := " "
+		if prev.Span != nil && chunk.Span != nil && chunk.Span.StartLine > prev.Span.EndLine {
+			separator = "\n"
+		}
+		merged.WriteString(separator)
+		merged.WriteString(text)
+	}
+	return merged.String()
+}
+
+// sharedPrefix returns the byte offset in text after the most leading words that also end prev,
+// the shared words rejoined with single spaces take at most limit bytes. 0 if no word is shared
+func sharedPrefix(prev string, text string, limit int) int {
+	prevWords := strings.Fields(prev)
+
+	// the leading words of text and the offsets at which they end
+	var words []string
+	var ends []int
+	for offset := 0; len(words) < len(prevWords); {
+		rest := strings.TrimLeftFunc(text[offset:], unicode.IsSpace)
+		if rest == "" {
+			break
+		}
+		start := len(text) - len(rest)
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		}
+		words = append(words, rest[:end])
+		offset = start + end
+		ends = append(ends, offset)
+	}
+
+	for k := len(words); k > 0; k-- {
+		if len(strings.Join(words[:k], " ")) <= limit && slices.Equal(prevWords[len(prevWords)-k:], words[:k]) {
+			return ends[k-1]
+		}
+	}
+	return 0
+}
+
+// chunkPassages returns one passage per retrieved chunk
+func chunkPassages(results []models.RetrievalResult) []models.ContextPassage {
+	passages := make([]models.ContextPassage, 0, len(results))
+	for _, result := range results {
+		passages = append(passages, models.ContextPassage{
+			DocumentID:      result.DocumentID,
+			Text:            result.Text,
+			MatchedChunkIDs: []int{result.ChunkID},
+			Score:           result.Score,
+			Metadata:        result.Metadata,
+			Span:            result.Span,
+		})
+	}
+	return passages
+}
+
+// resolveParents groups the retrieved children by their parent and returns one passage
+// with the parent text per parent, ordered by the best score of its children
+func (r *RAGService) resolveParents(results []models.RetrievalResult) ([]models.ContextPassage, error) {
+	// the parents of every document are fetched at once
+	parentIDs := make(map[string][]int)
+	for _, result := range results {
+		if parentID, ok := result.Metadata["parent_id"]; ok {
+			parentIDs[result.DocumentID] = append(parentIDs[result.DocumentID], utils.ToInt(parentID))
+		}
+	}
+	stored := make(map[string]models.RetrievalResult) // document and parent id -> parent
+	for documentID, ids := range parentIDs {
+		if r.Parents == nil {
+			break
+		}
+		parents, err := r.Parents.Get(documentID, ids)
+		if err != nil {
+			return nil, fmt.Errorf("retriever.go|resolveParents: %w", err)
+		}
+		for _, parent := range parents {
+			stored[fmt.Sprintf("%s/%d", documentID, parent.ChunkID)] = parent
+		}
+	}
+
+	var passages []models.ContextPassage
+	byParent := make(map[string]int) // document and parent id -> index in passages
+
+	for _, result := range results {
+		value, hasParent := result.Metadata["parent_id"]
+		parentID := utils.ToInt(value)
+		key := fmt.Sprintf("%s/%d", result.DocumentID, parentID)
+
+		parent, ok := stored[key]
+		if !hasParent || !ok {
+			// a chunk stored before parent-child retrieval was enabled, or whose parent is gone
+			passages = append(passages, chunkPassages([]models.RetrievalResult{result})...)
+			continue
+		}
+
+		if i, ok := byParent[key]; ok {
+			passages[i].MatchedChunkIDs = append(passages[i].MatchedChunkIDs, result.ChunkID)
+			continue
+		}
+
+		metadata := make(map[string]any, len(result.Metadata))
+		for k, v := range result.Metadata {
+			if !strings.HasPrefix(k, "parent_") {
+				metadata[k] = v
+			}
+		}
+
+		byParent[key] = len(passages)
+		passages = append(passages, models.ContextPassage{
+			DocumentID:      result.DocumentID,
+			Text:            parent.Text,
+			MatchedChunkIDs: []int{result.ChunkID},
+			ParentID:        &parentID,
+			Score:           result.Score,
+			Metadata:        metadata,
+			Span:            parent.Span,
+		})
+	}
+
+	return passages, nil
+}
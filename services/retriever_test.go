@@ -0,0 +1,216 @@
+package services
+
+import (
+	"rag-pipeline/db"
+	"rag-pipeline/models"
+	"reflect"
+	"testing"
+)
+
+func TestResolveParents(t *testing.T) {
+	parents := []models.Chunk{
+		{ID: 0, Text: "a b c d", Metadata: map[string]any{"heading_path": "Intro"}, Span: &models.Span{StartOffset: 0, EndOffset: 7, StartLine: 1, EndLine: 1}},
+		{ID: 1, Text: "e f"},
+	}
+	children := splitParentChild("a b c d", parents, 2, 0)
+	assertChunks(t, children, []string{"a b", "c d", "e f"})
+	for i := range children {
+		children[i].DocumentID = "doc"
+	}
+
+	// the parents are stored once, the children only keep their parent id
+	stored := takeParents(children)
+	if len(stored) != 2 || stored[0].Text != "a b c d" || stored[0].Span.EndOffset != 7 || stored[1].ID != 1 {
+		t.Fatalf("Expected the 2 parents, got %+v", stored)
+	}
+	for _, child := range children {
+		if child.Metadata["parent_text"] != nil || child.Metadata["parent_start_offset"] != nil || child.Metadata["parent_id"] == nil {
+			t.Errorf("Expected only the parent id in child %d, got %v", child.ID, child.Metadata)
+		}
+	}
+
+	r := &RAGService{Parents: db.NewMemoryDatabase("test_parents")}
+	if err := r.Parents.CreateCollection(1); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	if err := r.storeParents(stored); err != nil {
+		t.Fatalf("storeParents failed: %v", err)
+	}
+
+	// results as the vector store returns them, best first
+	results := make([]models.RetrievalResult, 0, len(children))
+	for _, i := range []int{1, 2, 0} {
+		results = append(results, models.RetrievalResult{
+			ChunkID:    children[i].ID,
+			DocumentID: "doc",
+			Text:       children[i].Text,
+			Score:      float32(3-len(results)) / 3,
+			Metadata:   children[i].Metadata,
+		})
+	}
+
+	passages, err := r.resolveParents(results)
+	if err != nil {
+		t.Fatalf("resolveParents failed: %v", err)
+	}
+	if len(passages) != 2 {
+		t.Fatalf("Expected 2 parent passages, got %d", len(passages))
+	}
+
+	if passages[0].Text != "a b c d" || *passages[0].ParentID != 0 {
+		t.Errorf("Expected parent 0 first, got %+v", passages[0])
+	}
+	if !reflect.DeepEqual(passages[0].MatchedChunkIDs, []int{1, 0}) {
+		t.Errorf("Expected matched children [1 0], got %v", passages[0].MatchedChunkIDs)
+	}
+	if passages[0].Metadata["heading_path"] != "Intro" || passages[0].Metadata["parent_id"] != nil {
+		t.Errorf("Unexpected parent metadata: %v", passages[0].Metadata)
+	}
+	if passages[0].Span == nil || passages[0].Span.EndOffset != 7 {
+		t.Errorf("Expected the span of parent 0, got %+v", passages[0].Span)
+	}
+
+	if passages[1].Text != "e f" || !reflect.DeepEqual(passages[1].MatchedChunkIDs, []int{2}) {
+		t.Errorf("Expected parent 1 with child 2, got %+v", passages[1])
+	}
+
+	// a child whose parent is gone is passed on as it is
+	if err := r.Parents.Delete(models.PayloadFilter{"document_id": "doc"}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	passages, err = r.resolveParents(results[:1])
+	if err != nil {
+		t.Fatalf("resolveParents failed: %v", err)
+	}
+	if len(passages) != 1 || passages[0].Text != "c d" || passages[0].ParentID != nil {
+		t.Errorf("Expected the child passage, got %+v", passages)
+	}
+}
+
+func TestExpandNeighbors(t *testing.T) {
+	vectorDB := db.NewMemoryDatabase("test_collection")
+	if err := vectorDB.CreateCollection(2); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+
+	// chunks with an overlap of one word
+	chunks := slidingWindow(textWords("a b c d e f g h i j k", 0), 3, 1, " ")
+	assertChunks(t, chunks, []string{"a b c", "c d e", "e f g", "g h i", "i j k"})
+
+	embeddings := make([][]float32, len(chunks))
+	for i := range chunks {
+		chunks[i].DocumentID = "doc"
+		embeddings[i] = []float32{1, float32(i)}
+	}
+	if err := vectorDB.Upsert(chunks, embeddings); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+
+	r := &RAGService{VectorDB: vectorDB}
+	results := []models.RetrievalResult{
+		{ChunkID: 4, DocumentID: "doc", Text: "i j k", Score: 0.9},
+		{ChunkID: 0, DocumentID: "doc", Text: "a b c", Score: 0.5},
+	}
+
+	passages, err := r.expandNeighbors(results, 1)
+	if err != nil {
+		t.Fatalf("expandNeighbors failed: %v", err)
+	}
+	if len(passages) != 2 {
+		t.Fatalf("Expected 2 passages, got %d", len(passages))
+	}
+	if passages[0].Text != "g h i j k" || !reflect.DeepEqual(passages[0].MatchedChunkIDs, []int{4}) {
+		t.Errorf("Expected chunks 3-4 around hit 4 first, got %+v", passages[0])
+	}
+	if passages[1].Text != "a b c d e" || passages[1].Score != 0.5 {
+		t.Errorf("Expected chunks 0-1 around hit 0, got %+v", passages[1])
+	}
+
+	// windows that touch become one passage
+	passages, err = r.expandNeighbors(results, 2)
+	if err != nil {
+		t.Fatalf("expandNeighbors failed: %v", err)
+	}
+	if len(passages) != 1 {
+		t.Fatalf("Expected 1 merged passage, got %d", len(passages))
+	}
+	if passages[0].Text != "a b c d e f g h i j k" || passages[0].Score != 0.9 {
+		t.Errorf("Expected the whole document with the best score, got %+v", passages[0])
+	}
+	if !reflect.DeepEqual(passages[0].MatchedChunkIDs, []int{0, 4}) {
+		t.Errorf("Expected matched chunks [0 4], got %v", passages[0].MatchedChunkIDs)
+	}
+
+	// a window never crosses the records of a record file
+	for i := range chunks {
+		record := "2"
+		if i < 2 {
+			record = "1"
+		}
+		chunks[i].Metadata = map[string]any{"record_id": record}
+	}
+	if err := vectorDB.Upsert(chunks, embeddings); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	hit := models.RetrievalResult{ChunkID: 2, DocumentID: "doc", Text: "e f g", Score: 0.9, Metadata: map[string]any{"record_id": "2"}}
+	passages, err = r.expandNeighbors([]models.RetrievalResult{hit}, 1)
+	if err != nil {
+		t.Fatalf("expandNeighbors failed: %v", err)
+	}
+	if len(passages) != 1 || passages[0].Text != "e f g h i" {
+		t.Errorf("Expected chunks 2-3 of record 2, got %+v", passages)
+	}
+}
+
+func TestMergeNeighborTexts(t *testing.T) {
+	chunk := func(text string, start int, end int, line int) models.RetrievalResult {
+		return models.RetrievalResult{Text: text, Span: &models.Span{StartOffset: start, EndOffset: end, StartLine: line, EndLine: line}}
+	}
+
+	tests := []struct {
+		name   string
+		chunks []models.RetrievalResult
+		want   string
+	}{
+		{
+			// "a b a b a b c" with an overlap of two words, the longest shared run is four words
+			name:   "overlap shorter than the repeated phrase",
+			chunks: []models.RetrievalResult{chunk("a b a b", 0, 7, 1), chunk("a b a b c", 4, 13, 1)},
+			want:   "a b a b a b c",
+		},
+		{
+			name:   "repeated phrase without overlap",
+			chunks: []models.RetrievalResult{chunk("the end of it", 0, 13, 1), chunk("of it all", 14, 23, 1)},
+			want:   "the end of it of it all",
+		},
+		{
+			name:   "layout is kept",
+			chunks: []models.RetrievalResult{chunk("func a() {\n\treturn\n}", 0, 20, 1), chunk("}\n\nfunc b() {\n\treturn\n}", 19, 42, 3)},
+			want:   "func a() {\n\treturn\n}\n\nfunc b() {\n\treturn\n}",
+		},
+		{
+			name:   "chunk on a later line",
+			chunks: []models.RetrievalResult{chunk("first paragraph", 0, 15, 1), chunk("second paragraph", 17, 33, 3)},
+			want:   "first paragraph\nsecond paragraph",
+		},
+		{
+			// the words were rejoined, the overlap is matched by words within the span overlap
+			name:   "rejoined words",
+			chunks: []models.RetrievalResult{chunk("x y z", 0, 8, 1), chunk("z x y", 6, 12, 1)},
+			want:   "x y z x y",
+		},
+		{
+			name:   "chunks without spans",
+			chunks: []models.RetrievalResult{{Text: "a b c"}, {Text: "c d e"}},
+			want:   "a b c d e",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeNeighborTexts(tt.chunks); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
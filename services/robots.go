@@ -0,0 +1,147 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRules are the rules of a robots.txt for the user agent of the crawler
+type robotsRules struct {
+	rules       []robotsRule
+	crawlDelay  time.Duration
+	disallowAll bool // the robots.txt could not be read, nothing may be fetched
+}
+
+// robotsRule is an Allow or Disallow line, the pattern may contain "*" and end with "$"
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// robotsGroup is a group of User-agent lines and the rules that follow them
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// parseRobots returns the rules of the group that matches the user agent most specifically,
+// or of the "*" groups if no group names it. Several groups for the same agent are merged
+func parseRobots(content []byte, userAgent string) *robotsRules {
+	// the product token of "rag-pipeline/1.0 (+https://...)" is "rag-pipeline"
+	token := strings.ToLower(strings.TrimSpace(userAgent))
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	var groups []*robotsGroup
+	var current *robotsGroup
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// a User-agent line after rules starts a new group
+			if current == nil || len(current.rules) > 0 || current.crawlDelay > 0 {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current != nil && value != "" {
+				current.rules = append(current.rules, robotsRule{pattern: value, allow: key == "allow"})
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); current != nil && err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	// the longest agent name that the product token starts with is the most specific match
+	bestLength := -1
+	rules := &robotsRules{}
+	for _, group := range groups {
+		length := -1
+		for _, agent := range group.agents {
+			if agent == "*" {
+				length = max(length, 0)
+			} else if agent != "" && strings.HasPrefix(token, agent) {
+				length = max(length, len(agent))
+			}
+		}
+
+		if length < 0 {
+			continue
+		}
+		if length > bestLength {
+			bestLength = length
+			rules = &robotsRules{}
+		}
+		if length == bestLength {
+			rules.rules = append(rules.rules, group.rules...)
+			rules.crawlDelay = max(rules.crawlDelay, group.crawlDelay)
+		}
+	}
+
+	return rules
+}
+
+// allowed reports whether the path, with its query, may be fetched. The longest matching
+// rule decides, Allow wins over Disallow of the same length
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+
+	allow, bestLength := true, -1
+	for _, rule := range r.rules {
+		if !matchRobotsPattern(rule.pattern, path) {
+			continue
+		}
+		if length := len(rule.pattern); length > bestLength || length == bestLength && rule.allow {
+			allow, bestLength = rule.allow, length
+		}
+	}
+	return allow
+}
+
+// matchRobotsPattern reports whether the path starts with the pattern, "*" matches any
+// characters and a "$" at the end anchors the pattern at the end of the path
+func matchRobotsPattern(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+
+	for i, part := range parts[1:] {
+		// the last part of an anchored pattern has to match the end of the path
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		index := strings.Index(rest, part)
+		if index < 0 {
+			return false
+		}
+		rest = rest[index+len(part):]
+	}
+
+	return !anchored || rest == ""
+}
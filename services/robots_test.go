@@ -0,0 +1,60 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	robots := `# comment
+User-agent: *
+Disallow: /private
+Allow: /private/open
+Disallow: /*.pdf$
+
+User-agent: rag-pipeline
+User-agent: other-bot
+Disallow: /drafts/ # no drafts
+Allow: /drafts/public
+Crawl-delay: 2
+
+User-agent: rag
+Disallow: /
+`
+	rules := parseRobots([]byte(robots), "rag-pipeline/1.0 (+https://example.com)")
+	if rules.crawlDelay != 2*time.Second {
+		t.Errorf("Expected a crawl delay of 2s, got %v", rules.crawlDelay)
+	}
+
+	// the "rag-pipeline" group is more specific than "rag" and "*"
+	for path, expected := range map[string]bool{
+		"/":                    true,
+		"/private":             true,
+		"/drafts/a":            false,
+		"/drafts/public/a":     true,
+		"/drafts/a?page=2":     false,
+		"/private/open/report": true,
+	} {
+		if rules.allowed(path) != expected {
+			t.Errorf("allowed(%q): expected %v", path, expected)
+		}
+	}
+
+	rules = parseRobots([]byte(robots), "curl/8.0")
+	for path, expected := range map[string]bool{
+		"/private/x":           false,
+		"/private/open":        true,
+		"/docs/a.pdf":          false,
+		"/docs/a.pdf?download": true,
+		"/drafts/a":            true,
+	} {
+		if rules.allowed(path) != expected {
+			t.Errorf("allowed(%q) for the * group: expected %v", path, expected)
+		}
+	}
+
+	var missing *robotsRules
+	if !missing.allowed("/anything") || (&robotsRules{disallowAll: true}).allowed("/") {
+		t.Error("Expected a missing robots.txt to allow and an unreadable one to disallow everything")
+	}
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"rag-pipeline/models"
+	"sort"
+)
+
+const semanticEmbedBatchSize = 64 // sentences per embedding request
+
+// Embedder embeds texts, OllamaEmbedder is the implementation used by the pipeline
+type Embedder interface {
+	EmbedChunks(chunks []string) ([][]float32, error)
+}
+
+// SemanticChunker groups consecutive sentences into chunks and starts a new chunk where
+// the meaning shifts: wherever the cosine distance between the embeddings of neighbouring
+// sentences reaches the BreakpointPercentile of all neighbour distances in the document
+type SemanticChunker struct {
+	Embedder             Embedder
+	BreakpointPercentile float64   // 0-100
+	MinSize              int       // a chunk is not closed at a breakpoint before it has MinSize
+	MaxSize              int       // a chunk is always closed before it exceeds MaxSize
+	Tokenizer            Tokenizer // if set, the sizes count tokens instead of words
+}
+
+// NewSemanticChunker creates and returns a new SemanticChunker, it fails unless 0 <= minSize <= maxSize
+// and maxSize is positive
+func NewSemanticChunker(embedder Embedder, breakpointPercentile float64, minSize int, maxSize int) (*SemanticChunker, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("semantic_chunker.go|NewSemanticChunker: max size must be positive, got %d", maxSize)
+	}
+	if minSize < 0 || minSize > maxSize {
+		return nil, fmt.Errorf("semantic_chunker.go|NewSemanticChunker: min size must be in [0, %d], got %d", maxSize, minSize)
+	}
+	if breakpointPercentile <= 0 || breakpointPercentile > 100 {
+		breakpointPercentile = 95
+	}
+
+	return &SemanticChunker{
+		Embedder:             embedder,
+		BreakpointPercentile: breakpointPercentile,
+		MinSize:              minSize,
+		MaxSize:              maxSize,
+	}, nil
+}
+
+// ChunkText splits the input text into chunks at the semantic breakpoints between its sentences.
+// If the sentences can not be embedded, the chunks are only bounded by MaxSize and record
+// the fallback as "chunking_fallback" in their metadata
+func (config SemanticChunker) ChunkText(text string) []models.Chunk {
+	sentences := splitSentences(text)
+	if len(sentences) == 0 {
+		return nil
+	}
+
+	texts := make([]string, len(sentences))
+	for i, sentence := range sentences {
+		texts[i] = sentence.text
+	}
+
+	distances, err := config.neighbourDistances(texts)
+	if err != nil {
+		log.Printf("semantic_chunker.go|ChunkText: falling back to size based chunks, %v", err)
+		distances = make([]float64, len(sentences)-1)
+	}
+
+	threshold := math.Inf(1)
+	if len(distances) > 0 && err == nil {
+		threshold = percentile(distances, config.BreakpointPercentile)
+	}
+
+	var chunks []models.Chunk
+	var current []textUnit
+	size := 0
+
+	flush := func() {
+		chunks = append(chunks, models.Chunk{ID: len(chunks), Text: joinUnits(current, " "), Span: unitSpan(current)})
+		current, size = nil, 0
+	}
+
+	for i, sentence := range sentences {
+		length := config.length(sentence.text)
+
+		if len(current) > 0 && size+length > config.MaxSize {
+			flush()
+		}
+
+		current = append(current, sentence)
+		size += length
+
+		if i < len(distances) && distances[i] >= threshold && size >= config.MinSize {
+			flush()
+		}
+	}
+
+	if len(current) > 0 {
+		flush()
+	}
+	setLines(text, chunks)
+
+	if err != nil {
+		for i := range chunks {
+			chunks[i].Metadata = map[string]any{"chunking_fallback": "size"}
+		}
+	}
+
+	log.Printf("semantic_chunker.go|ChunkText: %d sentences, %d chunks", len(sentences), len(chunks))
+	return chunks
+}
+
+// neighbourDistances embeds the sentences and returns the cosine distance of every sentence to the next one
+func (config SemanticChunker) neighbourDistances(sentences []string) ([]float64, error) {
+	var embeddings [][]float32
+	for start := 0; start < len(sentences); start += semanticEmbedBatchSize {
+		end := min(start+semanticEmbedBatchSize, len(sentences))
+
+		batch, err := config.Embedder.EmbedChunks(sentences[start:end])
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+	}
+
+	if len(embeddings) != len(sentences) {
+		return nil, fmt.Errorf("semantic_chunker.go|neighbourDistances: got %d embeddings for %d sentences", len(embeddings), len(sentences))
+	}
+
+	distances := make([]float64, len(sentences)-1)
+	for i := range distances {
+		distances[i] = 1 - cosineSimilarity(embeddings[i], embeddings[i+1])
+	}
+
+	return distances, nil
+}
+
+// length returns the size of the text in words or tokens
+func (config SemanticChunker) length(text string) int {
+	if config.Tokenizer != nil {
+		return config.Tokenizer.CountTokens(text)
+	}
+	return wordCount(text)
+}
+
+// percentile returns the p-th percentile (0-100) of the values, interpolating between neighbours
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// cosineSimilarity returns the cosine similarity of two vectors of the same size
+func cosineSimilarity(a []float32, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
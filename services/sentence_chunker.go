@@ -0,0 +1,105 @@
+package services
+
+import (
+	"log"
+	"rag-pipeline/models"
+	"strings"
+	"unicode"
+)
+
+// abbreviations that end with a period but do not end a sentence
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true,
+	"st": true, "mt": true, "vs": true, "etc": true, "e.g": true, "i.e": true, "no": true,
+	"fig": true, "vol": true, "inc": true, "ltd": true, "co": true, "jan": true, "feb": true,
+	"mar": true, "apr": true, "jun": true, "jul": true, "aug": true, "sep": true, "sept": true,
+	"oct": true, "nov": true, "dec": true, "u.s": true, "a.m": true, "p.m": true,
+}
+
+// SentenceChunker splits the text into windows of sentences
+type SentenceChunker struct {
+	ChunkSize    int // sentences per chunk
+	ChunkOverlap int // sentences shared by consecutive chunks
+}
+
+// NewSentenceChunker creates and returns a new SentenceChunker
+func NewSentenceChunker(chunkSize int, chunkOverlap int) *SentenceChunker {
+	return &SentenceChunker{
+		ChunkSize:    chunkSize,
+		ChunkOverlap: chunkOverlap,
+	}
+}
+
+// ChunkText splits the input text into chunks of ChunkSize sentences
+func (config SentenceChunker) ChunkText(text string) []models.Chunk {
+	sentences := splitSentences(text)
+	log.Printf("sentence_chunker.go|ChunkText: %d sentences", len(sentences))
+
+	chunks := slidingWindow(sentences, config.ChunkSize, config.ChunkOverlap, " ")
+	setLines(text, chunks)
+	return chunks
+}
+
+// splitSentences splits the text into sentences. A sentence ends at '.', '!' or '?'
+// followed by whitespace, unless the word is a known abbreviation or an initial,
+// and at every blank line. Whitespace inside a sentence is collapsed to single spaces
+func splitSentences(text string) []textUnit {
+	var sentences []textUnit
+	var current []textUnit
+
+	flush := func() {
+		if len(current) > 0 {
+			sentences = append(sentences, textUnit{text: joinUnits(current, " "), start: current[0].start, end: current[len(current)-1].end})
+			current = nil
+		}
+	}
+
+	for _, paragraph := range splitParagraphs(text) {
+		words := textWords(text[paragraph.start:paragraph.end], paragraph.start)
+		for i, word := range words {
+			current = append(current, word)
+
+			if !endsSentence(word.text) {
+				continue
+			}
+
+			// the next word must not continue the sentence in lower case
+			if i+1 < len(words) {
+				next := []rune(strings.TrimLeft(words[i+1].text, "\"'([“‘"))
+				if len(next) > 0 && unicode.IsLower(next[0]) {
+					continue
+				}
+			}
+
+			flush()
+		}
+		flush()
+	}
+
+	return sentences
+}
+
+// endsSentence reports whether the word closes a sentence
+func endsSentence(word string) bool {
+	trimmed := strings.TrimRight(word, "\"')]”’")
+	if trimmed == "" {
+		return false
+	}
+
+	switch trimmed[len(trimmed)-1] {
+	case '!', '?':
+		return true
+	case '.':
+		stem := strings.ToLower(strings.TrimLeft(strings.TrimSuffix(trimmed, "."), "\"'([“‘"))
+		if abbreviations[stem] {
+			return false
+		}
+		// initials such as "J." in "J. R. R. Tolkien"
+		if len([]rune(stem)) == 1 && unicode.IsLetter([]rune(stem)[0]) {
+			return false
+		}
+		return stem != ""
+	default:
+		return false
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"rag-pipeline/extractor"
+	"rag-pipeline/models"
+	"rag-pipeline/utils"
+	"sort"
+	"strings"
+)
+
+// lineStarts returns the byte offsets at which the lines of the text start
+func lineStarts(text string) []int {
+	starts := []int{0}
+	for offset := 0; ; {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i < 0 {
+			return starts
+		}
+		offset += i + 1
+		starts = append(starts, offset)
+	}
+}
+
+// lineOf returns the 1 based line of the byte offset
+func lineOf(lineStarts []int, offset int) int {
+	return sort.Search(len(lineStarts), func(i int) bool {
+		return lineStarts[i] > offset
+	})
+}
+
+// setLines sets the lines of the spans of the chunks from their offsets in the text
+func setLines(text string, chunks []models.Chunk) {
+	starts := lineStarts(text)
+	for i := range chunks {
+		if span := chunks[i].Span; span != nil {
+			span.StartLine = lineOf(starts, span.StartOffset)
+			span.EndLine = lineOf(starts, max(span.EndOffset-1, span.StartOffset))
+		}
+	}
+}
+
+// sourceSpans maps the spans of the normalized text to the source text it was normalized
+// from, so they can be highlighted in the uploaded document
+type sourceSpans struct {
+	offsets    *offsetMap
+	lineStarts []int // byte offset of the first byte of every line of the source
+}
+
+// newSourceSpans returns the span map of the source, offsets is nil if the text was not normalized
+func newSourceSpans(source string, offsets *offsetMap) *sourceSpans {
+	return &sourceSpans{offsets: offsets, lineStarts: lineStarts(source)}
+}
+
+// apply maps the spans of the chunks, and the parent spans splitParentChild wrote into their
+// metadata, to the source and counts their lines in it
+func (s *sourceSpans) apply(chunks []models.Chunk) {
+	for i := range chunks {
+		if chunks[i].Span != nil {
+			chunks[i].Span = s.span(chunks[i].Span.StartOffset, chunks[i].Span.EndOffset)
+		}
+
+		metadata := chunks[i].Metadata
+		if _, ok := metadata["parent_start_offset"]; ok {
+			parent := s.span(utils.ToInt(metadata["parent_start_offset"]), utils.ToInt(metadata["parent_end_offset"]))
+			metadata["parent_start_offset"] = parent.StartOffset
+			metadata["parent_end_offset"] = parent.EndOffset
+			metadata["parent_start_line"] = parent.StartLine
+			metadata["parent_end_line"] = parent.EndLine
+		}
+	}
+}
+
+// span returns the source span of the offsets in the normalized text
+func (s *sourceSpans) span(start int, end int) *models.Span {
+	start = s.offsets.source(start, false)
+	end = max(s.offsets.source(end, true), start+1)
+	return &models.Span{StartOffset: start, EndOffset: end, StartLine: s.line(start), EndLine: s.line(end - 1)}
+}
+
+// line returns the 1 based line of the byte offset in the source
+func (s *sourceSpans) line(offset int) int {
+	return lineOf(s.lineStarts, offset)
+}
+
+// pageStartOffsets returns the offsets at which the pages of the text start,
+// nil if the text has no page breaks
+func pageStartOffsets(text string) []int {
+	if !strings.Contains(text, extractor.PageBreak) {
+		return nil
+	}
+
+	starts := []int{0}
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], extractor.PageBreak)
+		if i < 0 {
+			return starts
+		}
+		offset += i + len(extractor.PageBreak)
+		starts = append(starts, offset)
+	}
+}
+
+// assignPages writes the 1 based first and last page of every chunk with a span into
+// its metadata as "page" and "page_end". Nothing is written without page starts
+func assignPages(chunks []models.Chunk, pageStarts []int) {
+	if len(pageStarts) == 0 {
+		return
+	}
+
+	for i := range chunks {
+		if chunks[i].Span == nil {
+			continue
+		}
+		chunks[i].Metadata = mergeMetadata(chunks[i].Metadata, map[string]any{
+			"page":     pageOf(pageStarts, chunks[i].Span.StartOffset),
+			"page_end": pageOf(pageStarts, chunks[i].Span.EndOffset-1),
+		})
+	}
+}
+
+// assignChapters writes the title and the 1 based number of the chapter a chunk starts in into
+// its metadata as "chapter" and "chapter_number". The chapters are the pages of the text
+func assignChapters(chunks []models.Chunk, pageStarts []int, titles []string) {
+	if len(pageStarts) == 0 {
+		pageStarts = []int{0} // a single chapter
+	}
+
+	for i := range chunks {
+		if chunks[i].Span == nil {
+			continue
+		}
+		number := pageOf(pageStarts, chunks[i].Span.StartOffset)
+		metadata := map[string]any{"chapter_number": number}
+		if number <= len(titles) && titles[number-1] != "" {
+			metadata["chapter"] = titles[number-1]
+		}
+		chunks[i].Metadata = mergeMetadata(chunks[i].Metadata, metadata)
+	}
+}
+
+// pageOf returns the 1 based page of the offset
+func pageOf(pageStarts []int, offset int) int {
+	return sort.Search(len(pageStarts), func(i int) bool {
+		return pageStarts[i] > offset
+	})
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"rag-pipeline/models"
+	"strings"
+	"testing"
+)
+
+// assertSpans checks that every chunk has a span over its words in the text and that the chunks
+// follow each other in the text, so a chunk of repeated words does not point at an earlier copy
+func assertSpans(t *testing.T, name string, text string, chunks []models.Chunk) {
+	t.Helper()
+
+	starts := lineStarts(text)
+	for i, chunk := range chunks {
+		span := chunk.Span
+		if span == nil {
+			t.Fatalf("%s: expected a span for chunk %d", name, i)
+		}
+		if got := strings.Fields(text[span.StartOffset:span.EndOffset]); strings.Join(got, " ") != strings.Join(strings.Fields(chunk.Text), " ") {
+			t.Errorf("%s: chunk %d spans %q, expected the words of %q", name, i, text[span.StartOffset:span.EndOffset], chunk.Text)
+		}
+		if span.StartLine != lineOf(starts, span.StartOffset) || span.EndLine != lineOf(starts, span.EndOffset-1) {
+			t.Errorf("%s: chunk %d has lines %d-%d for offsets %d-%d", name, i, span.StartLine, span.EndLine, span.StartOffset, span.EndOffset)
+		}
+		if i > 0 && span.StartOffset <= chunks[i-1].Span.StartOffset {
+			t.Errorf("%s: chunk %d starts at %d, not after chunk %d at %d", name, i, span.StartOffset, i-1, chunks[i-1].Span.StartOffset)
+		}
+	}
+}
+
+func TestChunkerSpans(t *testing.T) {
+	text := "The  first line.\nSecond   line here.\r\n\r\nThird line ünd more.\n\n" +
+		"The  first line.\nSecond   line here.\r\n\r\nThird line ünd more.\n"
+
+	chunkers := map[string]Chunker{
+		"word":      NewWordChunker(4, 1),
+		"sentence":  NewSentenceChunker(2, 1),
+		"paragraph": NewParagraphChunker(1, 0),
+		"recursive": NewRecursiveChunker(5, 2, nil),
+		"markdown":  NewMarkdownChunker(4),
+		"semantic":  newSemanticChunker(t, topicEmbedder{}, 50, 1, 4),
+	}
+	for name, chunker := range chunkers {
+		assertSpans(t, name, text, chunker.ChunkText(text))
+	}
+
+	chunks := NewWordChunker(4, 1).ChunkText(text)
+	expected := []models.Span{
+		{StartOffset: 0, EndOffset: 23, StartLine: 1, EndLine: 2},
+		{StartOffset: 17, EndOffset: 45, StartLine: 2, EndLine: 4},
+	}
+	for i, want := range expected {
+		if *chunks[i].Span != want {
+			t.Errorf("Chunk %d: expected span %+v, got %+v", i, want, *chunks[i].Span)
+		}
+	}
+
+	source := "package sample\n\nfunc a() {}\n\nfunc a() {}\n"
+	assertSpans(t, "go", source, NewGoChunker(nil).ChunkText(source))
+}
+
+func TestChunkerSpansRepeatedText(t *testing.T) {
+	text := strings.Repeat("0 ", 27)
+
+	// every window starts 4 words, 8 bytes, after the previous one
+	chunks := NewWordChunker(5, 1).ChunkText(text)
+	assertSpans(t, "word", text, chunks)
+	for i, chunk := range chunks {
+		if chunk.Span.StartOffset != 8*i || chunk.Span.EndOffset != min(8*i+9, len(text)-1) {
+			t.Errorf("Chunk %d: expected offsets %d-%d, got %d-%d", i, 8*i, min(8*i+9, len(text)-1), chunk.Span.StartOffset, chunk.Span.EndOffset)
+		}
+	}
+
+	repeated := strings.Repeat("Same sentence here. ", 6) + "\n\n" + strings.Repeat("Same sentence here.\n\n", 4)
+	for name, chunker := range map[string]Chunker{
+		"sentence":  NewSentenceChunker(2, 1),
+		"paragraph": NewParagraphChunker(1, 0),
+		"recursive": NewRecursiveChunker(4, 1, nil),
+		"markdown":  NewMarkdownChunker(3),
+		"semantic":  newSemanticChunker(t, failingEmbedder{}, 50, 1, 5),
+	} {
+		assertSpans(t, name, repeated, chunker.ChunkText(repeated))
+	}
+}
+
+func TestSplitParentChildSpans(t *testing.T) {
+	text := strings.Repeat("a b c ", 4)
+	parents := NewWordChunker(6, 0).ChunkText(text)
+	children := splitParentChild(text, parents, 2, 1)
+	assertSpans(t, "children", text, children)
+
+	// the children of the second parent are cut from its span, not from the first copy of its words
+	for _, child := range children {
+		parent := parents[child.Metadata["parent_id"].(int)].Span
+		if child.Span.StartOffset < parent.StartOffset || child.Span.EndOffset > parent.EndOffset {
+			t.Errorf("Child %d at %d-%d is outside its parent at %d-%d", child.ID, child.Span.StartOffset, child.Span.EndOffset, parent.StartOffset, parent.EndOffset)
+		}
+	}
+}
+
+func TestAssignPages(t *testing.T) {
+	text := "first page\n\fsecond page\n\fthird page"
+	starts := pageStartOffsets(text)
+	if len(starts) != 3 || starts[1] != 12 || starts[2] != 25 {
+		t.Fatalf("Unexpected page starts: %v", starts)
+	}
+
+	chunks := []models.Chunk{
+		{Text: "first page", Span: &models.Span{StartOffset: 0, EndOffset: 10}},
+		{Text: "page second page third", Span: &models.Span{StartOffset: 6, EndOffset: 30}},
+		{Text: "page", Span: &models.Span{StartOffset: 31, EndOffset: 35}},
+	}
+	assignPages(chunks, starts)
+
+	if chunks[0].Metadata["page"] != 1 || chunks[0].Metadata["page_end"] != 1 {
+		t.Errorf("Expected chunk 0 on page 1, got %v", chunks[0].Metadata)
+	}
+	if chunks[1].Metadata["page"] != 1 || chunks[1].Metadata["page_end"] != 3 {
+		t.Errorf("Expected chunk 1 on pages 1-3, got %v", chunks[1].Metadata)
+	}
+
+	// without page breaks no pages are recorded
+	plain := []models.Chunk{{Text: "first", Span: &models.Span{StartOffset: 0, EndOffset: 5}}}
+	assignPages(plain, pageStartOffsets("first"))
+	if plain[0].Metadata != nil {
+		t.Errorf("Expected no page metadata, got %v", plain[0].Metadata)
+	}
+
+	// the pages of an e-book are its chapters, a chunk belongs to the chapter it starts in
+	chapters := []models.Chunk{
+		{Text: "page second", Span: &models.Span{StartOffset: 6, EndOffset: 18}},
+		{Text: "second page", Span: &models.Span{StartOffset: 12, EndOffset: 23}},
+	}
+	assignChapters(chapters, starts, []string{"Intro", "", "End"})
+	if chapters[0].Metadata["chapter"] != "Intro" || chapters[0].Metadata["chapter_number"] != 1 {
+		t.Errorf("Expected chunk 0 in chapter Intro, got %v", chapters[0].Metadata)
+	}
+	if _, ok := chapters[1].Metadata["chapter"]; ok || chapters[1].Metadata["chapter_number"] != 2 {
+		t.Errorf("Expected chunk 1 in the untitled chapter 2, got %v", chapters[1].Metadata)
+	}
+}
+
+func TestChunkDocumentSourceSpans(t *testing.T) {
+	normalizer, err := NewNormalizer(models.NormalizationSettings{NFKC: true, RemoveControlChars: true, Dehyphenate: true})
+	if err != nil {
+		t.Fatalf("NewNormalizer failed: %v", err)
+	}
+	r := &RAGService{Normalizer: normalizer, Config: &models.Config{}}
+
+	source := "The ﬁrst line\r\nsecond long-\r\nwinded line\r\n\u200bthird ﬂoor here\r\n"
+	chunks := r.chunkDocument(NewWordChunker(3, 0), "book.txt", models.ExtractedDocument{Text: source})
+
+	// the spans cover the uploaded bytes, not the normalized text
+	expected := []struct {
+		text, source       string
+		startLine, endLine int
+	}{
+		{"The first line", "The ﬁrst line", 1, 1},
+		{"second longwinded line", "second long-\r\nwinded line", 2, 3},
+		{"third floor here", "third ﬂoor here", 4, 4},
+	}
+	if len(chunks) != len(expected) {
+		t.Fatalf("Expected %d chunks, got %d", len(expected), len(chunks))
+	}
+	for i, want := range expected {
+		span := chunks[i].Span
+		if chunks[i].Text != want.text || span == nil {
+			t.Fatalf("Chunk %d: expected %q with a span, got %q %+v", i, want.text, chunks[i].Text, span)
+		}
+		if got := source[span.StartOffset:span.EndOffset]; got != want.source {
+			t.Errorf("Chunk %d: expected the source %q, got %q", i, want.source, got)
+		}
+		if span.StartLine != want.startLine || span.EndLine != want.endLine {
+			t.Errorf("Chunk %d: expected lines %d-%d, got %d-%d", i, want.startLine, want.endLine, span.StartLine, span.EndLine)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"rag-pipeline/extractor"
+	"rag-pipeline/models"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	streamBlockSize      = 64 << 10 // bytes read and normalized at once
+	streamMaxBlockSize   = 1 << 20  // a block without whitespace is cut at this size
+	streamMaxWordSize    = 1 << 20  // a longer word is cut into words of this size
+	defaultStreamBatches = 32       // chunks per embedding request if embedding.batch_size is not set
+)
+
+// StoreReader stores the file read from file like StoreData. Plain text files of at least
+// streaming.min_size bytes are streamed: they are chunked, embedded and inserted batch by batch
+// while they are read, so the memory does not grow with the file. Other files are read whole
+func (r *RAGService) StoreReader(filename string, file io.ReadSeeker, size int64) (*models.Document, error) {
+	return r.storeReader(filename, file, size, nil)
+}
+
+// storeReader is StoreReader, run is nil for a synchronous ingest
+func (r *RAGService) storeReader(filename string, file io.ReadSeeker, size int64, run *ingestRun) (*models.Document, error) {
+	head := make([]byte, uploadHeadSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("streaming.go|storeReader: failed to read %s: %w", filename, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("streaming.go|storeReader: failed to rewind %s: %w", filename, err)
+	}
+	if !supportedHead(filename, head[:n]) {
+		return nil, fmt.Errorf("streaming.go|storeReader: %s: %w", filename, ErrUnsupportedFile)
+	}
+
+	if !r.streams(size, filename, head[:n]) {
+		content, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("streaming.go|storeReader: failed to read %s: %w", filename, err)
+		}
+		return r.storeData(filename, content, run)
+	}
+
+	return r.storeStream(filename, file, size, run)
+}
+
+// streams reports whether the file is streamed. Only the chunks of the word windows do not depend
+// on the text after them, and the other options need the whole text, e.g. the document summary.
+// The filters of the normalizer are not streamed, their matches may cross the blocks
+func (r *RAGService) streams(size int64, filename string, head []byte) bool {
+	minSize := r.Config.Streaming.MinSize
+	if minSize <= 0 || size < minSize || !extractor.IsPlainText(filename, head) {
+		return false
+	}
+	if _, ok := r.Chunker.(*WordChunker); !ok {
+		return false
+	}
+	if r.Config.Retrieval.ParentChild.Enabled || r.Config.ContextualHeaders.Enabled {
+		return false
+	}
+	return r.Normalizer == nil || (!r.Normalizer.RemoveRepeatedLines && len(r.Normalizer.Filters) == 0)
+}
+
+// storeStream stores a plain text file in three passes over it: the content is hashed for the
+// document ID, the chunks are counted for the chunk_count of the payloads, and the chunks are
+// embedded and inserted in batches. The chunks of the files streams accepts, their spans and
+// pages are the same as StoreData gives them, on repeated text as well
+func (r *RAGService) storeStream(filename string, file io.ReadSeeker, size int64, run *ingestRun) (*models.Document, error) {
+	log.Printf("streaming.go|storeStream: streaming %s, %d bytes", filename, size)
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, fmt.Errorf("streaming.go|storeStream: failed to read %s: %w", filename, err)
+	}
+
+	count := 0
+	pages, err := r.streamChunks(file, false, func(models.Chunk) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("streaming.go|storeStream: %w", err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("streaming.go|storeStream: chunking failed: no chunks were created from the given text")
+	}
+
+	doc := newDocumentWithHash(filename, hex.EncodeToString(hash.Sum(nil)), int(size), count, map[string]any{"format": "text"})
+	metadata := documentMetadata(doc)
+
+	batchSize := r.Config.Embedding.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultStreamBatches
+	}
+
+	skip := 0
+	if run != nil {
+		skip = run.skip
+	}
+
+	// a re-ingest overwrites the old chunks and deletes the unused ones at the end, like storeChunks
+	old, replacing := r.Documents.Get(doc.ID)
+
+	batch := make([]models.Chunk, 0, batchSize)
+	texts := make([]string, 0, batchSize)
+	flush := func() error {
+		// a cancelled job leaves no chunks of a document that is not registered, see below
+		if run != nil && run.ctx.Err() != nil {
+			return run.ctx.Err()
+		}
+
+		embeddings, err := r.Embedder.EmbedChunks(texts)
+		if err != nil {
+			return fmt.Errorf("Fail EmbedChunks : %w", err)
+		}
+		if err := r.VectorDB.Upsert(batch, embeddings); err != nil {
+			return err
+		}
+
+		if run != nil && run.progress != nil {
+			run.progress(batch[len(batch)-1].ID+1, count)
+		}
+		batch, texts = batch[:0], texts[:0]
+		return nil
+	}
+
+	_, err = r.streamChunks(file, pages, func(chunk models.Chunk) error {
+		if chunk.ID < skip {
+			return nil
+		}
+
+		chunk.DocumentID = doc.ID
+		chunk.Metadata = mergeMetadata(chunk.Metadata, metadata)
+		batch = append(batch, chunk)
+		texts = append(texts, chunk.Text)
+		if len(batch) < batchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && len(batch) > 0 {
+		err = flush()
+	}
+	if err != nil {
+		if !replacing {
+			r.discardChunks(doc)
+		}
+		return nil, fmt.Errorf("streaming.go|storeStream: %w", err)
+	}
+
+	if replacing {
+		if err := r.deleteStaleChunks(doc.ID, old.ChunkCount, count, 0); err != nil {
+			return nil, fmt.Errorf("streaming.go|storeStream: failed to delete the old chunks: %w", err)
+		}
+	}
+
+	if err := r.Documents.Add(doc); err != nil {
+		return nil, fmt.Errorf("streaming.go|storeStream: failed to register document: %w", err)
+	}
+
+	return &doc, nil
+}
+
+// streamChunks reads the text from the beginning of the file and passes its chunks to emit in
+// order. The text is normalized block by block, the blocks end at a line break. With pages the
+// chunks record their pages like assignPages. It reports whether the text has page breaks
+func (r *RAGService) streamChunks(file io.ReadSeeker, pages bool, emit func(models.Chunk) error) (bool, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, fmt.Errorf("streamChunks: failed to rewind the file: %w", err)
+	}
+
+	wordChunker := r.Chunker.(*WordChunker)
+	chunker := &streamChunker{
+		size:      wordChunker.ChunkSize,
+		overlap:   wordChunker.ChunkOverlap,
+		unit:      wordChunker.Tokenizer,
+		tokenizer: r.Tokenizer,
+		maxTokens: r.chunkTokenLimit(),
+		pages:     pages,
+		line:      1,
+		page:      1,
+		emit:      emit,
+	}
+
+	read := make([]byte, streamBlockSize)
+	var buffer []byte
+	for {
+		n, readErr := file.Read(read)
+		buffer = append(buffer, read[:n]...)
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return false, fmt.Errorf("streamChunks: failed to read the file: %w", readErr)
+		}
+		eof := errors.Is(readErr, io.EOF)
+
+		cut := len(buffer)
+		if !eof {
+			cut = blockEnd(buffer)
+		}
+		if cut > 0 {
+			source := string(buffer[:cut])
+			block, offsets := source, (*offsetMap)(nil)
+			if r.Normalizer != nil {
+				block, offsets = r.Normalizer.normalize(source)
+			}
+			if err := chunker.write(source, block, offsets); err != nil {
+				return false, err
+			}
+			buffer = append(buffer[:0], buffer[cut:]...)
+		}
+
+		if eof {
+			break
+		}
+	}
+
+	if err := chunker.flush(); err != nil {
+		return false, err
+	}
+	return chunker.pageBreaks, nil
+}
+
+// blockEnd returns the length of the block at the beginning of the buffer that is normalized and
+// chunked next, 0 if more has to be read. A block ends after a line break that does not follow a
+// hyphen, so words hyphenated across lines are rejoined by the normalizer. Longer lines are cut
+// at whitespace, text without whitespace at a rune boundary
+func blockEnd(buffer []byte) int {
+	if len(buffer) < streamBlockSize {
+		return 0
+	}
+
+	for i := len(buffer) - 1; i > 0; i-- {
+		if buffer[i] != '\n' {
+			continue
+		}
+		before := bytes.TrimRight(buffer[:i], " \t")
+		if !bytes.HasSuffix(before, []byte("-")) {
+			return i + 1
+		}
+	}
+	if len(buffer) < streamMaxBlockSize {
+		return 0
+	}
+
+	if i := bytes.LastIndexAny(buffer, " \t"); i >= 0 {
+		return i + 1
+	}
+	cut := len(buffer) - 1
+	for cut > 0 && !utf8.RuneStart(buffer[cut]) {
+		cut--
+	}
+	return max(cut, 1)
+}
+
+// streamWord is a word of the streamed text with its position
+type streamWord struct {
+	text               string
+	start, end         int // byte offsets in the source text
+	startLine, endLine int
+	page               int
+	count              int // words or tokens the word counts for in a window
+}
+
+// streamChunker builds the word windows of WordChunker from the text written to it block by
+// block. Only the words of the current window are kept
+type streamChunker struct {
+	size, overlap int
+	unit          Tokenizer // the window size counts its tokens if it is set, else words
+	tokenizer     Tokenizer // measures the chunks against maxTokens
+	maxTokens     int
+	pages         bool
+	emit          func(models.Chunk) error
+
+	window     []streamWord
+	total      int // words or tokens of the window
+	nextID     int
+	base       int         // offset of the next block in the source text
+	word       *streamWord // word at the end of the last block, completed by the next one
+	line, page int         // line of the source and page at the start of the next block
+	pageBreaks bool
+}
+
+// write adds the words of the normalized block, the spans refer to the source of the block.
+// The page breaks count as whitespace like in chunkDocument
+func (c *streamChunker) write(source string, block string, offsets *offsetMap) error {
+	spans := newSourceSpans(source, offsets)
+	position := func(offset int, end bool) (int, int) {
+		local := offsets.source(offset, end)
+		line := local
+		if end {
+			line--
+		}
+		return c.base + local, c.line + spans.line(line) - 1
+	}
+
+	start := 0
+	for i, r := range block {
+		if !unicode.IsSpace(r) {
+			if c.word == nil {
+				start, c.word = i, &streamWord{page: c.page}
+				c.word.start, c.word.startLine = position(i, false)
+			}
+			continue
+		}
+
+		if c.word != nil {
+			// a word that ends with the last block keeps the end it got there
+			c.word.text += block[start:i]
+			if i > 0 {
+				c.word.end, c.word.endLine = position(i, true)
+			}
+			if err := c.add(*c.word); err != nil {
+				return err
+			}
+			c.word = nil
+		}
+		if r == '\f' {
+			c.page++
+			c.pageBreaks = true
+		}
+	}
+
+	if c.word != nil {
+		c.word.text += block[start:]
+		c.word.end, c.word.endLine = position(len(block), true)
+
+		// text without whitespace is not kept whole, it is cut like in blockEnd
+		if len(c.word.text) >= streamMaxWordSize {
+			if err := c.add(*c.word); err != nil {
+				return err
+			}
+			c.word = nil
+		}
+	}
+	c.line += len(spans.lineStarts) - 1
+	c.base += len(source)
+	return nil
+}
+
+// add appends the word to the window and emits the windows that are complete, like tokenWindow:
+// a window takes words while they fit into size, the next one starts with the last words of
+// it that fit into overlap
+func (c *streamChunker) add(word streamWord) error {
+	word.count = 1
+	if c.unit != nil {
+		word.count = c.unit.CountTokens(word.text)
+	}
+	c.window = append(c.window, word)
+	c.total += word.count
+
+	for len(c.window) > 1 && c.total > c.size {
+		last := len(c.window) - 1
+		if err := c.emitWindow(c.window[:last]); err != nil {
+			return err
+		}
+
+		next, shared := last, 0
+		for next-1 > 0 && shared+c.window[next-1].count <= c.overlap {
+			next--
+			shared += c.window[next].count
+		}
+		c.window = append(c.window[:0], c.window[next:]...)
+		c.total = 0
+		for _, word := range c.window {
+			c.total += word.count
+		}
+	}
+	return nil
+}
+
+// flush emits the last window
+func (c *streamChunker) flush() error {
+	if c.word != nil {
+		if err := c.add(*c.word); err != nil {
+			return err
+		}
+		c.word = nil
+	}
+	if len(c.window) == 0 {
+		return nil
+	}
+	err := c.emitWindow(c.window)
+	c.window, c.total = c.window[:0], 0
+	return err
+}
+
+// emitWindow emits the chunk of the words, re-split like splitOversizedChunks if it has more than maxTokens tokens
+func (c *streamChunker) emitWindow(words []streamWord) error {
+	texts := make([]string, len(words))
+	units := make([]textUnit, len(words))
+	for i, word := range words {
+		texts[i] = word.text
+		units[i] = textUnit{text: word.text, start: word.start, end: word.end}
+	}
+
+	if c.maxTokens <= 0 || c.tokenizer.CountTokens(strings.Join(texts, " ")) <= c.maxTokens {
+		return c.emitChunk(words, texts)
+	}
+
+	first := 0
+	for _, part := range tokenWindow(units, c.tokenizer, c.maxTokens, 0) {
+		last := first + len(strings.Fields(part.Text))
+		if err := c.emitChunk(words[first:last], texts[first:last]); err != nil {
+			return err
+		}
+		first = last
+	}
+	return nil
+}
+
+func (c *streamChunker) emitChunk(words []streamWord, texts []string) error {
+	first, last := words[0], words[len(words)-1]
+	chunk := models.Chunk{
+		ID:   c.nextID,
+		Text: strings.Join(texts, " "),
+		Span: &models.Span{StartOffset: first.start, EndOffset: last.end, StartLine: first.startLine, EndLine: last.endLine},
+	}
+	if c.pages {
+		chunk.Metadata = map[string]any{"page": first.page, "page_end": last.page}
+	}
+	c.nextID++
+
+	return c.emit(chunk)
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"rag-pipeline/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStreamChunks(t *testing.T) {
+	tokenizer := newTestWordPieceTokenizer(t)
+	normalizer, err := NewNormalizer(models.NormalizationSettings{RemoveControlChars: true, Dehyphenate: true})
+	if err != nil {
+		t.Fatalf("NewNormalizer failed: %v", err)
+	}
+
+	// several blocks of text with Windows line breaks, page breaks, hyphenated words and
+	// words of 4 tokens, so the windows have to be re-split to fit into the embedding model
+	var text strings.Builder
+	for i := 0; text.Len() < 3*streamBlockSize; i++ {
+		switch {
+		case i%300 == 1:
+			text.WriteString("unaff-\r\nable")
+		case i%7 == 0:
+			text.WriteString("unaffables")
+		default:
+			fmt.Fprintf(&text, "w%d", i)
+		}
+
+		switch {
+		case i%997 == 0:
+			text.WriteString("\f")
+		case i%13 == 0:
+			text.WriteString("\r\n")
+		case i%29 == 0:
+			text.WriteString(" \t ")
+		default:
+			text.WriteString(" ")
+		}
+	}
+
+	tokenWindows := NewWordChunker(60, 20)
+	tokenWindows.Tokenizer = tokenizer
+
+	for name, chunker := range map[string]*WordChunker{"words": NewWordChunker(50, 10), "tokens": tokenWindows} {
+		t.Run(name, func(t *testing.T) {
+			config := &models.Config{}
+			config.Embedding.MaxTokens = 40
+			r := &RAGService{Chunker: chunker, Normalizer: normalizer, Tokenizer: tokenizer, Config: config}
+
+			assertStreamChunks(t, r, text.String())
+		})
+	}
+}
+
+func TestStreamChunksRepeatedText(t *testing.T) {
+	tokenizer := newTestWordPieceTokenizer(t)
+
+	// the same words over and over, across blocks and pages
+	text := strings.Repeat(strings.Repeat("the same line\r\n", 500)+"unaffable unaffable\f", 8)
+
+	tokenWindows := NewWordChunker(12, 5)
+	tokenWindows.Tokenizer = tokenizer
+
+	for name, chunker := range map[string]*WordChunker{"words": NewWordChunker(7, 3), "tokens": tokenWindows} {
+		t.Run(name, func(t *testing.T) {
+			config := &models.Config{}
+			config.Embedding.MaxTokens = 8
+			r := &RAGService{Chunker: chunker, Tokenizer: tokenizer, Config: config}
+
+			assertStreamChunks(t, r, text)
+		})
+	}
+}
+
+// assertStreamChunks checks that streaming the text gives the chunks of chunkDocument
+func assertStreamChunks(t *testing.T, r *RAGService, text string) {
+	t.Helper()
+
+	want := r.chunkDocument(r.Chunker, "big.txt", models.ExtractedDocument{Text: text})
+
+	var got []models.Chunk
+	pages, err := r.streamChunks(bytes.NewReader([]byte(text)), true, func(chunk models.Chunk) error {
+		got = append(got, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("streamChunks failed: %v", err)
+	}
+	if !pages {
+		t.Errorf("Expected the page breaks to be reported")
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d chunks, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("Chunk %d: expected %+v %+v, got %+v %+v", i, want[i], want[i].Span, got[i], got[i].Span)
+		}
+	}
+}
+
+func TestStreams(t *testing.T) {
+	config := &models.Config{}
+	config.Streaming.MinSize = 10
+	r := &RAGService{Chunker: NewWordChunker(50, 10), Config: config}
+	head := []byte("plain text")
+
+	if !r.streams(100, "big.txt", head) {
+		t.Errorf("Expected a large text file to be streamed")
+	}
+	if r.streams(5, "big.txt", head) {
+		t.Errorf("Expected a file below min_size to be read whole")
+	}
+
+	normalizer, err := NewNormalizer(models.NormalizationSettings{Filters: []models.RegexFilter{{Pattern: `a\s+b`}}})
+	if err != nil {
+		t.Fatalf("NewNormalizer failed: %v", err)
+	}
+	r.Normalizer = normalizer
+	if r.streams(100, "big.txt", head) {
+		t.Errorf("Expected the filters to disable streaming")
+	}
+}
+
+func TestStreamChunkerLongWord(t *testing.T) {
+	var chunks []models.Chunk
+	c := &streamChunker{size: 10, line: 1, page: 1, emit: func(chunk models.Chunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	}}
+
+	// three blocks without whitespace, the word is cut once it reaches streamMaxWordSize
+	block := strings.Repeat("x", streamMaxWordSize/2+1)
+	for range 3 {
+		if err := c.write(block, block, nil); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if c.word != nil && len(c.word.text) >= streamMaxWordSize {
+			t.Fatalf("Expected the partial word to be cut, it has %d bytes", len(c.word.text))
+		}
+	}
+	if err := c.flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	if len(chunks) != 1 {
+		t.Fatalf("Expected 1 chunk, got %d", len(chunks))
+	}
+	words := strings.Fields(chunks[0].Text)
+	if len(words) != 2 || len(words[0]) != 2*len(block) || len(words[1]) != len(block) {
+		t.Errorf("Expected words of %d and %d bytes, got %d words", 2*len(block), len(block), len(words))
+	}
+	if span := chunks[0].Span; span.StartOffset != 0 || span.EndOffset != 3*len(block) {
+		t.Errorf("Expected the span of all blocks, got %+v", span)
+	}
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"rag-pipeline/models"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	unknownToken         = "[UNK]"
+	maxWordPieceWordSize = 100 // longer words become a single unknown token, as in BERT
+)
+
+// Tokenizer splits a text into the tokens a model sees
+type Tokenizer interface {
+	Tokenize(text string) []string
+	CountTokens(text string) int
+}
+
+// NewTokenizer creates and returns the tokenizer selected by config.Tokenizer.Type
+func NewTokenizer(config *models.Config) (Tokenizer, error) {
+	switch config.Tokenizer.Type {
+	case "", "word":
+		return WordTokenizer{}, nil
+	case "wordpiece":
+		return LoadWordPieceTokenizer(config.Tokenizer.VocabPath, config.Tokenizer.Lowercase)
+	default:
+		return nil, fmt.Errorf("tokenizer.go|NewTokenizer: unknown tokenizer %q", config.Tokenizer.Type)
+	}
+}
+
+// WordTokenizer treats every whitespace separated word as one token
+type WordTokenizer struct{}
+
+func (WordTokenizer) Tokenize(text string) []string {
+	return strings.Fields(text)
+}
+
+func (WordTokenizer) CountTokens(text string) int {
+	return wordCount(text)
+}
+
+// WordPieceTokenizer is the WordPiece tokenizer of BERT style embedding models
+// (e.g. nomic-embed-text). Words are split on whitespace and punctuation and then
+// into the longest sub-words of the vocabulary, continuations are prefixed with "##"
+type WordPieceTokenizer struct {
+	Vocab     map[string]bool
+	Lowercase bool // lowercase and strip accents, as the uncased models expect
+}
+
+// LoadWordPieceTokenizer reads a vocab.txt file with one token per line
+func LoadWordPieceTokenizer(vocabPath string, lowercase bool) (*WordPieceTokenizer, error) {
+	if vocabPath == "" {
+		return nil, fmt.Errorf("tokenizer.go|LoadWordPieceTokenizer: tokenizer.vocab_path is required for the wordpiece tokenizer")
+	}
+
+	file, err := os.Open(vocabPath)
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer.go|LoadWordPieceTokenizer: failed to open vocab: %w", err)
+	}
+	defer file.Close()
+
+	vocab := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		token := strings.TrimRight(scanner.Text(), "\r")
+		if token != "" {
+			vocab[token] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("tokenizer.go|LoadWordPieceTokenizer: failed to read vocab: %w", err)
+	}
+
+	if len(vocab) == 0 {
+		return nil, fmt.Errorf("tokenizer.go|LoadWordPieceTokenizer: vocab %s is empty", vocabPath)
+	}
+
+	return &WordPieceTokenizer{Vocab: vocab, Lowercase: lowercase}, nil
+}
+
+// Tokenize returns the WordPiece tokens of the text
+func (wp *WordPieceTokenizer) Tokenize(text string) []string {
+	var tokens []string
+	for _, word := range wp.basicTokenize(text) {
+		tokens = append(tokens, wp.wordPieces(word)...)
+	}
+	return tokens
+}
+
+// CountTokens returns the number of WordPiece tokens of the text
+func (wp *WordPieceTokenizer) CountTokens(text string) int {
+	count := 0
+	for _, word := range wp.basicTokenize(text) {
+		count += len(wp.wordPieces(word))
+	}
+	return count
+}
+
+// basicTokenize cleans the text and splits it into words and single punctuation characters
+func (wp *WordPieceTokenizer) basicTokenize(text string) []string {
+	if wp.Lowercase {
+		text = stripAccents(strings.ToLower(text))
+	}
+
+	var words []string
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			words = append(words, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case r == 0 || r == unicode.ReplacementChar || (unicode.IsControl(r) && !unicode.IsSpace(r)):
+			continue
+		case unicode.IsSpace(r):
+			flush()
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.Is(unicode.Han, r):
+			flush()
+			words = append(words, string(r))
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return words
+}
+
+// wordPieces splits a word into the longest matching vocabulary entries, from left to right
+func (wp *WordPieceTokenizer) wordPieces(word string) []string {
+	runes := []rune(word)
+	if len(runes) > maxWordPieceWordSize {
+		return []string{unknownToken}
+	}
+
+	var pieces []string
+	for start := 0; start < len(runes); {
+		end := len(runes)
+		piece := ""
+		for ; end > start; end-- {
+			candidate := string(runes[start:end])
+			if start > 0 {
+				candidate = "##" + candidate
+			}
+			if wp.Vocab[candidate] {
+				piece = candidate
+				break
+			}
+		}
+
+		if piece == "" {
+			return []string{unknownToken}
+		}
+
+		pieces = append(pieces, piece)
+		start = end
+	}
+
+	return pieces
+}
+
+// stripAccents removes the combining marks left by the canonical decomposition of the text
+func stripAccents(text string) string {
+	var builder strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		if !unicode.Is(unicode.Mn, r) {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
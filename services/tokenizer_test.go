@@ -0,0 +1,86 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"rag-pipeline/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestWordPieceTokenizer(t *testing.T) *WordPieceTokenizer {
+	t.Helper()
+
+	vocab := []string{"[UNK]", "the", "cafe", "un", "##aff", "##able", "##s", "is", "run", "##ning", ",", "!"}
+	path := filepath.Join(t.TempDir(), "vocab.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(vocab, "\n")), 0o644); err != nil {
+		t.Fatalf("Failed to write vocab: %v", err)
+	}
+
+	tokenizer, err := LoadWordPieceTokenizer(path, true)
+	if err != nil {
+		t.Fatalf("LoadWordPieceTokenizer failed: %v", err)
+	}
+	return tokenizer
+}
+
+func TestWordPieceTokenizer(t *testing.T) {
+	tokenizer := newTestWordPieceTokenizer(t)
+
+	tokens := tokenizer.Tokenize("The Café is unaffable, running! xyz")
+	want := []string{"the", "cafe", "is", "un", "##aff", "##able", ",", "run", "##ning", "!", "[UNK]"}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Expected tokens %q, got %q", want, tokens)
+	}
+
+	if count := tokenizer.CountTokens("unaffables"); count != 4 {
+		t.Errorf("Expected 4 tokens, got %d", count)
+	}
+}
+
+func TestTokenWordChunker(t *testing.T) {
+	tokenizer := newTestWordPieceTokenizer(t)
+
+	// token counts per word: running=2 the=1 unaffable=3 cafe=1 running=2
+	chunker := NewWordChunker(4, 2)
+	chunker.Tokenizer = tokenizer
+
+	chunks := chunker.ChunkText("running the unaffable cafe running")
+	// "unaffable" does not fit into the 2 overlap tokens, so it is not repeated
+	assertChunks(t, chunks, []string{"running the", "the unaffable", "cafe running"})
+
+	for _, chunk := range chunks {
+		if tokenizer.CountTokens(chunk.Text) > 4 {
+			t.Errorf("Chunk %q exceeds 4 tokens", chunk.Text)
+		}
+	}
+}
+
+func TestSplitOversizedChunks(t *testing.T) {
+	text := "one two three four five\n\nsix"
+	chunks := NewParagraphChunker(1, 0).ChunkText(text)
+
+	chunks = splitOversizedChunks(text, chunks, WordTokenizer{}, 2)
+	assertChunks(t, chunks, []string{"one two", "three four", "five", "six"})
+	if span := chunks[1].Span; span == nil || text[span.StartOffset:span.EndOffset] != "three four" {
+		t.Errorf("Expected the span of the second part to cover \"three four\", got %+v", span)
+	}
+}
+
+func TestChunkTokenLimit(t *testing.T) {
+	config := &models.Config{}
+	r := &RAGService{Chunker: NewParagraphChunker(1, 0), Tokenizer: WordTokenizer{}, Config: config}
+
+	// the model adds [CLS] and [SEP] to the chunk
+	for maxTokens, want := range map[int]int{0: 0, 512: 510, 4: 2, 2: 1} {
+		config.Embedding.MaxTokens = maxTokens
+		if got := r.chunkTokenLimit(); got != want {
+			t.Errorf("max_tokens %d: expected a limit of %d, got %d", maxTokens, want, got)
+		}
+	}
+
+	config.Embedding.MaxTokens = 4
+	chunks := r.chunkDocument(r.Chunker, "a.txt", models.ExtractedDocument{Text: "one two three four five\n\nsix"})
+	assertChunks(t, chunks, []string{"one two", "three four", "five", "six"})
+}
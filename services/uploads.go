@@ -0,0 +1,338 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"rag-pipeline/extractor"
+	"rag-pipeline/models"
+	"strings"
+)
+
+const (
+	maxArchiveFiles     = 10000     // files unpacked from one archive
+	maxArchiveFileSize  = 64 << 20  // decompressed size of one file of an archive
+	maxArchiveTotalSize = 256 << 20 // decompressed size of all files of an archive
+	uploadHeadSize      = 512       // bytes the format of an upload is detected from
+)
+
+// ErrUnsupportedFile is returned for an uploaded file whose format can not be extracted
+var ErrUnsupportedFile = errors.New("unsupported file type")
+
+// StoreFiles stores every uploaded file, archives are unpacked and every supported file inside
+// is stored. A file that fails does not stop the others, the results are in the upload order
+func (r *RAGService) StoreFiles(uploads []models.Upload) []models.StoreResult {
+	files, results, cleanup := planUploads(uploads)
+	defer cleanup()
+
+	for i := range results {
+		if results[i].Status == "" {
+			results[i] = r.storeFile(files[i], nil)
+		}
+	}
+
+	return results
+}
+
+// planUploads unpacks the archives of the uploads and returns the files with their results.
+// Files that are stored have an empty status, unsupported files of archives are "skipped",
+// unsupported uploads and archives that can not be unpacked are "failed", the files read before
+// the error of an archive are kept. The files of the archives are unpacked into temporary files,
+// cleanup removes them once the files are stored
+func planUploads(uploads []models.Upload) ([]models.Upload, []models.StoreResult, func()) {
+	var files []models.Upload
+	var results []models.StoreResult
+	var unpacked []models.Upload
+	cleanup := func() { removeTempUploads(unpacked) }
+
+	for _, upload := range uploads {
+		if !isArchive(upload.Filename) {
+			result := models.StoreResult{Filename: upload.Filename}
+			if err := checkSupported(upload); err != nil {
+				result.Status = "failed"
+				result.Error = err.Error()
+				upload = models.Upload{Filename: upload.Filename}
+			}
+			files = append(files, upload)
+			results = append(results, result)
+			continue
+		}
+
+		archiveFiles, err := unpackArchive(upload)
+		unpacked = append(unpacked, archiveFiles...)
+		for _, file := range archiveFiles {
+			result := models.StoreResult{Filename: file.Filename}
+			if err := checkSupported(file); err != nil {
+				result.Status = "skipped"
+				result.Error = ErrUnsupportedFile.Error()
+				file = models.Upload{Filename: file.Filename}
+			}
+			files = append(files, file)
+			results = append(results, result)
+		}
+		if err != nil {
+			files = append(files, models.Upload{Filename: upload.Filename})
+			results = append(results, models.StoreResult{Filename: upload.Filename, Status: "failed", Error: err.Error()})
+		}
+	}
+
+	return files, results, cleanup
+}
+
+// checkSupported returns ErrUnsupportedFile if the format of the upload can not be extracted.
+// Files of an unknown format are read as plain text if they start with text
+func checkSupported(upload models.Upload) error {
+	head := upload.Content[:min(len(upload.Content), uploadHeadSize)]
+	if upload.File != nil {
+		head = make([]byte, uploadHeadSize)
+		n, err := io.ReadFull(upload.File, head)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("uploads.go|checkSupported: failed to read %s: %w", upload.Filename, err)
+		}
+		if _, err := upload.File.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("uploads.go|checkSupported: failed to rewind %s: %w", upload.Filename, err)
+		}
+		head = head[:n]
+	}
+
+	if !supportedHead(upload.Filename, head) {
+		return fmt.Errorf("uploads.go|checkSupported: %s: %w", upload.Filename, ErrUnsupportedFile)
+	}
+	return nil
+}
+
+// supportedHead reports whether the file with the name and the first bytes can be extracted
+func supportedHead(filename string, head []byte) bool {
+	return extractor.IsPlainText(filename, head) || extractor.Supported(filename, head)
+}
+
+// readUpload returns the upload with the content of its file
+func readUpload(upload models.Upload) (models.Upload, error) {
+	if upload.File == nil {
+		return upload, nil
+	}
+
+	content, err := io.ReadAll(upload.File)
+	if err != nil {
+		return upload, fmt.Errorf("uploads.go|readUpload: failed to read %s: %w", upload.Filename, err)
+	}
+	return models.Upload{Filename: upload.Filename, Content: content}, nil
+}
+
+// StoreUpload stores one uploaded file read from file, an archive is unpacked like by StoreFiles.
+// Other files are stored by StoreReader, so large plain text files are streamed
+func (r *RAGService) StoreUpload(filename string, file io.ReadSeeker, size int64) []models.StoreResult {
+	if !isArchive(filename) {
+		return []models.StoreResult{r.storeFileReader(filename, file, size, nil)}
+	}
+	return r.StoreFiles([]models.Upload{{Filename: filename, File: file, Size: size}})
+}
+
+// storeFile stores one file and returns its result
+func (r *RAGService) storeFile(upload models.Upload, run *ingestRun) models.StoreResult {
+	if upload.File != nil {
+		return r.storeFileReader(upload.Filename, upload.File, upload.Size, run)
+	}
+	return r.storeFileReader(upload.Filename, bytes.NewReader(upload.Content), int64(len(upload.Content)), run)
+}
+
+// storeFileReader stores one file read from file and returns its result
+func (r *RAGService) storeFileReader(filename string, file io.ReadSeeker, size int64, run *ingestRun) models.StoreResult {
+	result := models.StoreResult{Filename: filename}
+
+	doc, err := r.storeReader(filename, file, size, run)
+	if err != nil {
+		log.Printf("uploads.go|storeFileReader: failed to store %s: %v", filename, err)
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = "stored"
+	result.DocumentID = doc.ID
+	result.ChunkCount = doc.ChunkCount
+	return result
+}
+
+// isArchive reports whether the upload is a zip or tar archive that is unpacked. DOCX, EPUB and
+// ODT files are ZIP containers as well, they are documents because of their extension
+func isArchive(filename string) bool {
+	name := strings.ToLower(filename)
+	for _, suffix := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// unpackArchive returns the regular files of the archive, named by the archive name and their
+// path in it, e.g. "corpus.zip/docs/intro.md". The files are unpacked into temporary files, which
+// removeTempUploads removes. Hidden files and macOS resource forks are left out.
+// On an error the files read before it are returned with the error
+func unpackArchive(archive models.Upload) ([]models.Upload, error) {
+	unpacker := &archiveUnpacker{name: archive.Filename}
+
+	var data io.ReadSeeker = bytes.NewReader(archive.Content)
+	size := int64(len(archive.Content))
+	if archive.File != nil {
+		data, size = archive.File, archive.Size
+	}
+
+	var err error
+	if strings.HasSuffix(strings.ToLower(archive.Filename), ".zip") {
+		err = unpacker.unzip(data, size)
+	} else {
+		err = unpacker.untar(data)
+	}
+	if err != nil {
+		return unpacker.files, fmt.Errorf("uploads.go|unpackArchive: %s: %w", archive.Filename, err)
+	}
+
+	return unpacker.files, nil
+}
+
+// removeTempUploads closes and removes the temporary files of unpackArchive
+func removeTempUploads(files []models.Upload) {
+	for _, file := range files {
+		temp, ok := file.File.(*os.File)
+		if !ok {
+			continue
+		}
+		temp.Close()
+		if err := os.Remove(temp.Name()); err != nil {
+			log.Printf("uploads.go|removeTempUploads: %v", err)
+		}
+	}
+}
+
+// archiveUnpacker collects the files of an archive within the archive limits
+type archiveUnpacker struct {
+	name      string
+	files     []models.Upload
+	totalSize int64
+}
+
+func (u *archiveUnpacker) unzip(data io.ReadSeeker, size int64) error {
+	// the multipart files and the files of jobs can be read at any offset, other readers are
+	// copied into a temporary file first
+	readerAt, ok := data.(io.ReaderAt)
+	if !ok {
+		temp, err := os.CreateTemp("", "rag-archive-*.zip")
+		if err != nil {
+			return fmt.Errorf("failed to create a temporary file: %w", err)
+		}
+		defer os.Remove(temp.Name())
+		defer temp.Close()
+		if size, err = io.Copy(temp, data); err != nil {
+			return fmt.Errorf("failed to copy the archive: %w", err)
+		}
+		readerAt = temp
+	}
+
+	reader, err := zip.NewReader(readerAt, size)
+	if err != nil {
+		return fmt.Errorf("not a ZIP archive: %w", err)
+	}
+
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() || isHiddenPath(file.Name) {
+			continue
+		}
+
+		data, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", file.Name, err)
+		}
+		err = u.add(file.Name, data)
+		data.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *archiveUnpacker) untar(data io.Reader) error {
+	buffered := bufio.NewReader(data)
+	data = buffered
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return fmt.Errorf("not a gzip archive: %w", err)
+		}
+		defer decompressed.Close()
+		data = decompressed
+	}
+
+	reader := tar.NewReader(data)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("not a tar archive: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg || isHiddenPath(header.Name) {
+			continue
+		}
+		if err := u.add(header.Name, reader); err != nil {
+			return err
+		}
+	}
+}
+
+// add copies a file of the archive into a temporary file
+func (u *archiveUnpacker) add(name string, data io.Reader) error {
+	if len(u.files) >= maxArchiveFiles {
+		return fmt.Errorf("the archive has more than %d files", maxArchiveFiles)
+	}
+
+	temp, err := os.CreateTemp("", "rag-upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary file for %s: %w", name, err)
+	}
+	file := models.Upload{Filename: u.name + "/" + path.Clean(name), File: temp}
+
+	file.Size, err = io.Copy(temp, io.LimitReader(data, maxArchiveFileSize+1))
+	u.totalSize += file.Size
+	switch {
+	case err != nil:
+		err = fmt.Errorf("failed to read %s: %w", name, err)
+	case file.Size > maxArchiveFileSize:
+		err = fmt.Errorf("%s is larger than %d bytes", name, maxArchiveFileSize)
+	case u.totalSize > maxArchiveTotalSize:
+		err = fmt.Errorf("the archive is larger than %d bytes", maxArchiveTotalSize)
+	default:
+		if _, err = temp.Seek(0, io.SeekStart); err != nil {
+			err = fmt.Errorf("failed to rewind %s: %w", name, err)
+		}
+	}
+	if err != nil {
+		removeTempUploads([]models.Upload{file})
+		return err
+	}
+
+	u.files = append(u.files, file)
+	return nil
+}
+
+// isHiddenPath reports whether a path of the archive is hidden, e.g. ".git/config" or "__MACOSX/._a.txt"
+func isHiddenPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") && part != "." && part != ".." || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
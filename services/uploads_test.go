@@ -0,0 +1,122 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"rag-pipeline/models"
+	"testing"
+)
+
+func TestUnpackArchive(t *testing.T) {
+	var buffer bytes.Buffer
+	compressed := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(compressed)
+	for _, file := range []struct{ name, content string }{
+		{"notes/", ""},
+		{"notes/a.txt", "sheep"},
+		{"./notes/b.md", "# Goats"},
+		{".git/config", "hidden"},
+		{"__MACOSX/notes/._a.txt", "resource fork"},
+	} {
+		header := &tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.content)), Typeflag: tar.TypeReg}
+		if file.content == "" {
+			header.Typeflag = tar.TypeDir
+		}
+		writer.WriteHeader(header)
+		writer.Write([]byte(file.content))
+	}
+	writer.Close()
+	compressed.Close()
+
+	files, err := unpackArchive(models.Upload{Filename: "corpus.tar.gz", Content: buffer.Bytes()})
+	if err != nil {
+		t.Fatalf("unpackArchive failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Filename != "corpus.tar.gz/notes/a.txt" || files[1].Filename != "corpus.tar.gz/notes/b.md" {
+		t.Fatalf("Unexpected files: %+v", files)
+	}
+
+	// the files are unpacked into temporary files
+	content, err := io.ReadAll(files[1].File)
+	if err != nil || string(content) != "# Goats" || files[1].Size != 7 {
+		t.Errorf("Unexpected content %q (%d bytes): %v", content, files[1].Size, err)
+	}
+	temp := files[1].File.(*os.File).Name()
+	removeTempUploads(files)
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary file to be removed, got %v", err)
+	}
+
+	// a truncated archive is an error
+	files, err = unpackArchive(models.Upload{Filename: "corpus.tgz", Content: buffer.Bytes()[:buffer.Len()/2]})
+	removeTempUploads(files)
+	if err == nil {
+		t.Errorf("Expected an error for a truncated archive, got %d files", len(files))
+	}
+
+	if isArchive("book.epub") || isArchive("report.docx") || !isArchive("Corpus.TGZ") {
+		t.Error("Unexpected archive detection")
+	}
+}
+
+// readSeeker hides the io.ReaderAt of its reader
+type readSeeker struct{ io.ReadSeeker }
+
+func TestPlanUploads(t *testing.T) {
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for _, entry := range [][2]string{{"a.md", "# Sheep"}, {"image.png", "\x89PNG\x00\x00"}} {
+		file, _ := writer.Create(entry[0])
+		file.Write([]byte(entry[1]))
+	}
+	writer.Close()
+
+	uploads := []models.Upload{
+		{Filename: "notes.txt", Content: []byte("one two three")},
+		{Filename: "notes", Content: []byte("text of an unknown format")},
+		{Filename: "photo.png", Content: []byte("\x89PNG\x00\x00")},
+		{Filename: "blob", File: bytes.NewReader([]byte{0, 1, 2, 3}), Size: 4},
+		{Filename: "corpus.zip", File: readSeeker{bytes.NewReader(archive.Bytes())}, Size: int64(archive.Len())},
+	}
+	files, results, cleanup := planUploads(uploads)
+
+	// unsupported uploads fail on their own, unsupported files of archives are skipped
+	expected := []struct{ filename, status string }{
+		{"notes.txt", ""},
+		{"notes", ""},
+		{"photo.png", "failed"},
+		{"blob", "failed"},
+		{"corpus.zip/a.md", ""},
+		{"corpus.zip/image.png", "skipped"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v", len(expected), results)
+	}
+	for i, want := range expected {
+		if results[i].Filename != want.filename || results[i].Status != want.status {
+			t.Errorf("Result %d: expected %s %q, got %+v", i, want.filename, want.status, results[i])
+		}
+		if want.status != "" && results[i].Error == "" {
+			t.Errorf("Expected an error for %s", want.filename)
+		}
+	}
+
+	// the rejected upload is not kept, its file was rewound after its format was checked
+	if files[3].File != nil {
+		t.Errorf("Expected no file for the failed upload, got %v", files[3])
+	}
+	head := make([]byte, 1)
+	if n, _ := uploads[3].File.Read(head); n != 1 || head[0] != 0 {
+		t.Errorf("Expected the upload to be rewound, read %v", head[:n])
+	}
+
+	temp := files[4].File.(*os.File).Name()
+	cleanup()
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Errorf("Expected the unpacked file to be removed by cleanup, got %v", err)
+	}
+}
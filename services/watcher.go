@@ -0,0 +1,303 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"rag-pipeline/extractor"
+	"rag-pipeline/models"
+	"sync"
+	"time"
+)
+
+// watcherOrigin is the origin of the documents stored by the FolderWatcher
+const watcherOrigin = "watcher"
+
+// FolderWatcher polls a folder and keeps the collection in sync with it: new files are stored,
+// modified files are stored again and replace their old chunks, and the chunks of removed
+// files are deleted. The files are stored by StoreData under their path in the folder
+type FolderWatcher struct {
+	service  *RAGService
+	dir      string
+	interval time.Duration
+	path     string // file of the watched files, empty keeps them in memory
+
+	files    map[string]watchedFile // ingested files by their slash separated path in the folder
+	changing map[string]watchedFile // new or modified files seen by the last scan, not ingested yet
+
+	mu      sync.Mutex
+	running bool
+	closed  bool
+	stop    chan struct{} // closed by Close
+	done    chan struct{} // closed when Run returns
+}
+
+// watchedFile is the state of a file of the folder when it was ingested
+type watchedFile struct {
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modTime"`
+	DocumentID string    `json:"documentId,omitempty"` // empty if the file type is not supported
+}
+
+// NewFolderWatcher creates a FolderWatcher for the configured folder of the collection and loads
+// its state, so the files changed or removed while the service was stopped are found by the first scan
+func NewFolderWatcher(service *RAGService, config *models.Config, collectionName string) (*FolderWatcher, error) {
+	if config.Watcher.Dir == "" {
+		return nil, fmt.Errorf("watcher.go|NewFolderWatcher: watcher.dir is not set")
+	}
+	if err := os.MkdirAll(config.Watcher.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("watcher.go|NewFolderWatcher: failed to create %s: %w", config.Watcher.Dir, err)
+	}
+
+	watcher := &FolderWatcher{
+		service:  service,
+		dir:      config.Watcher.Dir,
+		interval: time.Duration(max(config.Watcher.Interval, 1)) * time.Second,
+		path:     watcherPath(config, collectionName),
+		files:    make(map[string]watchedFile),
+		changing: make(map[string]watchedFile),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if watcher.path == "" {
+		return watcher, nil
+	}
+
+	data, err := os.ReadFile(watcher.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return watcher, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("watcher.go|NewFolderWatcher: failed to read %s: %w", watcher.path, err)
+	}
+
+	if err := json.Unmarshal(data, &watcher.files); err != nil {
+		return nil, fmt.Errorf("watcher.go|NewFolderWatcher: failed to parse %s: %w", watcher.path, err)
+	}
+
+	return watcher, nil
+}
+
+// Run scans the folder every interval until the watcher is closed
+func (w *FolderWatcher) Run() {
+	w.mu.Lock()
+	if w.closed || w.running {
+		w.mu.Unlock()
+		return
+	}
+	w.running = true
+	w.mu.Unlock()
+	defer close(w.done)
+
+	log.Printf("watcher.go|Run: watching %s every %s", w.dir, w.interval)
+	for {
+		if err := w.Scan(); err != nil {
+			log.Printf("watcher.go|Run: %v", err)
+		}
+
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(w.interval):
+		}
+	}
+}
+
+// Close stops Run and waits for the scan it is running. A closed watcher can not be run again
+func (w *FolderWatcher) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.stop)
+	running := w.running
+	w.mu.Unlock()
+
+	if running {
+		<-w.done
+	}
+}
+
+// Scan compares the folder with the ingested files. A new or modified file is ingested once
+// its size and modification time are the same in two scans, so files that are still being
+// copied into the folder are not ingested half written. Hidden files are ignored
+func (w *FolderWatcher) Scan() error {
+	current := make(map[string]watchedFile)
+	err := filepath.WalkDir(w.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(w.dir, path)
+		if err != nil || name == "." {
+			return err
+		}
+		name = filepath.ToSlash(name)
+
+		if isHiddenPath(name) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		current[name] = watchedFile{Size: info.Size(), ModTime: info.ModTime().UTC()}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("watcher.go|Scan: failed to read %s: %w", w.dir, err)
+	}
+
+	changed := false
+	for name, file := range current {
+		if known, ok := w.files[name]; ok && sameFile(known, file) {
+			delete(w.changing, name)
+			continue
+		}
+
+		if seen, ok := w.changing[name]; !ok || !sameFile(seen, file) {
+			w.changing[name] = file
+			continue
+		}
+
+		delete(w.changing, name)
+		if w.ingest(name, file) {
+			changed = true
+		}
+	}
+
+	for name := range w.changing {
+		if _, ok := current[name]; !ok {
+			delete(w.changing, name)
+		}
+	}
+
+	for name, known := range w.files {
+		if _, ok := current[name]; ok {
+			continue
+		}
+		delete(w.files, name)
+		w.release(known.DocumentID)
+		log.Printf("watcher.go|Scan: %s was removed", name)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return w.save()
+}
+
+// ingest stores the file and deletes the chunks of its previous content. A file that fails is
+// tried again by the next scans, an unsupported file is recorded without a document
+func (w *FolderWatcher) ingest(name string, file watchedFile) bool {
+	content, err := os.ReadFile(filepath.Join(w.dir, filepath.FromSlash(name)))
+	if err != nil {
+		log.Printf("watcher.go|ingest: failed to read %s: %v", name, err)
+		return false
+	}
+
+	previous, known := w.files[name]
+
+	if !extractor.Supported(name, content) {
+		log.Printf("watcher.go|ingest: skipped %s: unsupported file type", name)
+	} else {
+		// a document uploaded with the same content stays an upload, so it is never deleted by the watcher
+		uploaded, registered := w.service.Documents.Get(newDocument(name, content, 0, nil).ID)
+
+		doc, err := w.service.StoreData(name, content)
+		if err != nil {
+			log.Printf("watcher.go|ingest: failed to store %s: %v", name, err)
+			return false
+		}
+		doc.Origin = watcherOrigin
+		if registered && uploaded.Origin != watcherOrigin {
+			doc.Origin = uploaded.Origin
+		}
+		if err := w.service.Documents.Add(*doc); err != nil {
+			log.Printf("watcher.go|ingest: failed to register %s: %v", name, err)
+			return false
+		}
+		file.DocumentID = doc.ID
+		log.Printf("watcher.go|ingest: stored %s as %s with %d chunks", name, doc.ID, doc.ChunkCount)
+	}
+
+	w.files[name] = file
+	if known && previous.DocumentID != file.DocumentID {
+		w.release(previous.DocumentID)
+	}
+	return true
+}
+
+// release deletes the document, unless another file of the folder has the same content or
+// the document was also uploaded, e.g. with /api/storebook
+func (w *FolderWatcher) release(documentID string) {
+	if documentID == "" {
+		return
+	}
+	for _, file := range w.files {
+		if file.DocumentID == documentID {
+			return
+		}
+	}
+	if doc, ok := w.service.Documents.Get(documentID); !ok || doc.Origin != watcherOrigin {
+		return
+	}
+
+	err := w.service.DeleteDocument(documentID)
+	if err != nil && !errors.Is(err, ErrDocumentNotFound) {
+		log.Printf("watcher.go|release: failed to delete the document %s: %v", documentID, err)
+	}
+}
+
+// save writes the ingested files to the state file
+func (w *FolderWatcher) save() error {
+	if w.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(w.files, "", "  ")
+	if err != nil {
+		return fmt.Errorf("watcher.go|save: failed to marshal the watched files: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return fmt.Errorf("watcher.go|save: failed to create directory: %w", err)
+	}
+
+	// write to a temporary file first, so a crash never leaves a half written state file
+	tmpPath := w.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("watcher.go|save: failed to write the watched files: %w", err)
+	}
+
+	return os.Rename(tmpPath, w.path)
+}
+
+// sameFile reports whether the size and modification time of the files are equal
+func sameFile(a watchedFile, b watchedFile) bool {
+	return a.Size == b.Size && a.ModTime.Equal(b.ModTime)
+}
+
+// watcherPath returns the state file of the folder watcher of the collection,
+// an empty path keeps the state in memory
+func watcherPath(config *models.Config, collectionName string) string {
+	if config.Storage.DataDir == "" {
+		return ""
+	}
+
+	return filepath.Join(config.Storage.DataDir, collectionName+"_watcher.json")
+}
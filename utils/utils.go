@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -74,3 +77,34 @@ func StoreChunk(chunk *[]models.Chunk) error {
 	}
 	return nil
 }
+
+// HashContent returns the hex encoded SHA-256 hash of the given content
+func HashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewPointUUID returns a deterministic, name-based (version 5 style) UUID
+// for the chunk with chunkID inside the document with documentID
+func NewPointUUID(documentID string, chunkID int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s/%d", documentID, chunkID)))
+
+	sum[6] = (sum[6] & 0x0f) | 0x50 // version 5
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// ToInt converts a numeric payload value to int, the vector stores return int, int64 or float64
+func ToInt(value any) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewPointUUID(t *testing.T) {
+	id := NewPointUUID("doc", 0)
+
+	// a version 5 UUID with the RFC 4122 variant
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+		t.Errorf("Expected a version 5 UUID, got %q", id)
+	}
+
+	if again := NewPointUUID("doc", 0); again != id {
+		t.Errorf("Expected the same UUID for the same chunk, got %q and %q", id, again)
+	}
+
+	seen := map[string]bool{id: true}
+	for _, other := range []string{NewPointUUID("doc", 1), NewPointUUID("doc2", 0), NewPointUUID("do", 10)} {
+		if seen[other] {
+			t.Errorf("Expected a new UUID for another chunk, got %q twice", other)
+		}
+		seen[other] = true
+	}
+}